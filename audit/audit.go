@@ -0,0 +1,205 @@
+package audit
+
+import (
+	"auth-service/middleware"
+	"auth-service/models"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"gorm.io/gorm"
+)
+
+var eventsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "auth_service_audit_events_total",
+	Help: "Audit events by result: stored, or logged (written to the service log only, because the queue was full or the database write kept failing).",
+}, []string{"result"})
+
+// Actions recorded in the audit log
+const (
+	ActionLoginSucceeded         = "login.succeeded"
+	ActionLoginFailed            = "login.failed"
+	ActionRegistered             = "user.registered"
+	ActionPasswordChanged        = "password.changed"
+	ActionEmailChanged           = "email.changed"
+	ActionAccountDeleted         = "account.deleted"
+	ActionUserCreated            = "user.created"
+	ActionUsersImported          = "users.imported"
+	ActionUserRestored           = "user.restored"
+	ActionUserSuspended          = "user.suspended"
+	ActionUserUnsuspended        = "user.unsuspended"
+	ActionPasswordChangeRequired = "user.password_change_required"
+	ActionTokensRevoked          = "tokens.revoked"
+	ActionOrgCreated             = "org.created"
+	ActionOrgMemberInvited       = "org.member_invited"
+	ActionOrgMemberAdded         = "org.member_added"
+	ActionOrgRoleChanged         = "org.member_role_changed"
+	ActionOrgMemberRemoved       = "org.member_removed"
+	ActionShareLinkRevoked       = "share_link.revoked"
+	ActionMaintenanceChanged     = "maintenance.changed"
+)
+
+// Event describes what happened. Record fills in the IP, request ID and time, and
+// the actor when ActorID is nil and the request is authenticated.
+type Event struct {
+	Action     string
+	ActorID    *uint
+	TargetType string
+	TargetID   string
+	Details    map[string]interface{}
+}
+
+// ForUser is an event whose target is the user account userID
+func ForUser(action string, userID uint) Event {
+	return Event{Action: action, TargetType: "user", TargetID: strconv.FormatUint(uint64(userID), 10)}
+}
+
+// By sets the actor, for events such as logins that happen before the request is
+// authenticated
+func (e Event) By(actorID uint) Event {
+	e.ActorID = &actorID
+	return e
+}
+
+// With adds a detail to the event
+func (e Event) With(key string, value interface{}) Event {
+	details := make(map[string]interface{}, len(e.Details)+1)
+	for k, v := range e.Details {
+		details[k] = v
+	}
+	details[key] = value
+	e.Details = details
+	return e
+}
+
+// queueSize bounds how many entries may wait for the database before new ones are
+// only logged
+const queueSize = 1024
+
+// writeAttempts is how many times an entry is offered to the database before it is
+// only logged
+const writeAttempts = 3
+
+// Writer stores audit entries from a background goroutine, so recording an event
+// never waits on the database
+type Writer struct {
+	db      *gorm.DB
+	entries chan models.AuditLog
+	done    chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+var (
+	stdMu sync.RWMutex
+	std   *Writer
+)
+
+// Start begins writing recorded events to db and makes the writer the one Record
+// uses. Call Close once no more requests are being served.
+func Start(db *gorm.DB) *Writer {
+	w := &Writer{db: db, entries: make(chan models.AuditLog, queueSize), done: make(chan struct{})}
+	go w.run()
+
+	stdMu.Lock()
+	std = w
+	stdMu.Unlock()
+	return w
+}
+
+// Close stops accepting entries and returns once the queued ones are written
+func (w *Writer) Close() {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.entries)
+	}
+	w.mu.Unlock()
+	<-w.done
+}
+
+// Record queues an audit entry for the event without blocking. When there is no
+// writer, its queue is full or the entry cannot be stored, the entry goes to the
+// service log instead so it is not lost.
+func Record(r *http.Request, event Event) {
+	entry := models.AuditLog{
+		ActorID:    event.ActorID,
+		Action:     event.Action,
+		TargetType: event.TargetType,
+		TargetID:   event.TargetID,
+		IP:         middleware.ClientIP(r),
+		Details:    event.Details,
+		CreatedAt:  time.Now(),
+	}
+	if entry.ActorID == nil {
+		if userID, ok := middleware.UserIDFromContext(r.Context()); ok {
+			entry.ActorID = &userID
+		}
+	}
+	if requestID, ok := middleware.RequestIDFromContext(r.Context()); ok {
+		entry.RequestID = requestID
+	}
+
+	stdMu.RLock()
+	w := std
+	stdMu.RUnlock()
+	if w == nil || !w.enqueue(entry) {
+		logEntry(entry, "not queued")
+	}
+}
+
+func (w *Writer) enqueue(entry models.AuditLog) bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return false
+	}
+	select {
+	case w.entries <- entry:
+		return true
+	default:
+		return false
+	}
+}
+
+func (w *Writer) run() {
+	defer close(w.done)
+	for entry := range w.entries {
+		w.store(entry)
+	}
+}
+
+// store writes one entry, retrying briefly so a momentary database hiccup does not
+// cost the record
+func (w *Writer) store(entry models.AuditLog) {
+	var err error
+	for attempt := 1; attempt <= writeAttempts; attempt++ {
+		entry.ID = 0
+		if err = w.db.Create(&entry).Error; err == nil {
+			eventsTotal.WithLabelValues("stored").Inc()
+			return
+		}
+		if attempt < writeAttempts {
+			time.Sleep(time.Duration(attempt) * 200 * time.Millisecond)
+		}
+	}
+	logEntry(entry, "write failed: "+err.Error())
+}
+
+// logEntry writes an entry that could not be stored to the service log as JSON, so
+// it can still be recovered from log aggregation
+func logEntry(entry models.AuditLog, reason string) {
+	eventsTotal.WithLabelValues("logged").Inc()
+	encoded, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("AUDIT (%s): %s %s/%s", reason, entry.Action, entry.TargetType, entry.TargetID)
+		return
+	}
+	log.Printf("AUDIT (%s): %s", reason, encoded)
+}
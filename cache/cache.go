@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// TTL is an in-memory cache whose entries expire ttl after they are set. It is safe
+// for concurrent use and, like the rate limiter, local to one instance. A ttl of zero
+// or less disables it: Get always misses.
+type TTL[K comparable, V any] struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	entries   map[K]entry[V]
+	lastSweep time.Time
+}
+
+type entry[V any] struct {
+	value     V
+	expiresAt time.Time
+}
+
+// New creates a TTL cache keeping entries for ttl
+func New[K comparable, V any](ttl time.Duration) *TTL[K, V] {
+	return &TTL[K, V]{ttl: ttl, entries: make(map[K]entry[V]), lastSweep: time.Now()}
+}
+
+// TTL returns how long entries are kept
+func (c *TTL[K, V]) TTL() time.Duration {
+	return c.ttl
+}
+
+// Get returns the value cached for key, if it has not expired
+func (c *TTL[K, V]) Get(key K) (V, bool) {
+	var zero V
+	if c.ttl <= 0 {
+		return zero, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached, ok := c.entries[key]
+	if !ok || !time.Now().Before(cached.expiresAt) {
+		return zero, false
+	}
+	return cached.value, true
+}
+
+// Set caches value for key
+func (c *TTL[K, V]) Set(key K, value V) {
+	if c.ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	c.sweepLocked(now)
+	c.entries[key] = entry[V]{value: value, expiresAt: now.Add(c.ttl)}
+}
+
+// Delete drops key so the next Get misses
+func (c *TTL[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+// sweepLocked drops expired entries at most once per ttl so the map stays bounded by
+// the keys set recently
+func (c *TTL[K, V]) sweepLocked(now time.Time) {
+	if now.Sub(c.lastSweep) < c.ttl {
+		return
+	}
+	for key, cached := range c.entries {
+		if !now.Before(cached.expiresAt) {
+			delete(c.entries, key)
+		}
+	}
+	c.lastSweep = now
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"auth-service/jwks"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// defaultJWKSCacheTTL is how long a fetched JWKS is used before it is fetched again
+const defaultJWKSCacheTTL = time.Hour
+
+// jwksFetchTimeout bounds one JWKS download
+const jwksFetchTimeout = 5 * time.Second
+
+// TrustedIssuer is an external identity provider whose tokens are accepted next to
+// locally issued ones. Its tokens are verified with either a shared HMAC Secret or
+// the public keys published at a JWKS URL, and map to the local account whose email
+// matches EmailClaim.
+type TrustedIssuer struct {
+	Issuer string
+	// Audience, when set, must be one of the token's aud values
+	Audience   string
+	EmailClaim string
+	Secret     []byte
+	JWKS       *jwks.Set
+}
+
+// trustedIssuerEntry is one element of the TRUSTED_ISSUERS JSON array
+type trustedIssuerEntry struct {
+	Issuer     string `json:"issuer"`
+	JWKSURL    string `json:"jwks_url"`
+	Secret     string `json:"secret"`
+	Audience   string `json:"audience"`
+	EmailClaim string `json:"email_claim"`
+}
+
+// loadTrustedIssuers parses TRUSTED_ISSUERS, a JSON array such as
+// [{"issuer":"https://idp.example.com","jwks_url":"https://idp.example.com/jwks.json","audience":"auth-service"}],
+// keyed by issuer. Each entry needs exactly one of jwks_url or secret; fetched key
+// sets are cached for JWKS_CACHE_TTL (1h).
+func loadTrustedIssuers() (map[string]*TrustedIssuer, error) {
+	value := strings.TrimSpace(getEnv("TRUSTED_ISSUERS", ""))
+	if value == "" {
+		return nil, nil
+	}
+	var entries []trustedIssuerEntry
+	if err := json.Unmarshal([]byte(value), &entries); err != nil {
+		return nil, fmt.Errorf("TRUSTED_ISSUERS must be a JSON array of issuers: %v", err)
+	}
+
+	ttl := defaultJWKSCacheTTL
+	if value := getEnv("JWKS_CACHE_TTL", ""); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("JWKS_CACHE_TTL must be a positive duration such as 1h, got %q", value)
+		}
+		ttl = parsed
+	}
+	client := &http.Client{Timeout: jwksFetchTimeout}
+
+	issuers := make(map[string]*TrustedIssuer, len(entries))
+	for _, entry := range entries {
+		if entry.Issuer == "" {
+			return nil, fmt.Errorf("TRUSTED_ISSUERS: every entry needs an issuer")
+		}
+		if _, duplicate := issuers[entry.Issuer]; duplicate {
+			return nil, fmt.Errorf("TRUSTED_ISSUERS: issuer %q is listed twice", entry.Issuer)
+		}
+		issuer := &TrustedIssuer{Issuer: entry.Issuer, Audience: entry.Audience, EmailClaim: entry.EmailClaim}
+		if issuer.EmailClaim == "" {
+			issuer.EmailClaim = "email"
+		}
+
+		switch {
+		case (entry.JWKSURL == "") == (entry.Secret == ""):
+			return nil, fmt.Errorf("TRUSTED_ISSUERS: issuer %q needs exactly one of jwks_url or secret", entry.Issuer)
+		case entry.Secret != "":
+			if len(entry.Secret) < minJWTSecretLength {
+				return nil, fmt.Errorf("TRUSTED_ISSUERS: secret of issuer %q is shorter than %d bytes", entry.Issuer, minJWTSecretLength)
+			}
+			issuer.Secret = []byte(entry.Secret)
+		default:
+			if err := checkJWKSURL(entry.JWKSURL); err != nil {
+				return nil, fmt.Errorf("TRUSTED_ISSUERS: jwks_url of issuer %q %v", entry.Issuer, err)
+			}
+			issuer.JWKS = jwks.New(entry.JWKSURL, ttl, client)
+		}
+		issuers[entry.Issuer] = issuer
+	}
+	return issuers, nil
+}
+
+// checkJWKSURL requires an https URL; plain http is only allowed for localhost
+func checkJWKSURL(value string) error {
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("must be an absolute URL")
+	}
+	host := u.Hostname()
+	loopback := host == "localhost"
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		loopback = true
+	}
+	if u.Scheme != "https" && !(u.Scheme == "http" && loopback) {
+		return fmt.Errorf("must use https")
+	}
+	return nil
+}
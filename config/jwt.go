@@ -0,0 +1,78 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// minJWTSecretLength is the shortest HS256 secret accepted in production (256 bits)
+const minJWTSecretLength = 32
+
+// devJWTSecret is only used outside production when JWT_SECRET is unset
+const devJWTSecret = "your-secret-key"
+
+// defaultJWTLeeway absorbs small clock differences between the issuer and this service
+const defaultJWTLeeway = 30 * time.Second
+
+// placeholderJWTSecrets are the example values shipped in the docs and .env.example
+var placeholderJWTSecrets = map[string]bool{
+	"your-secret-key":             true,
+	"your-secret-key-here":        true,
+	"your-very-secure-secret-key": true,
+	"secret":                      true,
+	"changeme":                    true,
+}
+
+// JWT holds the settings shared by token issuing (handlers) and validation (middleware)
+type JWT struct {
+	Secret []byte
+	// Leeway is the clock skew tolerated when checking exp, nbf and iat
+	Leeway time.Duration
+	// TrustedIssuers are the external issuers whose tokens are also accepted, keyed
+	// by their iss claim
+	TrustedIssuers map[string]*TrustedIssuer
+}
+
+// LoadJWT reads JWT_SECRET, JWT_LEEWAY and TRUSTED_ISSUERS once at startup. With ENV=production a
+// missing, placeholder or short secret is an error; in development it only logs a warning.
+func LoadJWT() (*JWT, error) {
+	secret := getEnv("JWT_SECRET", "")
+	production := getEnv("ENV", "development") == "production"
+
+	problem := ""
+	switch {
+	case secret == "":
+		problem = "JWT_SECRET is not set"
+	case placeholderJWTSecrets[secret]:
+		problem = "JWT_SECRET is a placeholder value"
+	case len(secret) < minJWTSecretLength:
+		problem = fmt.Sprintf("JWT_SECRET is shorter than %d bytes", minJWTSecretLength)
+	}
+
+	if problem != "" {
+		if production {
+			return nil, fmt.Errorf("%s", problem)
+		}
+		log.Printf("WARNING: %s; tokens are not secure (this is an error with ENV=production)", problem)
+		if secret == "" {
+			secret = devJWTSecret
+		}
+	}
+
+	leeway := defaultJWTLeeway
+	if value := getEnv("JWT_LEEWAY", ""); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < 0 {
+			return nil, fmt.Errorf("JWT_LEEWAY must be a non-negative duration such as 30s, got %q", value)
+		}
+		leeway = parsed
+	}
+
+	issuers, err := loadTrustedIssuers()
+	if err != nil {
+		return nil, err
+	}
+
+	return &JWT{Secret: []byte(secret), Leeway: leeway, TrustedIssuers: issuers}, nil
+}
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Services holds the base URLs of the downstream video services and the TLS settings
+// used to reach them over https
+type Services struct {
+	AnalyzeURL   *url.URL
+	TranscodeURL *url.URL
+	// TLSConfig is nil when no CA bundle or client certificate is configured, in which
+	// case the system roots are used
+	TLSConfig *tls.Config
+	// AnalyzeFields and TranscodeFields, when non-empty, are the only client body fields
+	// forwarded to each service
+	AnalyzeFields   []string
+	TranscodeFields []string
+	// Transcode lists the codecs, containers and quality presets jobs may ask for
+	Transcode TranscodeOptions
+}
+
+// LoadServices reads the downstream service URLs from the environment and
+// validates them, so a misconfiguration is caught at startup rather than on
+// the first proxied request
+func LoadServices() (*Services, error) {
+	analyzeURL, err := parseServiceURL("ANALYZE_VIDEO_URL", getEnv("ANALYZE_VIDEO_URL", "http://localhost:8000"))
+	if err != nil {
+		return nil, err
+	}
+
+	transcodeURL, err := parseServiceURL("TRANSCODE_VIDEO_URL", getEnv("TRANSCODE_VIDEO_URL", "http://localhost:4000"))
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := loadDownstreamTLS()
+	if err != nil {
+		return nil, err
+	}
+
+	transcodeOptions, err := loadTranscodeOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Services{
+		AnalyzeURL:      analyzeURL,
+		TranscodeURL:    transcodeURL,
+		TLSConfig:       tlsConfig,
+		AnalyzeFields:   splitList(getEnv("ANALYZE_FORWARD_FIELDS", "")),
+		TranscodeFields: splitList(getEnv("TRANSCODE_FORWARD_FIELDS", "")),
+		Transcode:       transcodeOptions,
+	}, nil
+}
+
+// splitList parses a comma-separated list, dropping blank entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// loadDownstreamTLS builds the TLS config for downstream calls from DOWNSTREAM_CA_FILE
+// (PEM bundle trusted instead of the system roots) and DOWNSTREAM_CLIENT_CERT_FILE /
+// DOWNSTREAM_CLIENT_KEY_FILE (client certificate for mutual TLS)
+func loadDownstreamTLS() (*tls.Config, error) {
+	caFile := getEnv("DOWNSTREAM_CA_FILE", "")
+	certFile := getEnv("DOWNSTREAM_CLIENT_CERT_FILE", "")
+	keyFile := getEnv("DOWNSTREAM_CLIENT_KEY_FILE", "")
+
+	if caFile == "" && certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading DOWNSTREAM_CA_FILE: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("DOWNSTREAM_CA_FILE %q contains no PEM certificates", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, fmt.Errorf("DOWNSTREAM_CLIENT_CERT_FILE and DOWNSTREAM_CLIENT_KEY_FILE must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading downstream client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// AnalyzeEndpoint returns the full URL for a path on the analysis service
+func (s *Services) AnalyzeEndpoint(path string) string {
+	return joinURL(s.AnalyzeURL, path)
+}
+
+// TranscodeEndpoint returns the full URL for a path on the transcode service
+func (s *Services) TranscodeEndpoint(path string) string {
+	return joinURL(s.TranscodeURL, path)
+}
+
+func parseServiceURL(name, value string) (*url.URL, error) {
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a valid URL: %w", name, err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return nil, fmt.Errorf("%s must use http or https, got %q", name, value)
+	}
+	if parsed.Host == "" {
+		return nil, fmt.Errorf("%s must include a host, got %q", name, value)
+	}
+	return parsed, nil
+}
+
+func joinURL(base *url.URL, path string) string {
+	return strings.TrimSuffix(base.String(), "/") + "/" + strings.TrimPrefix(path, "/")
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
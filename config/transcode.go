@@ -0,0 +1,50 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// TranscodeOptions lists the target values the transcode service accepts. Submissions
+// are validated against these lists and GET /auth/video/transcode/options returns them,
+// so clients and validation never disagree.
+type TranscodeOptions struct {
+	Codecs         []string
+	Containers     []string
+	QualityPresets []string
+	// DefaultQualityPreset is applied to submissions without a preset; empty leaves
+	// the choice to the transcode service
+	DefaultQualityPreset string
+}
+
+// loadTranscodeOptions reads the TRANSCODE_CODECS, TRANSCODE_CONTAINERS and
+// TRANSCODE_QUALITY_PRESETS lists, falling back to what the transcode service
+// supports out of the box, and TRANSCODE_DEFAULT_QUALITY_PRESET ("none" for no
+// default), which must be one of the presets
+func loadTranscodeOptions() (TranscodeOptions, error) {
+	options := TranscodeOptions{
+		Codecs:               lowerList(getEnv("TRANSCODE_CODECS", "h264,h265,hevc,vp8,vp9,av1")),
+		Containers:           lowerList(getEnv("TRANSCODE_CONTAINERS", "mp4,mkv,webm,mov")),
+		QualityPresets:       lowerList(getEnv("TRANSCODE_QUALITY_PRESETS", "low,medium,high")),
+		DefaultQualityPreset: strings.ToLower(strings.TrimSpace(getEnv("TRANSCODE_DEFAULT_QUALITY_PRESET", "medium"))),
+	}
+	if options.DefaultQualityPreset == "none" {
+		options.DefaultQualityPreset = ""
+	}
+	if options.DefaultQualityPreset != "" && !slices.Contains(options.QualityPresets, options.DefaultQualityPreset) {
+		return options, fmt.Errorf("TRANSCODE_DEFAULT_QUALITY_PRESET %q is not in TRANSCODE_QUALITY_PRESETS", options.DefaultQualityPreset)
+	}
+	return options, nil
+}
+
+// lowerList is splitList with entries lowercased and duplicates removed
+func lowerList(value string) []string {
+	var items []string
+	for _, item := range splitList(value) {
+		if item = strings.ToLower(item); !slices.Contains(items, item) {
+			items = append(items, item)
+		}
+	}
+	return items
+}
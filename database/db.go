@@ -5,41 +5,47 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
 )
 
 var DB *gorm.DB
 
+// InitDB opens the database selected by DB_DRIVER ("postgres" by default, or
+// "sqlite" for local development and tests) and migrates the schema.
 func InitDB() {
 	var err error
 
-	dbHost := getEnv("DB_HOST", "localhost")
-	dbPort := getEnv("DB_PORT", "5432")
-	dbUser := getEnv("DB_USER", "postgres")
-	dbPassword := getEnv("DB_PASSWORD", "")
-	dbName := getEnv("DB_NAME", "microservices")
-	sslMode := getEnv("DB_SSLMODE", "disable")
-
-	// PostgreSQL connection string
-	dsn := fmt.Sprintf(
-		"host=%s user=%s password=%s dbname=%s port=%s sslmode=%s",
-		dbHost, dbUser, dbPassword, dbName, dbPort, sslMode,
-	)
+	driver := getEnv("DB_DRIVER", "postgres")
+
+	var dialector gorm.Dialector
+	switch driver {
+	case "postgres":
+		dialector = postgres.Open(postgresDSN())
+	case "sqlite":
+		// Shared cache keeps a single in-memory database across pool connections
+		dialector = sqlite.Open(getEnv("DB_SQLITE_PATH", "file::memory:?cache=shared"))
+	default:
+		log.Fatalf("Unsupported DB_DRIVER %q (expected postgres or sqlite)", driver)
+	}
 
 	// Configure GORM
 	config := &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
-	}
-
-	// For development, you might want to use logger.Silent for production
-	if getEnv("ENV", "development") == "production" {
-		config.Logger = logger.Default.LogMode(logger.Silent)
+		Logger: newLogger(),
+		// Map driver errors such as unique violations to gorm.ErrDuplicatedKey
+		TranslateError: true,
+		// Reuse prepared statements for repeated queries such as the job list. Turn it
+		// off behind poolers that do not support them (e.g. PgBouncer in transaction mode).
+		PrepareStmt: getEnv("DB_PREPARE_STMT", "true") != "false",
 	}
 
-	DB, err = gorm.Open(postgres.Open(dsn), config)
+	DB, err = gorm.Open(dialector, config)
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
@@ -53,22 +59,114 @@ func InitDB() {
 	// Configure connection pool
 	sqlDB.SetMaxIdleConns(10)
 	sqlDB.SetMaxOpenConns(100)
+	if driver == "sqlite" {
+		// SQLite allows a single writer; serialize access instead of failing with SQLITE_BUSY
+		sqlDB.SetMaxOpenConns(1)
+	}
 
 	// Test connection
 	if err = sqlDB.Ping(); err != nil {
 		log.Fatal("Failed to ping database:", err)
 	}
 
-	log.Println("Connected to PostgreSQL successfully")
+	log.Printf("Connected to %s successfully", driver)
+
+	migrateModels := []interface{}{&models.User{}, &models.TranscodingJob{}, &models.VideoAnalysis{}, &models.IdempotencyKey{}, &models.OAuthIdentity{}, &models.InviteCode{}, &models.Organization{}, &models.ShareLink{}, &models.AuditLog{}, &models.OrgInvite{}}
+
+	if driver == "sqlite" {
+		if err := adaptSchemaForSQLite(DB, migrateModels...); err != nil {
+			log.Fatal("Failed to prepare schema for SQLite:", err)
+		}
+	}
 
 	// Auto-migrate the schema
-	if err := DB.AutoMigrate(&models.User{}, &models.TranscodingJob{}, &models.VideoAnalysis{}); err != nil {
+	if err := DB.AutoMigrate(migrateModels...); err != nil {
 		log.Fatal("Failed to auto-migrate:", err)
 	}
 
 	log.Println("Database migration completed successfully")
 }
 
+// postgresDSN builds the PostgreSQL connection string from the DB_* variables
+func postgresDSN() string {
+	dbHost := getEnv("DB_HOST", "localhost")
+	dbPort := getEnv("DB_PORT", "5432")
+	dbUser := getEnv("DB_USER", "postgres")
+	dbPassword := getEnv("DB_PASSWORD", "")
+	dbName := getEnv("DB_NAME", "microservices")
+	sslMode := getEnv("DB_SSLMODE", "disable")
+
+	return fmt.Sprintf(
+		"host=%s user=%s password=%s dbname=%s port=%s sslmode=%s",
+		dbHost, dbUser, dbPassword, dbName, dbPort, sslMode,
+	)
+}
+
+// adaptSchemaForSQLite adjusts the cached schemas of the given models so they can be
+// migrated and queried on SQLite:
+//   - column defaults that call database functions, such as Postgres' uuid_generate_v4(),
+//     are dropped; the models fill those columns in their BeforeCreate hooks
+//   - sized timestamp types like timestamp(0) become datetime, which the SQLite driver
+//     recognises when scanning values back into time.Time
+func adaptSchemaForSQLite(db *gorm.DB, models ...interface{}) error {
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return err
+		}
+
+		for _, field := range stmt.Schema.Fields {
+			if strings.HasPrefix(strings.ToLower(string(field.DataType)), "timestamp(") {
+				field.DataType = schema.Time
+				delete(field.TagSettings, "TYPE")
+			}
+		}
+
+		fieldsWithDBDefault := stmt.Schema.FieldsWithDefaultDBValue[:0]
+		for _, field := range stmt.Schema.FieldsWithDefaultDBValue {
+			if strings.Contains(field.DefaultValue, "(") {
+				field.HasDefaultValue = false
+				field.DefaultValue = ""
+				continue
+			}
+			fieldsWithDBDefault = append(fieldsWithDBDefault, field)
+		}
+		stmt.Schema.FieldsWithDefaultDBValue = fieldsWithDBDefault
+	}
+	return nil
+}
+
+// newLogger logs every query in development. In production only errors and queries
+// slower than DB_SLOW_QUERY_THRESHOLD are logged, at warn level, with bind values
+// left out of the SQL so user data stays out of the logs.
+func newLogger() logger.Interface {
+	threshold := defaultSlowQueryThreshold
+	if value := getEnv("DB_SLOW_QUERY_THRESHOLD", ""); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil && parsed > 0 {
+			threshold = parsed
+		} else {
+			log.Printf("Invalid duration for DB_SLOW_QUERY_THRESHOLD: %q, using default %s", value, threshold)
+		}
+	}
+
+	production := getEnv("ENV", "development") == "production"
+	level := logger.Info
+	if production {
+		level = logger.Warn
+	}
+
+	return logger.New(log.New(os.Stdout, "\r\n", log.LstdFlags), logger.Config{
+		SlowThreshold:             threshold,
+		LogLevel:                  level,
+		IgnoreRecordNotFoundError: true,
+		ParameterizedQueries:      production,
+		Colorful:                  !production,
+	})
+}
+
+// defaultSlowQueryThreshold is used when DB_SLOW_QUERY_THRESHOLD is unset
+const defaultSlowQueryThreshold = 200 * time.Millisecond
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -0,0 +1,428 @@
+package handlers
+
+import (
+	"auth-service/audit"
+	"auth-service/middleware"
+	"auth-service/models"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// ListUsers returns a page of user accounts (admin only). Supported filters:
+// ?email= (case-insensitive substring), ?verified=true|false, ?created_after= (RFC 3339
+// or YYYY-MM-DD) and ?include_deleted=true for soft-deleted accounts.
+func (h *Handler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	page, pageSize, err := parsePagination(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_pagination", err.Error())
+		return
+	}
+
+	query := h.DB.Model(&models.User{})
+	if r.URL.Query().Get("include_deleted") == "true" {
+		query = query.Unscoped()
+	}
+
+	if email := strings.TrimSpace(r.URL.Query().Get("email")); email != "" {
+		pattern := "%" + escapeLikePattern(strings.ToLower(email)) + "%"
+		query = query.Where(`LOWER(email) LIKE ? ESCAPE '\'`, pattern)
+	}
+
+	if value := r.URL.Query().Get("created_after"); value != "" {
+		createdAfter, err := parseDateParam(value)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid_created_after", "created_after must be an RFC 3339 timestamp or a YYYY-MM-DD date")
+			return
+		}
+		query = query.Where("created_at > ?", createdAfter)
+	}
+
+	if value := r.URL.Query().Get("verified"); value != "" {
+		verified, err := strconv.ParseBool(value)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid_verified", "verified must be true or false")
+			return
+		}
+		if verified {
+			query = query.Where("email_verified_at IS NOT NULL")
+		} else {
+			query = query.Where("email_verified_at IS NULL")
+		}
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		log.Printf("Error counting users: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+
+	users := []models.User{}
+	if err := query.Order("id ASC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&users).Error; err != nil {
+		log.Printf("Error listing users: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+
+	setPaginationHeaders(w, r, page, pageSize, total)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newPageResponse(users, total, page, pageSize))
+}
+
+// GetUser returns a single account, including soft-deleted ones (admin only)
+func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
+	targetID, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_id", "Invalid user ID")
+		return
+	}
+
+	var user models.User
+	result := h.DB.Unscoped().First(&user, uint(targetID))
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			writeJSONError(w, http.StatusNotFound, "user_not_found", "User not found")
+			return
+		}
+		log.Printf("Database error: %v", result.Error)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// parseDateParam accepts either a full RFC 3339 timestamp or a plain date
+func parseDateParam(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// RestoreUser clears DeletedAt on a soft-deleted account (admin only)
+func (h *Handler) RestoreUser(w http.ResponseWriter, r *http.Request) {
+	targetID, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_id", "Invalid user ID")
+		return
+	}
+
+	var user models.User
+	result := h.DB.Unscoped().First(&user, uint(targetID))
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			writeJSONError(w, http.StatusNotFound, "user_not_found", "User not found")
+			return
+		}
+		log.Printf("Database error: %v", result.Error)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+
+	if !user.DeletedAt.Valid {
+		writeJSONError(w, http.StatusConflict, "user_not_deleted", "User is not deleted")
+		return
+	}
+
+	if result := h.DB.Unscoped().Model(&user).Update("deleted_at", nil); result.Error != nil {
+		log.Printf("Failed to restore user %d: %v", user.ID, result.Error)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to restore user")
+		return
+	}
+	user.DeletedAt = gorm.DeletedAt{}
+
+	log.Printf("Restored account for user %d (request from %s)", user.ID, middleware.ClientIP(r))
+	audit.Record(r, audit.ForUser(audit.ActionUserRestored, user.ID))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// SuspendUser blocks an account from logging in or using its tokens (admin only).
+// The optional JSON body may give a reason and ask to revoke all existing tokens:
+// {"reason": "...", "revoke_tokens": true}
+func (h *Handler) SuspendUser(w http.ResponseWriter, r *http.Request) {
+	targetID, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_id", "Invalid user ID")
+		return
+	}
+
+	var req struct {
+		Reason       string `json:"reason"`
+		RevokeTokens bool   `json:"revoke_tokens"`
+	}
+	limitBody(w, r)
+	if err := decodeJSON(r, &req); err != nil && !errors.Is(err, io.EOF) {
+		writeBodyError(w, err, "Invalid JSON")
+		return
+	}
+
+	if adminID, ok := middleware.UserIDFromContext(r.Context()); ok && adminID == uint(targetID) {
+		writeJSONError(w, http.StatusBadRequest, "cannot_suspend_self", "Admins cannot suspend their own account")
+		return
+	}
+
+	var user models.User
+	result := h.DB.First(&user, uint(targetID))
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			writeJSONError(w, http.StatusNotFound, "user_not_found", "User not found")
+			return
+		}
+		log.Printf("Database error: %v", result.Error)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+
+	user.Status = models.UserStatusSuspended
+	user.SuspendedReason = nil
+	if reason := strings.TrimSpace(req.Reason); reason != "" {
+		user.SuspendedReason = &reason
+	}
+	if req.RevokeTokens {
+		now := time.Now()
+		user.TokensRevokedAt = &now
+	}
+
+	if result := h.DB.Save(&user); result.Error != nil {
+		log.Printf("Failed to suspend user %d: %v", user.ID, result.Error)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to suspend user")
+		return
+	}
+
+	log.Printf("Suspended user %d (revoke_tokens=%t, request from %s)", user.ID, req.RevokeTokens, middleware.ClientIP(r))
+	suspended := audit.ForUser(audit.ActionUserSuspended, user.ID)
+	if user.SuspendedReason != nil {
+		suspended = suspended.With("reason", *user.SuspendedReason)
+	}
+	audit.Record(r, suspended)
+	if req.RevokeTokens {
+		audit.Record(r, audit.ForUser(audit.ActionTokensRevoked, user.ID).With("reason", "suspended"))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// UnsuspendUser reactivates a suspended account (admin only). Tokens revoked by the
+// suspension stay revoked; the user has to log in again.
+func (h *Handler) UnsuspendUser(w http.ResponseWriter, r *http.Request) {
+	targetID, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_id", "Invalid user ID")
+		return
+	}
+
+	var user models.User
+	result := h.DB.First(&user, uint(targetID))
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			writeJSONError(w, http.StatusNotFound, "user_not_found", "User not found")
+			return
+		}
+		log.Printf("Database error: %v", result.Error)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+
+	if !user.IsSuspended() {
+		writeJSONError(w, http.StatusConflict, "user_not_suspended", "User is not suspended")
+		return
+	}
+
+	user.Status = models.UserStatusActive
+	user.SuspendedReason = nil
+	if result := h.DB.Save(&user); result.Error != nil {
+		log.Printf("Failed to unsuspend user %d: %v", user.ID, result.Error)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to unsuspend user")
+		return
+	}
+
+	log.Printf("Unsuspended user %d (request from %s)", user.ID, middleware.ClientIP(r))
+	audit.Record(r, audit.ForUser(audit.ActionUserUnsuspended, user.ID))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// RequirePasswordChange makes a user change their password before their tokens work
+// for anything else (admin only). The flag is cleared by POST /auth/password.
+func (h *Handler) RequirePasswordChange(w http.ResponseWriter, r *http.Request) {
+	targetID, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_id", "Invalid user ID")
+		return
+	}
+
+	var user models.User
+	result := h.DB.First(&user, uint(targetID))
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			writeJSONError(w, http.StatusNotFound, "user_not_found", "User not found")
+			return
+		}
+		log.Printf("Database error: %v", result.Error)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+
+	if result := h.DB.Model(&user).Update("must_change_password", true); result.Error != nil {
+		log.Printf("Failed to require password change for user %d: %v", user.ID, result.Error)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to update user")
+		return
+	}
+
+	log.Printf("Password change required for user %d (request from %s)", user.ID, middleware.ClientIP(r))
+	audit.Record(r, audit.ForUser(audit.ActionPasswordChangeRequired, user.ID))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// jobsDB returns the handle used for job list/info queries. Soft-deleted jobs are
+// excluded by GORM unless an admin asks for them with ?include_deleted=true.
+func (h *Handler) jobsDB(r *http.Request) (*gorm.DB, error) {
+	if r.URL.Query().Get("include_deleted") != "true" {
+		return h.DB, nil
+	}
+
+	role, _ := middleware.RoleFromContext(r.Context())
+	if role != models.RoleAdmin {
+		return nil, errors.New("include_deleted requires the admin role")
+	}
+	return h.DB.Unscoped(), nil
+}
+
+// adminJob is a transcoding job in the admin job list, with its owner's email
+type adminJob struct {
+	models.TranscodingJob
+	OwnerEmail *string `json:"owner_email"`
+}
+
+// ListAdminJobs returns a page of transcoding jobs across all users, newest first
+// (admin only). Supported filters: ?status=, ?gpu= (exact GPU name), ?user_id=,
+// ?since= / ?until= on inserted_at (RFC 3339 or YYYY-MM-DD) and ?include_deleted=true.
+// The status and inserted_at filters and the ordering match the job table's indexes.
+func (h *Handler) ListAdminJobs(w http.ResponseWriter, r *http.Request) {
+	page, pageSize, err := parsePagination(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_pagination", err.Error())
+		return
+	}
+
+	db, err := h.jobsDB(r)
+	if err != nil {
+		writeJSONError(w, http.StatusForbidden, "forbidden", err.Error())
+		return
+	}
+
+	params := r.URL.Query()
+	// Columns are qualified because users also has status and deleted_at columns
+	query := db.Model(&models.TranscodingJob{})
+
+	if status := models.TranscodingJobStatus(params.Get("status")); status != "" {
+		if !status.IsValid() {
+			writeJSONError(w, http.StatusBadRequest, "invalid_status", "Invalid status filter")
+			return
+		}
+		query = query.Where("transcoding_jobs.status = ?", status)
+	}
+	if gpu := strings.TrimSpace(params.Get("gpu")); gpu != "" {
+		query = query.Where("transcoding_jobs.gpu_used = ?", gpu)
+	}
+	if value := params.Get("user_id"); value != "" {
+		ownerID, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid_user_id", "user_id must be a user ID")
+			return
+		}
+		query = query.Where("transcoding_jobs.created_by = ?", ownerID)
+	}
+	for _, bound := range []struct{ param, condition string }{
+		{"since", "transcoding_jobs.inserted_at >= ?"},
+		{"until", "transcoding_jobs.inserted_at < ?"},
+	} {
+		value := params.Get(bound.param)
+		if value == "" {
+			continue
+		}
+		t, err := parseDateParam(value)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid_"+bound.param, bound.param+" must be an RFC 3339 timestamp or a YYYY-MM-DD date")
+			return
+		}
+		query = query.Where(bound.condition, t)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		log.Printf("Error counting transcoding jobs for admin list: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error retrieving transcoding jobs")
+		return
+	}
+
+	// Jobs whose owner is gone are still listed, without an email
+	jobs := []adminJob{}
+	if err := query.
+		Select("transcoding_jobs.*, users.email AS owner_email").
+		Joins("LEFT JOIN users ON users.id = transcoding_jobs.created_by").
+		Order("transcoding_jobs.inserted_at DESC, transcoding_jobs.id DESC").
+		Offset((page - 1) * pageSize).Limit(pageSize).
+		Scan(&jobs).Error; err != nil {
+		log.Printf("Error retrieving transcoding jobs for admin list: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error retrieving transcoding jobs")
+		return
+	}
+
+	setPaginationHeaders(w, r, page, pageSize, total)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newPageResponse(jobs, total, page, pageSize))
+}
+
+// maintenanceResponse reports whether maintenance mode is on for this instance
+type maintenanceResponse struct {
+	Enabled bool `json:"enabled"`
+}
+
+// GetMaintenance reports the maintenance mode state (admin only)
+func (h *Handler) GetMaintenance(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(maintenanceResponse{Enabled: middleware.MaintenanceEnabled()})
+}
+
+// SetMaintenance turns maintenance mode on or off for this instance (admin only).
+// Body: {"enabled": true}
+func (h *Handler) SetMaintenance(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Enabled *bool `json:"enabled"`
+	}
+	limitBody(w, r)
+	if err := decodeJSON(r, &req); err != nil {
+		writeBodyError(w, err, "Invalid JSON")
+		return
+	}
+	if req.Enabled == nil {
+		writeJSONError(w, http.StatusBadRequest, "validation_failed", "enabled is required")
+		return
+	}
+
+	middleware.SetMaintenance(*req.Enabled)
+	adminID, _ := middleware.UserIDFromContext(r.Context())
+	log.Printf("Maintenance mode set to %t by user %d from %s", *req.Enabled, adminID, middleware.ClientIP(r))
+	audit.Record(r, audit.Event{Action: audit.ActionMaintenanceChanged}.With("enabled", *req.Enabled))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(maintenanceResponse{Enabled: *req.Enabled})
+}
@@ -1,36 +1,121 @@
 package handlers
 
 import (
-	"auth-service/database"
+	"auth-service/middleware"
 	"auth-service/models"
 	"bytes"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
+// newDownstreamClient builds the client shared by the proxy handlers. Its transport
+// starts a client span for every outbound call and injects W3C trace-context headers.
+// A nil tlsConfig keeps the default transport's TLS settings (system roots).
+func newDownstreamClient(tlsConfig *tls.Config) *http.Client {
+	var transport http.RoundTripper = http.DefaultTransport
+	if tlsConfig != nil {
+		custom := http.DefaultTransport.(*http.Transport).Clone()
+		custom.TLSClientConfig = tlsConfig
+		transport = custom
+	}
+	return &http.Client{Transport: otelhttp.NewTransport(transport)}
+}
+
+// Names of the downstream services, used as the service metric label
+const (
+	serviceAnalyze   = "analyze"
+	serviceTranscode = "transcode"
+)
+
+// defaultDownstreamClient is used by Handlers built without a Downstream client
+var defaultDownstreamClient = newDownstreamClient(nil)
+
+// doDownstream sends req with the shared client and records how long the service took
+// to answer, in the metrics and for the slow-request log. Transport failures are
+// recorded with status_code "error".
+func (h *Handler) doDownstream(service string, req *http.Request) (*http.Response, error) {
+	client := h.Downstream
+	if client == nil {
+		client = defaultDownstreamClient
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+
+	statusCode := "error"
+	if err == nil {
+		statusCode = strconv.Itoa(resp.StatusCode)
+	}
+	elapsed := time.Since(start)
+	downstreamDuration.WithLabelValues(service, statusCode).Observe(elapsed.Seconds())
+	middleware.RecordDownstream(req.Context(), service, elapsed)
+
+	return resp, err
+}
+
+// maxDownstreamErrorBytes bounds how much of a failed downstream response is read
+const maxDownstreamErrorBytes = 4096
+
+// writeDownstreamError answers a non-2xx downstream response with the standard JSON
+// error envelope and the same status code, so clients never see a raw HTML error page
+func writeDownstreamError(w http.ResponseWriter, service string, statusCode int, body []byte) {
+	writeJSONError(w, statusCode, "downstream_error", downstreamErrorMessage(service, statusCode, body))
+}
+
+// downstreamErrorMessage logs a failed downstream response and returns a client-safe
+// message for it: a string detail/message/error field from a JSON body, or the status text
+func downstreamErrorMessage(service string, statusCode int, body []byte) string {
+	if len(body) > maxDownstreamErrorBytes {
+		body = body[:maxDownstreamErrorBytes]
+	}
+	log.Printf("%s service returned %d: %s", service, statusCode, strings.TrimSpace(string(body)))
+
+	var payload map[string]interface{}
+	if json.Unmarshal(body, &payload) == nil {
+		for _, key := range []string{"detail", "message", "error"} {
+			if value, ok := payload[key].(string); ok && value != "" {
+				return value
+			}
+		}
+	}
+	return fmt.Sprintf("Video service returned %d %s", statusCode, http.StatusText(statusCode))
+}
+
+// isSuccess reports whether a downstream status code is 2xx
+func isSuccess(statusCode int) bool {
+	return statusCode >= 200 && statusCode < 300
+}
+
 // AnalyzeVideoProxy redirects requests to the AnalyzeVideo handler at http://localhost:8000/video/analyze
 // and adds the user ID to the request body
-func AnalyzeVideoProxy(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) AnalyzeVideoProxy(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context (set by auth middleware)
-	userID, ok := r.Context().Value("user_id").(float64)
+	userID, ok := middleware.UserIDFromContext(r.Context())
 	if !ok {
-		http.Error(w, "Invalid user context", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "invalid_user_context", "Invalid user context")
 		return
 	}
 
 	// Read the original request body
 	var originalBody map[string]interface{}
 	if r.Body != nil {
+		limitBody(w, r)
 		bodyBytes, err := io.ReadAll(r.Body)
 		if err != nil {
 			log.Printf("Error reading request body: %v", err)
-			http.Error(w, "Error reading request body", http.StatusBadRequest)
+			writeBodyError(w, err, "Error reading request body")
 			return
 		}
 		r.Body.Close()
@@ -39,7 +124,7 @@ func AnalyzeVideoProxy(w http.ResponseWriter, r *http.Request) {
 		if len(bodyBytes) > 0 {
 			if err := json.Unmarshal(bodyBytes, &originalBody); err != nil {
 				log.Printf("Error parsing JSON body: %v", err)
-				http.Error(w, "Invalid JSON in request body", http.StatusBadRequest)
+				writeJSONError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON in request body")
 				return
 			}
 		} else {
@@ -49,25 +134,26 @@ func AnalyzeVideoProxy(w http.ResponseWriter, r *http.Request) {
 		originalBody = make(map[string]interface{})
 	}
 
-	// Add user ID to the request body
-	originalBody["user"] = uint(userID)
+	// Add user and organization IDs to the request body, replacing anything the client sent
+	sanitizeForwardBody(originalBody, h.Services.AnalyzeFields)
+	originalBody["user"] = userID
+	setForwardOrg(r, originalBody)
 
 	// Marshal the modified body
 	modifiedBodyBytes, err := json.Marshal(originalBody)
 	if err != nil {
 		log.Printf("Error marshaling modified body: %v", err)
-		http.Error(w, "Error preparing request", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error preparing request")
 		return
 	}
 
 	// Create a new request to the video analysis service
-	var analyzeLink = []byte(getEnv("ANALYZE_VIDEO_URL", "http://localhost:8000"))
-	analyzeURL := fmt.Sprintf("%s/analyze-video", analyzeLink)
-	req, err := http.NewRequest(r.Method, analyzeURL, bytes.NewBuffer(modifiedBodyBytes))
+	analyzeURL := h.Services.AnalyzeEndpoint("/analyze-video")
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, analyzeURL, bytes.NewBuffer(modifiedBodyBytes))
 
 	if err != nil {
 		log.Printf("Error creating request: %v", err)
-		http.Error(w, "Error creating request to video service", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error creating request to video service")
 		return
 	}
 
@@ -84,16 +170,24 @@ func AnalyzeVideoProxy(w http.ResponseWriter, r *http.Request) {
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Content-Length", fmt.Sprintf("%d", len(modifiedBodyBytes)))
 
+	debugf("Forwarding request to %s: headers=%v body=%s", analyzeURL, redactHeaders(req.Header), redactJSON(modifiedBodyBytes))
+
 	// Make the request to the video analysis service
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := h.doDownstream(serviceAnalyze, req)
 	if err != nil {
 		log.Printf("Error making request to video service: %v", err)
-		http.Error(w, "Error connecting to video service", http.StatusBadGateway)
+		writeJSONError(w, http.StatusBadGateway, "downstream_unavailable", "Error connecting to video service")
 		return
 	}
 	defer resp.Body.Close()
 
+	if !isSuccess(resp.StatusCode) {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxDownstreamErrorBytes))
+		writeDownstreamError(w, serviceAnalyze, resp.StatusCode, body)
+		return
+	}
+	invalidateProfileStats(&userID)
+
 	// Copy response headers
 	for name, values := range resp.Header {
 		for _, value := range values {
@@ -110,25 +204,52 @@ func AnalyzeVideoProxy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("Successfully proxied video analysis request for user %d", uint(userID))
+	log.Printf("Successfully proxied video analysis request for user %d", userID)
 }
 
 // GetVideoAnalyses gets all video analysis jobs for the authenticated user
-func GetVideoAnalyses(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetVideoAnalyses(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context (set by auth middleware)
-	userID, ok := r.Context().Value("user_id").(float64)
+	userID, ok := middleware.UserIDFromContext(r.Context())
 	if !ok {
-		http.Error(w, "Invalid user context", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "invalid_user_context", "Invalid user context")
 		return
 	}
 
-	// Get video analysis jobs from the database filtered by user ID
-	var videoAnalyses []models.VideoAnalysis
-	result := database.DB.Where("created_by = ?", uint(userID)).Order("created_at DESC").Find(&videoAnalyses)
+	db, err := h.jobsDB(r)
+	if err != nil {
+		writeJSONError(w, http.StatusForbidden, "admin_required", err.Error())
+		return
+	}
+
+	page, pageSize, paginate, err := parseListPagination(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_pagination", err.Error())
+		return
+	}
+
+	// Get the user's video analysis jobs, or their organization's when their org role allows
+	query := jobScopeFor(r, userID).apply(db.Model(&models.VideoAnalysis{}))
 
-	if result.Error != nil {
-		log.Printf("Error retrieving video analyses for user %d: %v", uint(userID), result.Error)
-		http.Error(w, "Error retrieving video analyses", http.StatusInternalServerError)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		log.Printf("Error counting video analyses for user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error retrieving video analyses")
+		return
+	}
+
+	query = query.Order("created_at DESC")
+	if paginate {
+		query = query.Offset((page - 1) * pageSize).Limit(pageSize)
+		setPaginationHeaders(w, r, page, pageSize, total)
+	} else {
+		w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+	}
+
+	videoAnalyses := []models.VideoAnalysis{}
+	if result := query.Find(&videoAnalyses); result.Error != nil {
+		log.Printf("Error retrieving video analyses for user %d: %v", userID, result.Error)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error retrieving video analyses")
 		return
 	}
 
@@ -136,21 +257,21 @@ func GetVideoAnalyses(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	// Return the video analyses as JSON
-	if err := json.NewEncoder(w).Encode(videoAnalyses); err != nil {
+	if err := json.NewEncoder(w).Encode(listBody(videoAnalyses, total, page, pageSize, paginate)); err != nil {
 		log.Printf("Error encoding video analyses response: %v", err)
-		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error encoding response")
 		return
 	}
 
-	log.Printf("Successfully retrieved %d video analyses for user %d", len(videoAnalyses), uint(userID))
+	log.Printf("Successfully retrieved %d video analyses for user %d", len(videoAnalyses), userID)
 }
 
 // GetVideoAnalysesInfo gets information about a specific video analysis job by ID
-func GetVideoAnalysesInfo(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetVideoAnalysesInfo(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context (set by auth middleware)
-	userID, ok := r.Context().Value("user_id").(float64)
+	userID, ok := middleware.UserIDFromContext(r.Context())
 	if !ok {
-		http.Error(w, "Invalid user context", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "invalid_user_context", "Invalid user context")
 		return
 	}
 
@@ -160,33 +281,165 @@ func GetVideoAnalysesInfo(w http.ResponseWriter, r *http.Request) {
 
 	// Validate UUID format
 	if _, err := uuid.Parse(jobID); err != nil {
-		http.Error(w, "Invalid job ID format", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, "invalid_id", "Invalid job ID format")
+		return
+	}
+
+	db, err := h.jobsDB(r)
+	if err != nil {
+		writeJSONError(w, http.StatusForbidden, "admin_required", err.Error())
 		return
 	}
 
 	// Get video analysis job from database
 	var videoAnalysis models.VideoAnalysis
-	result := database.DB.Where("job_id = ? AND created_by = ?", jobID, uint(userID)).First(&videoAnalysis)
-
-	if result.Error != nil {
-		if result.Error.Error() == "record not found" {
-			http.Error(w, "Video analysis not found or access denied", http.StatusNotFound)
+	if err := fetchVisible(db, "job_id", jobID, jobScopeFor(r, userID), &videoAnalysis); err != nil {
+		if errors.Is(err, errNotOwned) {
+			writeJSONError(w, http.StatusNotFound, "analysis_not_found", "Video analysis not found or access denied")
 			return
 		}
-		log.Printf("Error retrieving video analysis %s for user %d: %v", jobID, uint(userID), result.Error)
-		http.Error(w, "Error retrieving video analysis information", http.StatusInternalServerError)
+		log.Printf("Error retrieving video analysis %s for user %d: %v", jobID, userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error retrieving video analysis information")
 		return
 	}
 
-	// Set response header
-	w.Header().Set("Content-Type", "application/json")
-
-	// Return the video analysis as JSON
-	if err := json.NewEncoder(w).Encode(videoAnalysis); err != nil {
+	// Return the video analysis as JSON, or 304 if the client's copy is current
+	if err := writeJSONWithETag(w, r, videoAnalysis); err != nil {
 		log.Printf("Error encoding video analysis response: %v", err)
-		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error encoding response")
+		return
+	}
+
+	log.Printf("Successfully retrieved video analysis %s for user %d", jobID, userID)
+}
+
+// DeleteVideoAnalysis soft-deletes one of the user's video analysis jobs. The row is
+// kept (with DeletedAt set) and can still be listed by admins with ?include_deleted=true.
+func (h *Handler) DeleteVideoAnalysis(w http.ResponseWriter, r *http.Request) {
+	videoAnalysis, userID, ok := h.ownedAnalysis(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.DB.Delete(videoAnalysis).Error; err != nil {
+		log.Printf("Error deleting video analysis %s for user %d: %v", videoAnalysis.JobID, userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error deleting video analysis")
+		return
+	}
+
+	invalidateProfileStats(videoAnalysis.CreatedBy)
+	log.Printf("Soft-deleted video analysis %s for user %d", videoAnalysis.JobID, userID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RerunVideoAnalysis resubmits a completed or failed analysis to the analysis service
+// with its original video_id and s3_url. The service creates a new job; the original
+// is left untouched.
+func (h *Handler) RerunVideoAnalysis(w http.ResponseWriter, r *http.Request) {
+	videoAnalysis, userID, ok := h.ownedAnalysis(w, r)
+	if !ok {
+		return
+	}
+
+	if !videoAnalysis.Status.IsTerminal() {
+		writeJSONError(w, http.StatusConflict, "job_not_rerunnable",
+			fmt.Sprintf("Only completed or failed analyses can be re-run (job is %s)", videoAnalysis.Status))
 		return
 	}
 
-	log.Printf("Successfully retrieved video analysis %s for user %d", jobID, uint(userID))
+	spec := map[string]interface{}{
+		"video_id": videoAnalysis.VideoID,
+		"s3_url":   videoAnalysis.S3URL,
+		"user":     userID,
+	}
+	setForwardOrg(r, spec)
+
+	statusCode, body, err := h.forwardAnalyzeJob(r, spec)
+	if err != nil {
+		log.Printf("Error making request to video service: %v", err)
+		writeJSONError(w, http.StatusBadGateway, "downstream_unavailable", "Error connecting to video service")
+		return
+	}
+
+	if !isSuccess(statusCode) {
+		writeDownstreamError(w, serviceAnalyze, statusCode, body)
+		return
+	}
+	invalidateProfileStats(&userID)
+
+	log.Printf("Re-ran video analysis %s for user %d", videoAnalysis.JobID, userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(body)
+}
+
+// ownedAnalysis loads the caller's video analysis named in the URL. On failure it
+// writes the error response and returns ok=false.
+func (h *Handler) ownedAnalysis(w http.ResponseWriter, r *http.Request) (analysis *models.VideoAnalysis, userID uint, ok bool) {
+	// Get user ID from context (set by auth middleware)
+	userID, ok = middleware.UserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, "invalid_user_context", "Invalid user context")
+		return nil, 0, false
+	}
+
+	jobID := mux.Vars(r)["id"]
+	if _, err := uuid.Parse(jobID); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_id", "Invalid job ID format")
+		return nil, 0, false
+	}
+
+	var videoAnalysis models.VideoAnalysis
+	if err := fetchOwned(h.DB, "job_id", jobID, userID, &videoAnalysis); err != nil {
+		if errors.Is(err, errNotOwned) {
+			writeJSONError(w, http.StatusNotFound, "analysis_not_found", "Video analysis not found or access denied")
+			return nil, 0, false
+		}
+		log.Printf("Error retrieving video analysis %s for user %d: %v", jobID, userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error retrieving video analysis information")
+		return nil, 0, false
+	}
+
+	return &videoAnalysis, userID, true
+}
+
+// forwardAnalyzeJob posts one analysis job to the analysis service and returns its
+// status code and body
+func (h *Handler) forwardAnalyzeJob(r *http.Request, spec map[string]interface{}) (int, []byte, error) {
+	bodyBytes, err := json.Marshal(spec)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	analyzeURL := h.Services.AnalyzeEndpoint("/analyze-video")
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, analyzeURL, bytes.NewBuffer(bodyBytes))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// Copy headers from the original request (except Authorization)
+	for name, values := range r.Header {
+		if name != "Authorization" && name != "Content-Length" {
+			for _, value := range values {
+				req.Header.Add(name, value)
+			}
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	debugf("Forwarding analysis re-run to %s: body=%s", analyzeURL, redactJSON(bodyBytes))
+
+	resp, err := h.doDownstream(serviceAnalyze, req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return resp.StatusCode, respBody, nil
 }
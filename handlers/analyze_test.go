@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"auth-service/middleware"
+	"auth-service/models"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+func TestGetVideoAnalysesInfoNotFound(t *testing.T) {
+	h := newTestHandler(t)
+	alice := createUser(t, h, "alice@example.com", "correct horse battery", models.RoleUser)
+	bob := createUser(t, h, "bob@example.com", "correct horse battery", models.RoleUser)
+
+	create := func(userID uint) models.VideoAnalysis {
+		analysis := models.VideoAnalysis{VideoID: "clip.mp4", Status: models.AnalysisStatusCompleted, CreatedBy: &userID}
+		if err := h.DB.Create(&analysis).Error; err != nil {
+			t.Fatalf("create analysis: %v", err)
+		}
+		return analysis
+	}
+	own, others := create(alice.ID), create(bob.ID)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/auth/video/analyze/{id}", middleware.AuthMiddleware(h.GetVideoAnalysesInfo))
+	token := tokenFor(t, h, alice)
+
+	for _, id := range []string{uuid.NewString(), others.JobID} {
+		rec := serve(t, router.ServeHTTP, http.MethodGet, "/auth/video/analyze/"+id, nil, token)
+		if rec.Code != http.StatusNotFound || errorCode(t, rec) != "analysis_not_found" {
+			t.Errorf("analysis %s: got %d %s, want 404 analysis_not_found", id, rec.Code, rec.Body.String())
+		}
+	}
+
+	if rec := serve(t, router.ServeHTTP, http.MethodGet, "/auth/video/analyze/"+own.JobID, nil, token); rec.Code != http.StatusOK {
+		t.Errorf("own analysis: got %d %s, want 200", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"auth-service/models"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ListAuditLogs returns a page of audit entries, newest first (admin only). Supported
+// filters: ?actor_id=, ?action= (exact, or a prefix ending in "." such as "login."),
+// ?target_type= with ?target_id=, ?ip=, and ?since= / ?until= (RFC 3339 or YYYY-MM-DD).
+func (h *Handler) ListAuditLogs(w http.ResponseWriter, r *http.Request) {
+	page, pageSize, err := parsePagination(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_pagination", err.Error())
+		return
+	}
+
+	params := r.URL.Query()
+	query := h.DB.Model(&models.AuditLog{})
+
+	if value := params.Get("actor_id"); value != "" {
+		actorID, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid_actor_id", "actor_id must be a user ID")
+			return
+		}
+		query = query.Where("actor_id = ?", actorID)
+	}
+
+	if action := strings.TrimSpace(params.Get("action")); action != "" {
+		if strings.HasSuffix(action, ".") {
+			query = query.Where(`action LIKE ? ESCAPE '\'`, escapeLikePattern(action)+"%")
+		} else {
+			query = query.Where("action = ?", action)
+		}
+	}
+
+	if value := params.Get("target_type"); value != "" {
+		query = query.Where("target_type = ?", value)
+	}
+	if value := params.Get("target_id"); value != "" {
+		query = query.Where("target_id = ?", value)
+	}
+	if value := params.Get("ip"); value != "" {
+		query = query.Where("ip = ?", value)
+	}
+
+	for _, bound := range []struct{ param, condition string }{
+		{"since", "created_at >= ?"},
+		{"until", "created_at < ?"},
+	} {
+		value := params.Get(bound.param)
+		if value == "" {
+			continue
+		}
+		t, err := parseDateParam(value)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid_"+bound.param, bound.param+" must be an RFC 3339 timestamp or a YYYY-MM-DD date")
+			return
+		}
+		query = query.Where(bound.condition, t)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		log.Printf("Error counting audit logs: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+
+	entries := []models.AuditLog{}
+	if err := query.Order("created_at DESC, id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&entries).Error; err != nil {
+		log.Printf("Error listing audit logs: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+
+	setPaginationHeaders(w, r, page, pageSize, total)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newPageResponse(entries, total, page, pageSize))
+}
@@ -1,86 +1,146 @@
 package handlers
 
 import (
-	"auth-service/database"
+	"auth-service/audit"
+	"auth-service/middleware"
 	"auth-service/models"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
-var jwtSecret = []byte(getEnv("JWT_SECRET", "your-secret-key"))
+// Per-IP login and register limiters, created on first use from the *_RATE_LIMIT
+// settings. They are much tighter than anything an authenticated client needs, to slow
+// credential stuffing and signup abuse.
+var (
+	authLimitersOnce sync.Once
+	loginLimiter     *middleware.RateLimiter
+	registerLimiter  *middleware.RateLimiter
+)
+
+func authLimiters() (login, register *middleware.RateLimiter) {
+	authLimitersOnce.Do(func() {
+		window := getEnvDuration("AUTH_RATE_LIMIT_WINDOW", time.Minute)
+		loginLimiter = middleware.NewRateLimiter(getEnvInt("LOGIN_RATE_LIMIT", 10), window)
+		registerLimiter = middleware.NewRateLimiter(getEnvInt("REGISTER_RATE_LIMIT", 5), window)
+	})
+	return loginLimiter, registerLimiter
+}
 
-func Register(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 	var req models.RegisterRequest
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	// Throttle by client IP before doing any work
+	_, limiter := authLimiters()
+	if ok, retryAfter := limiter.Allow(middleware.ClientIP(r)); !ok {
+		registerTotal.WithLabelValues("rate_limited").Inc()
+		writeRateLimited(w, retryAfter)
 		return
 	}
 
-	// Validate input
-	if req.Email == "" || req.Password == "" {
-		http.Error(w, "Email and password are required", http.StatusBadRequest)
+	if !registrationEnabled() {
+		registerTotal.WithLabelValues("disabled").Inc()
+		writeJSONError(w, http.StatusForbidden, "registration_disabled", "Registration is disabled")
+		return
+	}
+
+	limitBody(w, r)
+	if err := decodeJSON(r, &req); err != nil {
+		registerTotal.WithLabelValues("invalid_request").Inc()
+		writeBodyError(w, err, "Invalid JSON")
 		return
 	}
 
-	// Validate email format (basic validation)
-	if !strings.Contains(req.Email, "@") {
-		http.Error(w, "Invalid email format", http.StatusBadRequest)
+	// Validate input
+	if code, message := validateCredentials(req.Email, req.Password); code != "" {
+		registerTotal.WithLabelValues("invalid_request").Inc()
+		writeJSONError(w, http.StatusBadRequest, code, message)
 		return
 	}
 
-	// Validate password length
-	if len(req.Password) < 6 {
-		http.Error(w, "Password must be at least 6 characters", http.StatusBadRequest)
+	requireInvite := inviteRequired()
+	if requireInvite && strings.TrimSpace(req.InviteCode) == "" {
+		registerTotal.WithLabelValues("invalid_invite").Inc()
+		writeJSONError(w, http.StatusForbidden, "invite_required", "An invite code is required")
 		return
 	}
 
-	// Check if user already exists
+	// Check if user already exists (including soft-deleted accounts, which still own the email)
 	var existingUser models.User
-	result := database.DB.Where("email = ?", req.Email).First(&existingUser)
+	result := h.DB.Unscoped().Where("email = ?", req.Email).First(&existingUser)
 	if result.Error == nil {
-		http.Error(w, "User already exists", http.StatusConflict)
+		registerTotal.WithLabelValues("user_exists").Inc()
+		writeJSONError(w, http.StatusConflict, "user_exists", "User already exists")
 		return
-	} else if result.Error != gorm.ErrRecordNotFound {
+	} else if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
 		log.Printf("Database error: %v", result.Error)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		registerTotal.WithLabelValues("error").Inc()
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
 		return
 	}
 
 	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword(
-		[]byte(req.Password), bcrypt.DefaultCost,
-	)
+	hashedPassword, err := hashPassword(req.Password)
 	if err != nil {
 		log.Printf("Failed to hash password: %v", err)
-		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+		registerTotal.WithLabelValues("error").Inc()
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to hash password")
 		return
 	}
 
 	// Create user
 	user := models.User{
 		Email:    req.Email,
-		Password: string(hashedPassword),
+		Password: hashedPassword,
+		Role:     models.RoleUser,
+		Status:   models.UserStatusActive,
 	}
 
-	if result := database.DB.Create(&user); result.Error != nil {
-		log.Printf("Failed to create user: %v", result.Error)
-		http.Error(w, "Failed to create user", http.StatusInternalServerError)
+	// The invite is redeemed with the account so a failed signup does not use it up
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		if requireInvite {
+			return redeemInvite(tx, strings.TrimSpace(req.InviteCode), user.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, errInvalidInvite) {
+			registerTotal.WithLabelValues("invalid_invite").Inc()
+			writeJSONError(w, http.StatusForbidden, "invalid_invite", "Invalid or expired invite code")
+			return
+		}
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			registerTotal.WithLabelValues("user_exists").Inc()
+			writeJSONError(w, http.StatusConflict, "user_exists", "User already exists")
+			return
+		}
+		log.Printf("Failed to create user: %v", err)
+		registerTotal.WithLabelValues("error").Inc()
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to create user")
 		return
 	}
 
+	// The account is usable straight away; a failed email can be retried via /auth/verify/resend
+	if err := h.startEmailVerification(r.Context(), &user); err != nil {
+		log.Printf("Failed to send verification email for user %d: %v", user.ID, err)
+	}
+
 	// Generate JWT token
-	token, err := generateJWT(user.ID, user.Email)
+	token, err := h.generateJWT(user.ID, user.Email, user.Role)
 	if err != nil {
 		log.Printf("Failed to generate token: %v", err)
-		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		registerTotal.WithLabelValues("error").Inc()
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to generate token")
 		return
 	}
 
@@ -89,57 +149,107 @@ func Register(w http.ResponseWriter, r *http.Request) {
 		User:  user,
 	}
 
+	registerTotal.WithLabelValues("success").Inc()
+	audit.Record(r, audit.ForUser(audit.ActionRegistered, user.ID).By(user.ID))
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(response)
 }
 
-func Login(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 	var req models.LoginRequest
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	// Throttle by client IP before doing any work
+	limiter, _ := authLimiters()
+	if ok, retryAfter := limiter.Allow(middleware.ClientIP(r)); !ok {
+		loginTotal.WithLabelValues("rate_limited").Inc()
+		writeRateLimited(w, retryAfter)
+		return
+	}
+
+	limitBody(w, r)
+	if err := decodeJSON(r, &req); err != nil {
+		loginTotal.WithLabelValues("invalid_request").Inc()
+		writeBodyError(w, err, "Invalid JSON")
 		return
 	}
 
 	// Validate input
 	if req.Email == "" || req.Password == "" {
-		http.Error(w, "Email and password are required", http.StatusBadRequest)
+		loginTotal.WithLabelValues("invalid_request").Inc()
+		writeJSONError(w, http.StatusBadRequest, "validation_failed", "Email and password are required")
 		return
 	}
 
-	// Get user from database
+	// Get user from database (soft-deleted accounts are included so they can be reported)
 	var user models.User
-	result := database.DB.Where("email = ?", req.Email).First(&user)
+	result := h.DB.Unscoped().Where("email = ?", req.Email).First(&user)
 
-	if result.Error == gorm.ErrRecordNotFound {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		log.Printf("Failed login attempt for unknown account from %s", middleware.ClientIP(r))
+		audit.Record(r, audit.Event{Action: audit.ActionLoginFailed}.With("reason", "unknown_account").With("email", req.Email))
+		loginTotal.WithLabelValues("invalid_credentials").Inc()
+		writeJSONError(w, http.StatusUnauthorized, "invalid_credentials", "Invalid credentials")
 		return
 	} else if result.Error != nil {
 		log.Printf("Database error: %v", result.Error)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		loginTotal.WithLabelValues("error").Inc()
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
 		return
 	}
 
 	// Verify password
-	if err := bcrypt.CompareHashAndPassword(
-		[]byte(user.Password), []byte(req.Password),
-	); err != nil {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+	if err := verifyPassword(user.Password, req.Password); err != nil {
+		log.Printf("Failed login attempt for user %d from %s", user.ID, middleware.ClientIP(r))
+		audit.Record(r, audit.ForUser(audit.ActionLoginFailed, user.ID).With("reason", "invalid_password"))
+		loginTotal.WithLabelValues("invalid_credentials").Inc()
+		writeJSONError(w, http.StatusUnauthorized, "invalid_credentials", "Invalid credentials")
+		return
+	}
+
+	// Block soft-deleted accounts only after the password checked out, so the
+	// account state is not revealed to someone who doesn't know the password
+	if user.DeletedAt.Valid {
+		loginTotal.WithLabelValues("locked").Inc()
+		audit.Record(r, audit.ForUser(audit.ActionLoginFailed, user.ID).With("reason", "account_deleted"))
+		writeJSONError(w, http.StatusForbidden, "account_deleted", "Account has been deleted")
+		return
+	}
+
+	if user.IsSuspended() {
+		log.Printf("Blocked login for suspended user %d from %s", user.ID, middleware.ClientIP(r))
+		audit.Record(r, audit.ForUser(audit.ActionLoginFailed, user.ID).With("reason", "account_suspended"))
+		loginTotal.WithLabelValues("locked").Inc()
+		writeJSONError(w, http.StatusForbidden, "account_suspended", "Account has been suspended")
 		return
 	}
 
+	// Transparently upgrade bcrypt hashes to argon2id, and either kind to the configured cost
+	if passwordNeedsRehash(user.Password) {
+		if rehashed, err := hashPassword(req.Password); err != nil {
+			log.Printf("Failed to rehash password for user %d: %v", user.ID, err)
+		} else if err := h.DB.Model(&user).Update("password_hash", rehashed).Error; err != nil {
+			log.Printf("Failed to store rehashed password for user %d: %v", user.ID, err)
+		}
+	}
+
 	// Generate JWT token
-	token, err := generateJWT(user.ID, user.Email)
+	token, err := h.generateJWT(user.ID, user.Email, user.Role)
 	if err != nil {
 		log.Printf("Failed to generate token: %v", err)
-		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		loginTotal.WithLabelValues("error").Inc()
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to generate token")
 		return
 	}
 
+	loginTotal.WithLabelValues("success").Inc()
+	audit.Record(r, audit.ForUser(audit.ActionLoginSucceeded, user.ID).By(user.ID).With("method", "password"))
+
 	response := models.AuthResponse{
-		Token: token,
-		User:  user,
+		Token:                  token,
+		User:                   user,
+		PasswordChangeRequired: user.MustChangePassword,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -147,77 +257,284 @@ func Login(w http.ResponseWriter, r *http.Request) {
 }
 
 // GetProfile returns the user profile (protected endpoint example)
-func GetProfile(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetProfile(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context (set by middleware)
-	userID, ok := r.Context().Value("user_id").(float64)
+	userID, ok := middleware.UserIDFromContext(r.Context())
 	if !ok {
-		http.Error(w, "Invalid user context", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "invalid_user_context", "Invalid user context")
 		return
 	}
 
 	var user models.User
-	result := database.DB.First(&user, uint(userID))
+	result := h.DB.First(&user, userID)
 
-	if result.Error == gorm.ErrRecordNotFound {
-		http.Error(w, "User not found", http.StatusNotFound)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		writeJSONError(w, http.StatusNotFound, "user_not_found", "User not found")
 		return
 	} else if result.Error != nil {
 		log.Printf("Database error: %v", result.Error)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+
+	// Only embed stats when explicitly requested to keep the default response unchanged
+	if r.URL.Query().Get("include") != "stats" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(user)
 		return
 	}
 
+	stats, err := h.profileStats(user.ID)
+	if err != nil {
+		log.Printf("Error computing profile stats for user %d: %v", user.ID, err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+
+	_, cached := responseCaches()
+	setCacheControl(w, "private", cached.TTL())
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(user)
+	json.NewEncoder(w).Encode(models.ProfileResponse{User: user, Stats: stats})
+}
+
+// profileStats counts the user's transcodes, analyses and jobs that are still running.
+// Results are cached per user for CACHE_STATS_TTL and dropped when one of the user's
+// jobs is submitted, updated or deleted.
+func (h *Handler) profileStats(userID uint) (*models.ProfileStats, error) {
+	_, cached := responseCaches()
+	if stats, ok := cached.Get(userID); ok {
+		return &stats, nil
+	}
+
+	var stats models.ProfileStats
+
+	if err := h.DB.Model(&models.TranscodingJob{}).
+		Where("created_by = ?", userID).
+		Count(&stats.TotalTranscodes).Error; err != nil {
+		return nil, err
+	}
+
+	if err := h.DB.Model(&models.VideoAnalysis{}).
+		Where("created_by = ?", userID).
+		Count(&stats.TotalAnalyses).Error; err != nil {
+		return nil, err
+	}
+
+	var activeTranscodes, activeAnalyses int64
+	if err := h.DB.Model(&models.TranscodingJob{}).
+		Where("created_by = ? AND status IN ?", userID, []models.TranscodingJobStatus{models.StatusPending, models.StatusProcessing}).
+		Count(&activeTranscodes).Error; err != nil {
+		return nil, err
+	}
+
+	if err := h.DB.Model(&models.VideoAnalysis{}).
+		Where("created_by = ? AND status IN ?", userID, []models.VideoAnalysisStatus{models.AnalysisStatusPending, models.AnalysisStatusProcessing}).
+		Count(&activeAnalyses).Error; err != nil {
+		return nil, err
+	}
+
+	stats.ActiveJobs = activeTranscodes + activeAnalyses
+	cached.Set(userID, stats)
+	return &stats, nil
 }
 
-// UpdateProfile updates user profile (protected endpoint example)
-func UpdateProfile(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value("user_id").(float64)
+// UpdateProfile updates user profile (protected endpoint example).
+// Email changes are not applied directly: they require the current password and
+// only take effect once the link sent to the new address is opened.
+func (h *Handler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromContext(r.Context())
 	if !ok {
-		http.Error(w, "Invalid user context", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "invalid_user_context", "Invalid user context")
 		return
 	}
 
 	var updateReq struct {
-		Email string `json:"email"`
+		Email           string `json:"email"`
+		CurrentPassword string `json:"current_password"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&updateReq); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	limitBody(w, r)
+	if err := decodeJSON(r, &updateReq); err != nil {
+		writeBodyError(w, err, "Invalid JSON")
 		return
 	}
 
 	var user models.User
-	result := database.DB.First(&user, uint(userID))
+	result := h.DB.First(&user, userID)
 	if result.Error != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+		writeJSONError(w, http.StatusNotFound, "user_not_found", "User not found")
+		return
+	}
+
+	if updateReq.Email == "" || updateReq.Email == user.Email {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(user)
+		return
+	}
+
+	if !h.allowEmailChange(w, &user, updateReq.Email, updateReq.CurrentPassword) {
+		return
+	}
+
+	if err := h.startEmailChange(r.Context(), &user, updateReq.Email); err != nil {
+		log.Printf("Failed to start email change for user %d: %v", user.ID, err)
+		writeEmailError(w, err, "Failed to update user")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(user)
+}
+
+// DeleteAccount soft-deletes the authenticated user's account. The row is kept
+// (with DeletedAt set) so an admin can restore it later. Tokens issued before the
+// delete are revoked with it, so they stay dead after a restore.
+func (h *Handler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, "invalid_user_context", "Invalid user context")
+		return
+	}
+
+	var deleted int64
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&models.User{}, userID)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		deleted = result.RowsAffected
+		return tx.Unscoped().Model(&models.User{}).Where("id = ?", userID).Update("tokens_revoked_at", time.Now()).Error
+	})
+	if err != nil {
+		log.Printf("Failed to delete user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to delete account")
+		return
+	}
+
+	if deleted == 0 {
+		writeJSONError(w, http.StatusNotFound, "user_not_found", "User not found")
+		return
+	}
+
+	log.Printf("Soft-deleted account for user %d from %s", userID, middleware.ClientIP(r))
+	audit.Record(r, audit.ForUser(audit.ActionAccountDeleted, userID))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ChangePassword replaces the caller's password after checking the current one.
+// It also clears a forced password change set by an admin.
+func (h *Handler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, "invalid_user_context", "Invalid user context")
+		return
+	}
+
+	var req models.ChangePasswordRequest
+	limitBody(w, r)
+	if err := decodeJSON(r, &req); err != nil {
+		writeBodyError(w, err, "Invalid JSON")
+		return
+	}
+
+	if req.CurrentPassword == "" || req.NewPassword == "" {
+		writeJSONError(w, http.StatusBadRequest, "validation_failed", "Current and new password are required")
+		return
+	}
+	if len(req.NewPassword) < 6 {
+		writeJSONError(w, http.StatusBadRequest, "validation_failed", "Password must be at least 6 characters")
+		return
+	}
+	if req.NewPassword == req.CurrentPassword {
+		writeJSONError(w, http.StatusBadRequest, "password_unchanged", "New password must differ from the current one")
+		return
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, userID).Error; err != nil {
+		writeJSONError(w, http.StatusNotFound, "user_not_found", "User not found")
+		return
+	}
+
+	if err := verifyPassword(user.Password, req.CurrentPassword); err != nil {
+		writeJSONError(w, http.StatusUnauthorized, "invalid_credentials", "Invalid current password")
 		return
 	}
 
-	// Update fields
-	if updateReq.Email != "" {
-		user.Email = updateReq.Email
+	hashedPassword, err := hashPassword(req.NewPassword)
+	if err != nil {
+		log.Printf("Failed to hash password: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to hash password")
+		return
 	}
 
-	if result := database.DB.Save(&user); result.Error != nil {
-		log.Printf("Failed to update user: %v", result.Error)
-		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+	err = h.DB.Model(&user).Updates(map[string]interface{}{
+		"password_hash":        hashedPassword,
+		"must_change_password": false,
+	}).Error
+	if err != nil {
+		log.Printf("Failed to change password for user %d: %v", user.ID, err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to change password")
 		return
 	}
 
+	log.Printf("User %d changed their password from %s", user.ID, middleware.ClientIP(r))
+	audit.Record(r, audit.ForUser(audit.ActionPasswordChanged, user.ID))
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(user)
 }
 
-func generateJWT(userID uint, email string) (string, error) {
+// whoamiResponse describes the caller's token
+type whoamiResponse struct {
+	UserID    uint      `json:"user_id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	IssuedAt  time.Time `json:"issued_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// ExpiresIn is the remaining lifetime in whole seconds (0 once expired)
+	ExpiresIn int64 `json:"expires_in"`
+}
+
+// Whoami returns what the caller's token says about them, decoded from the token
+// validated by AuthMiddleware rather than loaded from the database
+func (h *Handler) Whoami(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	claims, claimsOK := middleware.ClaimsFromContext(r.Context())
+	if !ok || !claimsOK {
+		writeJSONError(w, http.StatusInternalServerError, "invalid_user_context", "Invalid user context")
+		return
+	}
+
+	response := whoamiResponse{UserID: userID}
+	response.Email, _ = middleware.EmailFromContext(r.Context())
+	response.Role, _ = middleware.RoleFromContext(r.Context())
+	if issuedAt, err := claims.GetIssuedAt(); err == nil && issuedAt != nil {
+		response.IssuedAt = issuedAt.Time.UTC()
+	}
+	if expiresAt, err := claims.GetExpirationTime(); err == nil && expiresAt != nil {
+		response.ExpiresAt = expiresAt.Time.UTC()
+		if remaining := time.Until(expiresAt.Time); remaining > 0 {
+			response.ExpiresIn = int64(remaining / time.Second)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *Handler) generateJWT(userID uint, email, role string) (string, error) {
+	now := time.Now()
 	claims := jwt.MapClaims{
 		"user_id": userID,
 		"email":   email,
-		"exp":     time.Now().Add(time.Hour * 24).Unix(), // 24 hours
-		"iat":     time.Now().Unix(),
+		"role":    role,
+		"exp":     now.Add(time.Hour * 24).Unix(), // 24 hours
+		// Milliseconds, so a revocation earlier in the same second does not cover it
+		"iat": float64(now.UnixMilli()) / 1000,
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	return token.SignedString(h.JWT.Secret)
 }
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"auth-service/middleware"
+	"auth-service/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// login posts the credentials to Login and returns the response and, on success, the token
+func login(t *testing.T, h *Handler, email, password string) (*httptest.ResponseRecorder, string) {
+	t.Helper()
+
+	rec := serve(t, h.Login, http.MethodPost, "/auth/login", models.LoginRequest{Email: email, Password: password}, "")
+	if rec.Code != http.StatusOK {
+		return rec, ""
+	}
+	var body models.AuthResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode login response: %v", err)
+	}
+	return rec, body.Token
+}
+
+func TestDeleteAccountRestoreCycle(t *testing.T) {
+	h := newTestHandler(t)
+	user := createUser(t, h, "alice@example.com", "correct horse battery", models.RoleUser)
+	admin := createUser(t, h, "admin@example.com", "correct horse battery", models.RoleAdmin)
+
+	rec, token := login(t, h, user.Email, "correct horse battery")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login before delete: got %d %s", rec.Code, rec.Body.String())
+	}
+
+	whoami := middleware.AuthMiddleware(h.Whoami)
+	if rec := serve(t, whoami, http.MethodGet, "/auth/whoami", nil, token); rec.Code != http.StatusOK {
+		t.Fatalf("whoami before delete: got %d", rec.Code)
+	}
+
+	deleteAccount := middleware.AuthMiddleware(h.DeleteAccount)
+	if rec := serve(t, deleteAccount, http.MethodDelete, "/auth/account/soft", nil, token); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete: got %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = serve(t, whoami, http.MethodGet, "/auth/whoami", nil, token)
+	if rec.Code != http.StatusForbidden || errorCode(t, rec) != "account_deleted" {
+		t.Fatalf("whoami after delete: got %d %s, want 403 account_deleted", rec.Code, rec.Body.String())
+	}
+
+	if rec, _ := login(t, h, user.Email, "correct horse battery"); rec.Code != http.StatusForbidden || errorCode(t, rec) != "account_deleted" {
+		t.Fatalf("login after delete: got %d %s, want 403 account_deleted", rec.Code, rec.Body.String())
+	}
+	// A wrong password must not reveal that the account exists but is deleted
+	if rec, _ := login(t, h, user.Email, "wrong password"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("login with wrong password after delete: got %d, want 401", rec.Code)
+	}
+
+	var stored models.User
+	if err := h.DB.Unscoped().First(&stored, user.ID).Error; err != nil {
+		t.Fatalf("load deleted user: %v", err)
+	}
+	if !stored.DeletedAt.Valid || stored.TokensRevokedAt == nil {
+		t.Fatalf("deleted user: deleted_at valid=%v tokens_revoked_at=%v", stored.DeletedAt.Valid, stored.TokensRevokedAt)
+	}
+
+	adminToken := tokenFor(t, h, admin)
+	router := mux.NewRouter()
+	router.HandleFunc("/auth/admin/users/{id}/restore", middleware.AuthMiddleware(middleware.RequireAdmin(h.RestoreUser)))
+	restorePath := "/auth/admin/users/" + strconv.FormatUint(uint64(user.ID), 10) + "/restore"
+	if rec := serve(t, router.ServeHTTP, http.MethodPost, restorePath, nil, adminToken); rec.Code != http.StatusOK {
+		t.Fatalf("restore: got %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec, restored := login(t, h, user.Email, "correct horse battery")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login after restore: got %d %s", rec.Code, rec.Body.String())
+	}
+	// The revocation is usually in the same second; a token minted after it still works
+	if rec := serve(t, whoami, http.MethodGet, "/auth/whoami", nil, restored); rec.Code != http.StatusOK {
+		t.Fatalf("token from the login after restore: got %d %s, want 200", rec.Code, rec.Body.String())
+	}
+
+	// Tokens issued before the delete stay revoked once the account is back
+	rec = serve(t, whoami, http.MethodGet, "/auth/whoami", nil, token)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("old token after restore: got %d %s, want 401", rec.Code, rec.Body.String())
+	}
+
+	if rec := serve(t, router.ServeHTTP, http.MethodPost, restorePath, nil, adminToken); rec.Code != http.StatusConflict {
+		t.Fatalf("second restore: got %d, want 409", rec.Code)
+	}
+}
+
+func TestUpdateProfileDuplicateEmail(t *testing.T) {
+	h := newTestHandler(t)
+	alice := createUser(t, h, "alice@example.com", "correct horse battery", models.RoleUser)
+	createUser(t, h, "bob@example.com", "correct horse battery", models.RoleUser)
+
+	updateProfile := middleware.AuthMiddleware(h.UpdateProfile)
+	body := map[string]string{"email": "bob@example.com", "current_password": "correct horse battery"}
+	rec := serve(t, updateProfile, http.MethodPut, "/auth/profile", body, tokenFor(t, h, alice))
+	if rec.Code != http.StatusConflict || errorCode(t, rec) != "email_in_use" {
+		t.Fatalf("got %d %s, want 409 email_in_use", rec.Code, rec.Body.String())
+	}
+
+	var stored models.User
+	if err := h.DB.First(&stored, alice.ID).Error; err != nil {
+		t.Fatalf("load alice: %v", err)
+	}
+	if stored.Email != alice.Email || stored.PendingEmail != nil {
+		t.Fatalf("email = %q, pending = %v; want unchanged", stored.Email, stored.PendingEmail)
+	}
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// defaultMaxBodyBytes is the request body limit used when MAX_REQUEST_BODY_BYTES is unset
+const defaultMaxBodyBytes = 1 << 20 // 1 MiB
+
+// limitBody caps the number of bytes that can be read from the request body so a
+// huge payload cannot exhaust memory. Reads past the limit fail with *http.MaxBytesError.
+func limitBody(w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil {
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, int64(getEnvInt("MAX_REQUEST_BODY_BYTES", defaultMaxBodyBytes)))
+}
+
+// isBodyTooLarge reports whether err was caused by exceeding the limitBody cap
+func isBodyTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
+
+// errTrailingData is returned by decodeJSON when the body continues after its JSON value
+var errTrailingData = errors.New("unexpected data after the JSON value")
+
+// strictJSON reports whether bodies may only contain fields the endpoint knows about.
+// It is off by default so older clients that send extra fields keep working.
+func strictJSON() bool {
+	return getEnv("STRICT_JSON_BODIES", "false") == "true"
+}
+
+// decodeJSON decodes a request body holding exactly one JSON value into v. With
+// STRICT_JSON_BODIES=true, fields that v does not have are rejected too. An empty
+// body returns io.EOF as with json.Decoder.
+func decodeJSON(r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(r.Body)
+	if strictJSON() {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if err := decoder.Decode(&json.RawMessage{}); !errors.Is(err, io.EOF) {
+		if isBodyTooLarge(err) {
+			return err
+		}
+		return errTrailingData
+	}
+	return nil
+}
+
+// unknownField extracts the field name from json.Decoder's DisallowUnknownFields error
+func unknownField(err error) (string, bool) {
+	quoted, ok := strings.CutPrefix(err.Error(), "json: unknown field ")
+	if !ok {
+		return "", false
+	}
+	return strings.Trim(quoted, `"`), true
+}
+
+// writeBodyError answers a failed body read or decode, using 413 when the body was too large
+// and naming the offending field when it was not expected
+func writeBodyError(w http.ResponseWriter, err error, message string) {
+	if isBodyTooLarge(err) {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, "payload_too_large", "Request body too large")
+		return
+	}
+	if field, ok := unknownField(err); ok {
+		writeValidationError(w, validationErrors{{
+			Field:   field,
+			Rule:    "unknown",
+			Message: fmt.Sprintf("%s is not a recognized field", field),
+		}})
+		return
+	}
+	if errors.Is(err, errTrailingData) {
+		writeJSONError(w, http.StatusBadRequest, "invalid_body", message+": "+errTrailingData.Error())
+		return
+	}
+	writeJSONError(w, http.StatusBadRequest, "invalid_body", message)
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"auth-service/middleware"
+	"auth-service/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// bulkDeleteRequest is the body of DELETE /auth/video/transcode. IDs and Status
+// select the jobs; when both are given a job must match both.
+type bulkDeleteRequest struct {
+	IDs    []string                    `json:"ids"`
+	Status models.TranscodingJobStatus `json:"status"`
+	// Force also deletes jobs that are still pending or processing
+	Force bool `json:"force"`
+}
+
+// bulkDeleteResponse is the body of a successful bulk delete
+type bulkDeleteResponse struct {
+	Deleted int64 `json:"deleted"`
+}
+
+// errActiveJobs aborts a bulk delete that matched pending or processing jobs
+var errActiveJobs = errors.New("active jobs selected")
+
+// activeTranscodeStatuses are the statuses of jobs the transcode service still works on
+var activeTranscodeStatuses = []models.TranscodingJobStatus{models.StatusPending, models.StatusProcessing}
+
+// DeleteVideoTranscodes soft-deletes many of the caller's own transcoding jobs at
+// once, selected by a list of IDs (up to TRANSCODE_BATCH_MAX_SIZE), a status or both.
+// IDs that are not the caller's or do not exist are skipped. Unless force is set, a
+// selection that includes pending or processing jobs is refused with 409 and nothing
+// is deleted. Responds with the number of jobs deleted.
+func (h *Handler) DeleteVideoTranscodes(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, "invalid_user_context", "Invalid user context")
+		return
+	}
+
+	var req bulkDeleteRequest
+	limitBody(w, r)
+	if err := decodeJSON(r, &req); err != nil {
+		writeBodyError(w, err, "Request body must be a JSON object with ids or status")
+		return
+	}
+
+	var errs validationErrors
+	if req.IDs == nil && req.Status == "" {
+		errs = append(errs, fieldError{Field: "ids", Rule: "required", Message: "ids or status is required"})
+	}
+	if req.IDs != nil && len(req.IDs) == 0 {
+		errs = append(errs, fieldError{Field: "ids", Rule: "min", Message: "ids must list at least one job"})
+	}
+	if maxIDs := getEnvInt("TRANSCODE_BATCH_MAX_SIZE", 100); len(req.IDs) > maxIDs {
+		errs = append(errs, fieldError{Field: "ids", Rule: "max", Message: fmt.Sprintf("ids must list at most %d jobs", maxIDs)})
+	}
+	for i, id := range req.IDs {
+		if _, err := uuid.Parse(id); err != nil {
+			field := fmt.Sprintf("ids.%d", i)
+			errs = append(errs, fieldError{Field: field, Rule: "uuid", Message: fmt.Sprintf("%s must be a job UUID", field)})
+		}
+	}
+	if req.Status != "" && !req.Status.IsValid() {
+		errs = append(errs, fieldError{Field: "status", Rule: "oneof", Message: fmt.Sprintf("Unsupported status: %s", req.Status)})
+	}
+	if len(errs) > 0 {
+		writeValidationError(w, errs)
+		return
+	}
+
+	// Only the caller's own jobs, never their organization's
+	selection := func(tx *gorm.DB) *gorm.DB {
+		tx = tx.Model(&models.TranscodingJob{}).Where("created_by = ?", userID)
+		if req.IDs != nil {
+			tx = tx.Where("id IN ?", req.IDs)
+		}
+		if req.Status != "" {
+			tx = tx.Where("status = ?", req.Status)
+		}
+		return tx
+	}
+
+	var deleted, active int64
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if !req.Force {
+			if err := selection(tx).Where("status IN ?", activeTranscodeStatuses).Count(&active).Error; err != nil {
+				return err
+			}
+			if active > 0 {
+				return errActiveJobs
+			}
+		}
+		result := selection(tx).Delete(&models.TranscodingJob{})
+		deleted = result.RowsAffected
+		return result.Error
+	})
+	if errors.Is(err, errActiveJobs) {
+		writeJSONError(w, http.StatusConflict, "jobs_active",
+			fmt.Sprintf("%d of the selected jobs are pending or processing; set force to delete them too", active))
+		return
+	}
+	if err != nil {
+		log.Printf("Error bulk deleting transcoding jobs for user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error deleting transcoding jobs")
+		return
+	}
+
+	if deleted > 0 {
+		invalidateProfileStats(&userID)
+	}
+	log.Printf("Soft-deleted %d transcoding jobs for user %d (force=%t)", deleted, userID, req.Force)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bulkDeleteResponse{Deleted: deleted})
+}
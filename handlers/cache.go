@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"auth-service/cache"
+	"auth-service/models"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Response caches, created on first use from the CACHE_*_TTL settings
+var (
+	cachesOnce        sync.Once
+	optionsCache      *cache.TTL[string, []byte]
+	profileStatsCache *cache.TTL[uint, models.ProfileStats]
+)
+
+// transcodeOptionsKey is the only key of optionsCache; the options are the same for everyone
+const transcodeOptionsKey = "transcode_options"
+
+func responseCaches() (*cache.TTL[string, []byte], *cache.TTL[uint, models.ProfileStats]) {
+	cachesOnce.Do(func() {
+		optionsCache = cache.New[string, []byte](getEnvDuration("CACHE_OPTIONS_TTL", 5*time.Minute))
+		profileStatsCache = cache.New[uint, models.ProfileStats](getEnvDuration("CACHE_STATS_TTL", 30*time.Second))
+	})
+	return optionsCache, profileStatsCache
+}
+
+// invalidateProfileStats drops the cached profile stats of a job's owner after one of
+// their jobs was created, changed status or was deleted
+func invalidateProfileStats(userID *uint) {
+	if userID == nil {
+		return
+	}
+	_, stats := responseCaches()
+	stats.Delete(*userID)
+}
+
+// setCacheControl lets clients reuse a response for ttl; scope is "public" or
+// "private". A disabled cache (ttl <= 0) asks clients to revalidate instead.
+func setCacheControl(w http.ResponseWriter, scope string, ttl time.Duration) {
+	if ttl <= 0 {
+		w.Header().Set("Cache-Control", scope+", no-cache")
+		return
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("%s, max-age=%d", scope, int(ttl.Seconds())))
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"auth-service/middleware"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// downloadTokenResponse is the body of POST /auth/video/transcode/{id}/download-token
+type downloadTokenResponse struct {
+	Token       string    `json:"token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	DownloadURL string    `json:"download_url"`
+	StreamURL   string    `json:"stream_url"`
+}
+
+// CreateDownloadToken mints a short-lived token (DOWNLOAD_TOKEN_TTL, 15m by default)
+// that the download and stream routes accept as ?download_token= instead of the
+// Authorization header. It is bound to the video and the caller, and stops working
+// when the caller's tokens are revoked or the account is suspended.
+func (h *Handler) CreateDownloadToken(w http.ResponseWriter, r *http.Request) {
+	job, userID, ok := h.downloadableJob(w, r)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	// The token carries whole seconds, so report the expiry it actually has
+	expiresAt := now.Add(getEnvDuration("DOWNLOAD_TOKEN_TTL", 15*time.Minute)).Truncate(time.Second)
+	token := middleware.NewDownloadToken(h.JWT.Secret, job.ID, userID, now, expiresAt)
+
+	base := fmt.Sprintf("%s/auth/video/transcode/%s", getEnv("APP_BASE_URL", "http://localhost:8080"), job.ID)
+	query := middleware.DownloadTokenParam + "=" + url.QueryEscape(token)
+	log.Printf("Download token for video %s issued to user %d", job.ID, userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(downloadTokenResponse{
+		Token:       token,
+		ExpiresAt:   expiresAt,
+		DownloadURL: base + "/download?" + query,
+		StreamURL:   base + "/stream?" + query,
+	})
+}
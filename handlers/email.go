@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"auth-service/audit"
+	"auth-service/mail"
+	"auth-service/models"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// startEmailChange records newEmail as pending on the user and emails a
+// confirmation link to it. The current email stays active until confirmed.
+func (h *Handler) startEmailChange(ctx context.Context, user *models.User, newEmail string) error {
+	token, err := newSecureToken()
+	if err != nil {
+		return err
+	}
+
+	tokenHash := hashToken(token)
+	expiresAt := time.Now().Add(getEnvDuration("EMAIL_CHANGE_TOKEN_TTL", 24*time.Hour))
+
+	err = h.DB.Model(user).Updates(map[string]interface{}{
+		"pending_email":           newEmail,
+		"email_change_token_hash": tokenHash,
+		"email_change_expires_at": expiresAt,
+	}).Error
+	if err != nil {
+		return err
+	}
+	user.PendingEmail = &newEmail
+	user.EmailChangeTokenHash = &tokenHash
+	user.EmailChangeExpiresAt = &expiresAt
+
+	link := fmt.Sprintf("%s/auth/email/confirm?token=%s", getEnv("APP_BASE_URL", "http://localhost:8080"), url.QueryEscape(token))
+	return h.sendEmail(ctx, newEmail, mail.EmailChange{Link: link, NewEmail: newEmail, ExpiresAt: expiresAt})
+}
+
+// allowEmailChange checks a requested change of user's email to newEmail: the address
+// must look valid and be unused, and currentPassword must be the account's password.
+// On failure it writes the error response and returns false.
+func (h *Handler) allowEmailChange(w http.ResponseWriter, user *models.User, newEmail, currentPassword string) bool {
+	// Validate email format (basic validation)
+	if !strings.Contains(newEmail, "@") {
+		writeJSONError(w, http.StatusBadRequest, "invalid_email", "Invalid email format")
+		return false
+	}
+
+	// Re-authenticate before allowing the account's recovery address to change
+	if currentPassword == "" {
+		writeJSONError(w, http.StatusBadRequest, "validation_failed", "Current password is required to change email")
+		return false
+	}
+	if err := verifyPassword(user.Password, currentPassword); err != nil {
+		writeJSONError(w, http.StatusUnauthorized, "invalid_credentials", "Invalid current password")
+		return false
+	}
+
+	// Reject addresses that already belong to another account
+	var existingUser models.User
+	result := h.DB.Unscoped().Where("email = ?", newEmail).First(&existingUser)
+	if result.Error == nil {
+		writeJSONError(w, http.StatusConflict, "email_in_use", "Email is already in use")
+		return false
+	} else if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		log.Printf("Database error: %v", result.Error)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return false
+	}
+	return true
+}
+
+// ConfirmEmailChange applies a pending email change once the emailed token is presented
+func (h *Handler) ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		writeJSONError(w, http.StatusBadRequest, "token_required", "Token is required")
+		return
+	}
+
+	var user models.User
+	result := h.DB.Where("email_change_token_hash = ?", hashToken(token)).First(&user)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			writeJSONError(w, http.StatusBadRequest, "invalid_token", "Invalid or expired token")
+			return
+		}
+		log.Printf("Database error: %v", result.Error)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+
+	if user.PendingEmail == nil || user.EmailChangeExpiresAt == nil || time.Now().After(*user.EmailChangeExpiresAt) {
+		writeJSONError(w, http.StatusBadRequest, "invalid_token", "Invalid or expired token")
+		return
+	}
+
+	// The address may have been claimed by another account since the change was requested
+	var existingUser models.User
+	result = h.DB.Unscoped().Where("email = ? AND id <> ?", *user.PendingEmail, user.ID).First(&existingUser)
+	if result.Error == nil {
+		writeJSONError(w, http.StatusConflict, "email_in_use", "Email is already in use")
+		return
+	} else if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		log.Printf("Database error: %v", result.Error)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+
+	// Following the emailed link proves control of the new address
+	now := time.Now()
+	previousEmail := user.Email
+	user.Email = *user.PendingEmail
+	user.EmailVerifiedAt = &now
+	user.PendingEmail = nil
+	user.EmailChangeTokenHash = nil
+	user.EmailChangeExpiresAt = nil
+
+	if result := h.DB.Save(&user); result.Error != nil {
+		// Another account took the address between the check above and the save
+		if errors.Is(result.Error, gorm.ErrDuplicatedKey) {
+			writeJSONError(w, http.StatusConflict, "email_in_use", "Email is already in use")
+			return
+		}
+		log.Printf("Failed to update user: %v", result.Error)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to update user")
+		return
+	}
+
+	log.Printf("Confirmed email change for user %d", user.ID)
+	audit.Record(r, audit.ForUser(audit.ActionEmailChanged, user.ID).By(user.ID).With("from", previousEmail).With("to", user.Email))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// sendEmail renders data's template and delivers it to to through the configured
+// mailer (see MAIL_DRIVER)
+func (h *Handler) sendEmail(ctx context.Context, to string, data mail.Data) error {
+	if err := h.Mail.Send(ctx, to, data); err != nil {
+		return fmt.Errorf("sending %s email: %w", data.Template(), err)
+	}
+	return nil
+}
+
+// writeEmailError answers a request whose notification email could not be sent: 503
+// email_unavailable when the mail server is unreachable or rejects the service's
+// credentials, 500 otherwise
+func writeEmailError(w http.ResponseWriter, err error, message string) {
+	if errors.Is(err, mail.ErrUnavailable) {
+		writeJSONError(w, http.StatusServiceUnavailable, "email_unavailable", "Email delivery is temporarily unavailable, try again later")
+		return
+	}
+	writeJSONError(w, http.StatusInternalServerError, "internal_error", message)
+}
+
+// newSecureToken returns a random, URL-safe token for emailed links
+func newSecureToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// hashToken returns the SHA-256 of a token so only its digest is stored
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"auth-service/mail"
+	"auth-service/middleware"
+	"auth-service/models"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// TestConfirmEmailChangeTakenMeanwhile covers an address that was free when the change
+// was requested but belongs to another account by the time it is confirmed
+func TestConfirmEmailChangeTakenMeanwhile(t *testing.T) {
+	h := newTestHandler(t)
+	alice := createUser(t, h, "alice@example.com", "correct horse battery", models.RoleUser)
+
+	updateProfile := middleware.AuthMiddleware(h.UpdateProfile)
+	body := map[string]string{"email": "new@example.com", "current_password": "correct horse battery"}
+	if rec := serve(t, updateProfile, http.MethodPut, "/auth/profile", body, tokenFor(t, h, alice)); rec.Code != http.StatusAccepted {
+		t.Fatalf("request change: got %d %s", rec.Code, rec.Body.String())
+	}
+
+	sent := h.Mail.Mailer.(*mail.Capture).Messages()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d emails, want 1", len(sent))
+	}
+	link := sent[0].Text[strings.Index(sent[0].Text, "http"):]
+	link = strings.Fields(link)[0]
+	confirm, err := url.Parse(link)
+	if err != nil {
+		t.Fatalf("parse confirmation link %q: %v", link, err)
+	}
+
+	createUser(t, h, "new@example.com", "correct horse battery", models.RoleUser)
+
+	rec := serve(t, h.ConfirmEmailChange, http.MethodGet, confirm.RequestURI(), nil, "")
+	if rec.Code != http.StatusConflict || errorCode(t, rec) != "email_in_use" {
+		t.Fatalf("confirm: got %d %s, want 409 email_in_use", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"auth-service/middleware"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// errorBody is the JSON error envelope returned by every handler:
+// {"error":{"code":"...","message":"...","request_id":"..."}}
+type errorBody struct {
+	Error errorDetail `json:"error"`
+}
+
+type errorDetail struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+	// Fields lists the invalid body fields of a validation_failed error
+	Fields []fieldError `json:"fields,omitempty"`
+}
+
+// writeJSONError writes a JSON error response with a machine-readable code and a
+// human-readable message. The request ID set by middleware.RequestID is included
+// when present.
+func writeJSONError(w http.ResponseWriter, status int, code, message string) {
+	writeJSONErrorBody(w, status, errorDetail{Code: code, Message: message})
+}
+
+// writeJSONErrorBody writes the error envelope for a fully populated errorDetail,
+// filling in the request ID
+func writeJSONErrorBody(w http.ResponseWriter, status int, detail errorDetail) {
+	detail.RequestID = w.Header().Get(middleware.RequestIDHeader)
+	body := errorBody{Error: detail}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// NotFound answers requests that match no route
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	writeJSONError(w, http.StatusNotFound, "not_found", "Not found")
+}
+
+// routeMethods are the methods probed when building a 405 Allow header
+var routeMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodOptions,
+}
+
+// MethodNotAllowed answers requests whose path exists on the router but not for the
+// request method. The Allow header lists the methods the path does accept.
+func MethodNotAllowed(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var allowed []string
+		for _, method := range routeMethods {
+			probe := r.Clone(r.Context())
+			probe.Method = method
+			var match mux.RouteMatch
+			if router.Match(probe, &match) && match.MatchErr == nil {
+				allowed = append(allowed, method)
+			}
+		}
+
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+	})
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"auth-service/middleware"
+	"net/http"
+	"sort"
+)
+
+// reservedForwardFields are set by the service from the authenticated request and are
+// trusted by the video services, so client-supplied values are always dropped
+var reservedForwardFields = []string{"created_by", "user", "user_id", "org_id", "retry_of"}
+
+// sanitizeForwardBody removes reserved fields from a client body before it is
+// forwarded, and every field not in allowed when an allowlist is configured
+func sanitizeForwardBody(body map[string]interface{}, allowed []string) {
+	var dropped []string
+
+	for _, field := range reservedForwardFields {
+		if _, ok := body[field]; ok {
+			delete(body, field)
+			dropped = append(dropped, field)
+		}
+	}
+
+	if len(allowed) > 0 {
+		allowedSet := make(map[string]bool, len(allowed))
+		for _, field := range allowed {
+			allowedSet[field] = true
+		}
+		for field := range body {
+			if !allowedSet[field] {
+				delete(body, field)
+				dropped = append(dropped, field)
+			}
+		}
+	}
+
+	if len(dropped) > 0 {
+		sort.Strings(dropped)
+		debugf("Dropped fields from proxied body: %v", dropped)
+	}
+}
+
+// setForwardOrg adds the caller's organization to a forwarded job body, so the video
+// services store it with the job alongside the creator
+func setForwardOrg(r *http.Request, body map[string]interface{}) {
+	if orgID, _, ok := middleware.OrgFromContext(r.Context()); ok {
+		body["org_id"] = orgID
+	}
+}
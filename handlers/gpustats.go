@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"auth-service/models"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// gpuStat summarizes the transcoding jobs one GPU took on. GPU is null for jobs that
+// have not been assigned one yet.
+type gpuStat struct {
+	GPU                *string  `json:"gpu"`
+	Jobs               int64    `json:"jobs"`
+	Completed          int64    `json:"completed"`
+	Failed             int64    `json:"failed"`
+	Active             int64    `json:"active"`
+	AvgDurationSeconds *float64 `json:"avg_duration_seconds"`
+}
+
+// gpuStatsResponse is the body of GET /auth/admin/gpu-stats
+type gpuStatsResponse struct {
+	Since time.Time `json:"since"`
+	Until time.Time `json:"until"`
+	GPUs  []gpuStat `json:"gpus"`
+}
+
+// GetGPUStats reports per-GPU job counts and average job durations for jobs inserted
+// in a time window (admin only). ?since= takes an RFC 3339 timestamp, a YYYY-MM-DD
+// date or a duration back from now such as 6h; it defaults to GPU_STATS_WINDOW (24h)
+// and is moved forward to stay within GPU_STATS_MAX_WINDOW (30 days).
+func (h *Handler) GetGPUStats(w http.ResponseWriter, r *http.Request) {
+	now := time.Now().UTC()
+	since := now.Add(-getEnvDuration("GPU_STATS_WINDOW", 24*time.Hour))
+	if value := r.URL.Query().Get("since"); value != "" {
+		if window, err := time.ParseDuration(value); err == nil && window > 0 {
+			since = now.Add(-window)
+		} else if t, err := parseDateParam(value); err == nil {
+			since = t.UTC()
+		} else {
+			writeJSONError(w, http.StatusBadRequest, "invalid_since", "since must be an RFC 3339 timestamp, a YYYY-MM-DD date or a duration such as 24h")
+			return
+		}
+	}
+	if earliest := now.Add(-getEnvDuration("GPU_STATS_MAX_WINDOW", 30*24*time.Hour)); since.Before(earliest) {
+		since = earliest
+	}
+
+	stats := []gpuStat{}
+	err := h.DB.Model(&models.TranscodingJob{}).
+		Select(`gpu_used AS gpu,
+			COUNT(*) AS jobs,
+			SUM(CASE WHEN status = ? THEN 1 ELSE 0 END) AS completed,
+			SUM(CASE WHEN status = ? THEN 1 ELSE 0 END) AS failed,
+			SUM(CASE WHEN status IN ? THEN 1 ELSE 0 END) AS active,
+			AVG(duration_seconds) AS avg_duration_seconds`,
+			models.StatusCompleted, models.StatusFailed,
+			[]models.TranscodingJobStatus{models.StatusPending, models.StatusProcessing}).
+		Where("inserted_at >= ?", since).
+		Group("gpu_used").
+		Order("jobs DESC").
+		Scan(&stats).Error
+	if err != nil {
+		log.Printf("Error computing GPU stats: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error computing GPU stats")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(gpuStatsResponse{Since: since, Until: now, GPUs: stats})
+}
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"auth-service/config"
+	"auth-service/mail"
+	"auth-service/oauth"
+	"net/http"
+
+	"gorm.io/gorm"
+)
+
+// Handler holds the dependencies shared by the HTTP handlers. Tests can build one
+// around an in-memory or mock database and stub downstream services.
+type Handler struct {
+	DB       *gorm.DB
+	Services *config.Services
+	JWT      *config.JWT
+	OAuth    *oauth.Registry
+	// Downstream is the HTTP client for the video services
+	Downstream *http.Client
+	// Mail renders and delivers notification emails
+	Mail *mail.Sender
+}
+
+// New creates a Handler using the given database handle, downstream services, JWT
+// settings, OAuth providers and email sender. The downstream client uses the
+// services' TLS settings.
+func New(db *gorm.DB, services *config.Services, jwt *config.JWT, providers *oauth.Registry, sender *mail.Sender) *Handler {
+	return &Handler{
+		DB:         db,
+		Services:   services,
+		JWT:        jwt,
+		OAuth:      providers,
+		Downstream: newDownstreamClient(services.TLSConfig),
+		Mail:       sender,
+	}
+}
+
+// defaultHandler backs the package-level handler functions below
+var defaultHandler = &Handler{}
+
+// SetDefault sets the Handler used by the package-level handler functions
+func SetDefault(h *Handler) {
+	defaultHandler = h
+}
+
+// Package-level wrappers kept for main.go wiring while routes move to *Handler methods
+
+func Status(w http.ResponseWriter, r *http.Request) { defaultHandler.Status(w, r) }
+
+func Ready(w http.ResponseWriter, r *http.Request) { defaultHandler.Ready(w, r) }
+
+func Register(w http.ResponseWriter, r *http.Request) { defaultHandler.Register(w, r) }
+
+func Login(w http.ResponseWriter, r *http.Request) { defaultHandler.Login(w, r) }
+
+func ChangePassword(w http.ResponseWriter, r *http.Request) { defaultHandler.ChangePassword(w, r) }
+
+func Whoami(w http.ResponseWriter, r *http.Request) { defaultHandler.Whoami(w, r) }
+
+func GetProfile(w http.ResponseWriter, r *http.Request) { defaultHandler.GetProfile(w, r) }
+
+func UpdateProfile(w http.ResponseWriter, r *http.Request) { defaultHandler.UpdateProfile(w, r) }
+
+func PatchProfile(w http.ResponseWriter, r *http.Request) { defaultHandler.PatchProfile(w, r) }
+
+func DeleteAccount(w http.ResponseWriter, r *http.Request) { defaultHandler.DeleteAccount(w, r) }
+
+func ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	defaultHandler.ConfirmEmailChange(w, r)
+}
+
+func VerifyEmail(w http.ResponseWriter, r *http.Request) { defaultHandler.VerifyEmail(w, r) }
+
+func ResendVerification(w http.ResponseWriter, r *http.Request) {
+	defaultHandler.ResendVerification(w, r)
+}
+
+func OAuthLogin(w http.ResponseWriter, r *http.Request) { defaultHandler.OAuthLogin(w, r) }
+
+func OAuthCallback(w http.ResponseWriter, r *http.Request) { defaultHandler.OAuthCallback(w, r) }
+
+func GetOrganization(w http.ResponseWriter, r *http.Request) { defaultHandler.GetOrganization(w, r) }
+
+func CreateOrganization(w http.ResponseWriter, r *http.Request) {
+	defaultHandler.CreateOrganization(w, r)
+}
+
+func InviteOrgMember(w http.ResponseWriter, r *http.Request) { defaultHandler.InviteOrgMember(w, r) }
+
+func ListOrgInvites(w http.ResponseWriter, r *http.Request) { defaultHandler.ListOrgInvites(w, r) }
+
+func AcceptOrgInvite(w http.ResponseWriter, r *http.Request) { defaultHandler.AcceptOrgInvite(w, r) }
+
+func DeclineOrgInvite(w http.ResponseWriter, r *http.Request) { defaultHandler.DeclineOrgInvite(w, r) }
+
+func UpdateOrgMember(w http.ResponseWriter, r *http.Request) { defaultHandler.UpdateOrgMember(w, r) }
+
+func RemoveOrgMember(w http.ResponseWriter, r *http.Request) { defaultHandler.RemoveOrgMember(w, r) }
+
+func ListUsers(w http.ResponseWriter, r *http.Request) { defaultHandler.ListUsers(w, r) }
+
+func CreateUser(w http.ResponseWriter, r *http.Request) { defaultHandler.CreateUser(w, r) }
+
+func ImportUsers(w http.ResponseWriter, r *http.Request) { defaultHandler.ImportUsers(w, r) }
+
+func CreateInvite(w http.ResponseWriter, r *http.Request) { defaultHandler.CreateInvite(w, r) }
+
+func GetUser(w http.ResponseWriter, r *http.Request) { defaultHandler.GetUser(w, r) }
+
+func RestoreUser(w http.ResponseWriter, r *http.Request) { defaultHandler.RestoreUser(w, r) }
+
+func SuspendUser(w http.ResponseWriter, r *http.Request) { defaultHandler.SuspendUser(w, r) }
+
+func UnsuspendUser(w http.ResponseWriter, r *http.Request) { defaultHandler.UnsuspendUser(w, r) }
+
+func RequirePasswordChange(w http.ResponseWriter, r *http.Request) {
+	defaultHandler.RequirePasswordChange(w, r)
+}
+
+func GetMaintenance(w http.ResponseWriter, r *http.Request) { defaultHandler.GetMaintenance(w, r) }
+
+func SetMaintenance(w http.ResponseWriter, r *http.Request) { defaultHandler.SetMaintenance(w, r) }
+
+func ListAuditLogs(w http.ResponseWriter, r *http.Request) { defaultHandler.ListAuditLogs(w, r) }
+
+func ListAdminJobs(w http.ResponseWriter, r *http.Request) { defaultHandler.ListAdminJobs(w, r) }
+
+func GetGPUStats(w http.ResponseWriter, r *http.Request) { defaultHandler.GetGPUStats(w, r) }
+
+func IntrospectToken(w http.ResponseWriter, r *http.Request) { defaultHandler.IntrospectToken(w, r) }
+
+func UpdateTranscodeStatus(w http.ResponseWriter, r *http.Request) {
+	defaultHandler.UpdateTranscodeStatus(w, r)
+}
+
+func AnalyzeVideoProxy(w http.ResponseWriter, r *http.Request) {
+	defaultHandler.AnalyzeVideoProxy(w, r)
+}
+
+func GetVideoAnalyses(w http.ResponseWriter, r *http.Request) { defaultHandler.GetVideoAnalyses(w, r) }
+
+func GetVideoAnalysesInfo(w http.ResponseWriter, r *http.Request) {
+	defaultHandler.GetVideoAnalysesInfo(w, r)
+}
+
+func DeleteVideoAnalysis(w http.ResponseWriter, r *http.Request) {
+	defaultHandler.DeleteVideoAnalysis(w, r)
+}
+
+func RerunVideoAnalysis(w http.ResponseWriter, r *http.Request) {
+	defaultHandler.RerunVideoAnalysis(w, r)
+}
+
+func TranscodeVideoProxy(w http.ResponseWriter, r *http.Request) {
+	defaultHandler.TranscodeVideoProxy(w, r)
+}
+
+func TranscodeVideoBatchProxy(w http.ResponseWriter, r *http.Request) {
+	defaultHandler.TranscodeVideoBatchProxy(w, r)
+}
+
+func GetVideoTranscodes(w http.ResponseWriter, r *http.Request) {
+	defaultHandler.GetVideoTranscodes(w, r)
+}
+
+func DeleteVideoTranscodes(w http.ResponseWriter, r *http.Request) {
+	defaultHandler.DeleteVideoTranscodes(w, r)
+}
+
+func RetryVideoTranscode(w http.ResponseWriter, r *http.Request) {
+	defaultHandler.RetryVideoTranscode(w, r)
+}
+
+func GetVideoTranscodeStatuses(w http.ResponseWriter, r *http.Request) {
+	defaultHandler.GetVideoTranscodeStatuses(w, r)
+}
+
+func GetTranscodeOptions(w http.ResponseWriter, r *http.Request) {
+	defaultHandler.GetTranscodeOptions(w, r)
+}
+
+func GetVideoTranscodeInfo(w http.ResponseWriter, r *http.Request) {
+	defaultHandler.GetVideoTranscodeInfo(w, r)
+}
+
+func DownloadVideoFromS3(w http.ResponseWriter, r *http.Request) {
+	defaultHandler.DownloadVideoFromS3(w, r)
+}
+
+func StreamVideoFromS3(w http.ResponseWriter, r *http.Request) {
+	defaultHandler.StreamVideoFromS3(w, r)
+}
+
+func CreateShareLink(w http.ResponseWriter, r *http.Request) { defaultHandler.CreateShareLink(w, r) }
+
+func CreateDownloadToken(w http.ResponseWriter, r *http.Request) {
+	defaultHandler.CreateDownloadToken(w, r)
+}
+
+func ListShareLinks(w http.ResponseWriter, r *http.Request) { defaultHandler.ListShareLinks(w, r) }
+
+func RevokeShareLink(w http.ResponseWriter, r *http.Request) { defaultHandler.RevokeShareLink(w, r) }
+
+func OpenShareLink(w http.ResponseWriter, r *http.Request) { defaultHandler.OpenShareLink(w, r) }
+
+func JobUpdatesSocket(w http.ResponseWriter, r *http.Request) { defaultHandler.JobUpdatesSocket(w, r) }
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"auth-service/config"
+	"auth-service/database"
+	"auth-service/mail"
+	"auth-service/middleware"
+	"auth-service/models"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+const testJWTSecret = "0123456789abcdef0123456789abcdef"
+
+func TestMain(m *testing.M) {
+	// The per-IP limiters are created once per process; keep them out of the way
+	os.Setenv("LOGIN_RATE_LIMIT", "1000")
+	os.Setenv("REGISTER_RATE_LIMIT", "1000")
+	os.Exit(m.Run())
+}
+
+// newTestHandler returns a Handler backed by a fresh in-memory SQLite database,
+// which also becomes database.DB for the middleware. Sent emails are captured.
+func newTestHandler(t testing.TB) *Handler {
+	t.Helper()
+
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_SQLITE_PATH", "file:"+name+"?mode=memory&cache=shared")
+	t.Setenv("DB_PREPARE_STMT", "false")
+	t.Setenv("ENV", "production")
+	t.Setenv("JWT_SECRET", testJWTSecret)
+	database.InitDB()
+	db := database.DB
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	services, err := config.LoadServices()
+	if err != nil {
+		t.Fatalf("LoadServices: %v", err)
+	}
+	jwtConfig, err := config.LoadJWT()
+	if err != nil {
+		t.Fatalf("LoadJWT: %v", err)
+	}
+	middleware.SetJWTConfig(jwtConfig)
+
+	templates, err := mail.LoadTemplates("")
+	if err != nil {
+		t.Fatalf("LoadTemplates: %v", err)
+	}
+	return New(db, services, jwtConfig, nil, &mail.Sender{Mailer: &mail.Capture{}, Templates: templates})
+}
+
+// createUser stores an active account with the given password and role
+func createUser(t testing.TB, h *Handler, email, password, role string) models.User {
+	t.Helper()
+
+	hashed, err := hashPassword(password)
+	if err != nil {
+		t.Fatalf("hashPassword: %v", err)
+	}
+	user := models.User{Email: email, Password: hashed, Role: role, Status: models.UserStatusActive}
+	if err := h.DB.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+// tokenFor issues an access token for user the way Login does
+func tokenFor(t testing.TB, h *Handler, user models.User) string {
+	t.Helper()
+
+	token, err := h.generateJWT(user.ID, user.Email, user.Role)
+	if err != nil {
+		t.Fatalf("generateJWT: %v", err)
+	}
+	return token
+}
+
+// serve runs handler on a request with an optional JSON body and bearer token
+func serve(t testing.TB, handler http.HandlerFunc, method, path string, body interface{}, token string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var reader *bytes.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("marshal body: %v", err)
+		}
+		reader = bytes.NewReader(encoded)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+// errorCode returns the code field of a JSON error response
+func errorCode(t testing.TB, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+
+	var body struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode error response %q: %v", rec.Body.String(), err)
+	}
+	return body.Error.Code
+}
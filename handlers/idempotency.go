@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"auth-service/models"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// IdempotencyKeyHeader is the request header clients use to make submissions retry-safe
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+var (
+	errIdempotencyInProgress = errors.New("a request with this Idempotency-Key is still in progress")
+	errIdempotencyMismatch   = errors.New("Idempotency-Key was already used with a different request body")
+)
+
+// claimIdempotencyKey reserves key for the user. It returns the stored record when the
+// key was already used for an identical, completed request, so the caller can replay it.
+// A nil record and nil error mean the key is now reserved for this request.
+func (h *Handler) claimIdempotencyKey(userID uint, key string, body []byte) (*models.IdempotencyKey, error) {
+	requestHash := hashRequestBody(body)
+	now := time.Now()
+
+	// Expired keys may be reused
+	if err := h.DB.
+		Where("key = ? AND user_id = ? AND expires_at <= ?", key, userID, now).
+		Delete(&models.IdempotencyKey{}).Error; err != nil {
+		return nil, err
+	}
+
+	record := models.IdempotencyKey{
+		Key:         key,
+		UserID:      userID,
+		RequestHash: requestHash,
+		ExpiresAt:   now.Add(getEnvDuration("IDEMPOTENCY_KEY_TTL", 24*time.Hour)),
+	}
+
+	result := h.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 1 {
+		return nil, nil
+	}
+
+	// The key already exists for this user
+	var existing models.IdempotencyKey
+	if err := h.DB.Where("key = ? AND user_id = ?", key, userID).First(&existing).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// The other request released the key in the meantime; let the client retry
+			return nil, errIdempotencyInProgress
+		}
+		return nil, err
+	}
+
+	if existing.RequestHash != requestHash {
+		return nil, errIdempotencyMismatch
+	}
+	if !existing.Completed() {
+		return nil, errIdempotencyInProgress
+	}
+	return &existing, nil
+}
+
+// completeIdempotencyKey stores the response for a reserved key
+func (h *Handler) completeIdempotencyKey(userID uint, key string, statusCode int, contentType string, body []byte) error {
+	updates := map[string]interface{}{
+		"status_code":   statusCode,
+		"content_type":  contentType,
+		"response_body": string(body),
+	}
+	if jobID := extractJobID(body); jobID != "" {
+		updates["job_id"] = jobID
+	}
+
+	return h.DB.Model(&models.IdempotencyKey{}).
+		Where("key = ? AND user_id = ?", key, userID).
+		Updates(updates).Error
+}
+
+// releaseIdempotencyKey drops a reservation whose request did not succeed so it can be retried
+func (h *Handler) releaseIdempotencyKey(userID uint, key string) error {
+	return h.DB.
+		Where("key = ? AND user_id = ?", key, userID).
+		Delete(&models.IdempotencyKey{}).Error
+}
+
+// replayIdempotentResponse writes a stored response back to the client
+func replayIdempotentResponse(w http.ResponseWriter, record *models.IdempotencyKey) {
+	if record.ContentType != "" {
+		w.Header().Set("Content-Type", record.ContentType)
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(record.StatusCode)
+	w.Write([]byte(record.ResponseBody))
+}
+
+func hashRequestBody(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"auth-service/audit"
+	"auth-service/middleware"
+	"auth-service/models"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// importRow is one account in a bulk import. Exactly one of PasswordHash (an existing
+// bcrypt or argon2id hash) or Password (a temporary plaintext password) must be set.
+type importRow struct {
+	Email        string `json:"email"`
+	PasswordHash string `json:"password_hash"`
+	Password     string `json:"password"`
+	Role         string `json:"role"`
+}
+
+// importRowResult describes the outcome of a single row in a bulk import
+type importRowResult struct {
+	Index  int    `json:"index"`
+	Email  string `json:"email"`
+	Status string `json:"status"` // created, skipped or failed
+	UserID uint   `json:"user_id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ImportUsers creates accounts in bulk (admin only). The body is a JSON array of
+// {"email", "password_hash" | "password", "role"} objects, or CSV with a header row
+// naming the same columns when sent as text/csv. All rows are inserted in one
+// transaction with a savepoint per row, so a bad row is reported without undoing the
+// others. Emails that already have an account are skipped. Responds with 207 and a
+// per-row result array.
+func (h *Handler) ImportUsers(w http.ResponseWriter, r *http.Request) {
+	limitBody(w, r)
+
+	var rows []importRow
+	var err error
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "text/csv" {
+		rows, err = readImportCSV(r.Body)
+	} else {
+		err = decodeJSON(r, &rows)
+	}
+	if err != nil {
+		writeBodyError(w, err, "Request body must be a JSON array of users or CSV with a header row")
+		return
+	}
+
+	if len(rows) == 0 {
+		writeJSONError(w, http.StatusBadRequest, "validation_failed", "Import must contain at least one user")
+		return
+	}
+
+	maxRows := getEnvInt("USER_IMPORT_MAX_ROWS", 500)
+	if len(rows) > maxRows {
+		writeJSONError(w, http.StatusBadRequest, "import_too_large", fmt.Sprintf("Import exceeds the maximum of %d users", maxRows))
+		return
+	}
+
+	// Validate and hash up front so the transaction is not held open during bcrypt
+	results := make([]importRowResult, len(rows))
+	users := make([]*models.User, len(rows))
+	for i, row := range rows {
+		results[i] = importRowResult{Index: i, Email: strings.TrimSpace(row.Email)}
+		user, err := importUser(row)
+		if err != nil {
+			results[i].Status = "failed"
+			results[i].Error = err.Error()
+			continue
+		}
+		users[i] = user
+	}
+
+	err = h.DB.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		for i, user := range users {
+			if user == nil {
+				continue
+			}
+			err := tx.Transaction(func(rowTx *gorm.DB) error {
+				var existing int64
+				if err := rowTx.Unscoped().Model(&models.User{}).Where("email = ?", user.Email).Count(&existing).Error; err != nil {
+					return err
+				}
+				if existing > 0 {
+					return gorm.ErrDuplicatedKey
+				}
+				return rowTx.Create(user).Error
+			})
+			switch {
+			case err == nil:
+				results[i].Status = "created"
+				results[i].UserID = user.ID
+			case errors.Is(err, gorm.ErrDuplicatedKey):
+				results[i].Status = "skipped"
+				results[i].Error = "user already exists"
+			default:
+				log.Printf("Failed to import user %q: %v", user.Email, err)
+				results[i].Status = "failed"
+				results[i].Error = "failed to create user"
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("User import transaction failed: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to import users")
+		return
+	}
+
+	counts := map[string]int{"created": 0, "skipped": 0, "failed": 0}
+	for _, result := range results {
+		counts[result.Status]++
+	}
+
+	adminID, _ := middleware.UserIDFromContext(r.Context())
+	log.Printf("User import by admin %d from %s: %d created, %d skipped, %d failed",
+		adminID, middleware.ClientIP(r), counts["created"], counts["skipped"], counts["failed"])
+	audit.Record(r, audit.Event{Action: audit.ActionUsersImported}.
+		With("created", counts["created"]).With("skipped", counts["skipped"]).With("failed", counts["failed"]))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusMultiStatus)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"created": counts["created"],
+		"skipped": counts["skipped"],
+		"failed":  counts["failed"],
+		"results": results,
+	})
+}
+
+// importUser validates an import row and builds the account it describes
+func importUser(row importRow) (*models.User, error) {
+	email := strings.TrimSpace(row.Email)
+	if email == "" || !strings.Contains(email, "@") {
+		return nil, errors.New("invalid email")
+	}
+
+	role := strings.TrimSpace(row.Role)
+	if role == "" {
+		role = models.RoleUser
+	}
+	if role != models.RoleUser && role != models.RoleAdmin {
+		return nil, errors.New("role must be user or admin")
+	}
+
+	var hashedPassword string
+	temporary := false
+	switch {
+	case row.PasswordHash != "" && row.Password != "":
+		return nil, errors.New("set either password_hash or password, not both")
+	case row.PasswordHash != "":
+		if !validPasswordHash(row.PasswordHash) {
+			return nil, errors.New("password_hash is not a bcrypt or argon2id hash")
+		}
+		hashedPassword = row.PasswordHash
+	case row.Password == "":
+		return nil, errors.New("password_hash or password is required")
+	case len(row.Password) < 6:
+		return nil, errors.New("password must be at least 6 characters")
+	default:
+		hashed, err := hashPassword(row.Password)
+		if err != nil {
+			return nil, errors.New("failed to hash password")
+		}
+		hashedPassword = hashed
+		temporary = true
+	}
+
+	// Temporary passwords have to be replaced on first login
+	return &models.User{
+		Email:              email,
+		Password:           hashedPassword,
+		Role:               role,
+		Status:             models.UserStatusActive,
+		MustChangePassword: temporary,
+	}, nil
+}
+
+// readImportCSV parses CSV import rows. The first record is a header naming the
+// columns (email, password_hash, password, role); unknown columns are ignored.
+func readImportCSV(body io.Reader) ([]importRow, error) {
+	reader := csv.NewReader(body)
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["email"]; !ok {
+		return nil, errors.New("CSV header must include an email column")
+	}
+
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+
+	var rows []importRow
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, importRow{
+			Email:        field(record, "email"),
+			PasswordHash: strings.TrimSpace(field(record, "password_hash")),
+			Password:     field(record, "password"),
+			Role:         strings.TrimSpace(field(record, "role")),
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"auth-service/middleware"
+	"auth-service/models"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// IntrospectToken lets other services check whether a user token is valid and
+// read its claims (internal endpoint, requires the service token)
+func (h *Handler) IntrospectToken(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token string `json:"token"`
+	}
+
+	limitBody(w, r)
+	if err := decodeJSON(r, &req); err != nil {
+		writeBodyError(w, err, "Invalid JSON")
+		return
+	}
+
+	if req.Token == "" {
+		writeJSONError(w, http.StatusBadRequest, "token_required", "Token is required")
+		return
+	}
+
+	response := map[string]interface{}{"active": false}
+
+	// Only tokens this service signed are introspected, so only its HMAC method is valid
+	token, err := jwt.Parse(req.Token, func(token *jwt.Token) (interface{}, error) {
+		return h.JWT.Secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithLeeway(h.JWT.Leeway),
+		jwt.WithExpirationRequired(), jwt.WithIssuedAt())
+	if err == nil && token.Valid {
+		claims, _ := token.Claims.(jwt.MapClaims)
+		active := false
+		if claims["iat"] != nil {
+			if active, err = middleware.TokenAccountActive(claims); err != nil {
+				log.Printf("Error loading the account of an introspected token: %v", err)
+				writeJSONError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+				return
+			}
+		}
+		if active {
+			response["active"] = true
+			response["user_id"] = claims["user_id"]
+			response["email"] = claims["email"]
+			response["exp"] = claims["exp"]
+			response["iat"] = claims["iat"]
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// UpdateTranscodeStatus receives status updates for a transcoding job from the
+// transcode service (internal endpoint, requires the service token)
+func (h *Handler) UpdateTranscodeStatus(w http.ResponseWriter, r *http.Request) {
+	// Get the job ID from URL path
+	vars := mux.Vars(r)
+	jobID := vars["id"]
+
+	// Validate UUID format
+	if _, err := uuid.Parse(jobID); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_id", "Invalid job ID format")
+		return
+	}
+
+	var req struct {
+		Status       models.TranscodingJobStatus `json:"status"`
+		ErrorMessage *string                     `json:"error_message"`
+		OutputURL    *string                     `json:"output_url"`
+	}
+
+	limitBody(w, r)
+	if err := decodeJSON(r, &req); err != nil {
+		writeBodyError(w, err, "Invalid JSON")
+		return
+	}
+
+	if !req.Status.IsValid() {
+		writeJSONError(w, http.StatusBadRequest, "invalid_status", "Invalid status")
+		return
+	}
+
+	var transcodingJob models.TranscodingJob
+	result := h.DB.Where("id = ?", jobID).First(&transcodingJob)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			writeJSONError(w, http.StatusNotFound, "job_not_found", "Transcoding job not found")
+			return
+		}
+		log.Printf("Error retrieving transcoding job %s: %v", jobID, result.Error)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+
+	// Update fields
+	transcodingJob.Status = req.Status
+	if req.ErrorMessage != nil {
+		transcodingJob.ErrorMessage = req.ErrorMessage
+	}
+	if req.OutputURL != nil {
+		transcodingJob.OutputURL = req.OutputURL
+	}
+
+	if result := h.DB.Save(&transcodingJob); result.Error != nil {
+		log.Printf("Failed to update transcoding job %s: %v", jobID, result.Error)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to update transcoding job")
+		return
+	}
+	jobUpdates.publish(newJobUpdate(&transcodingJob))
+	invalidateProfileStats(transcodingJob.CreatedBy)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(transcodingJob)
+
+	log.Printf("Updated transcoding job %s to status %s", jobID, req.Status)
+}
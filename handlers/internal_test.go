@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"auth-service/models"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// introspect posts token to IntrospectToken and returns the active field
+func introspect(t *testing.T, h *Handler, token string) bool {
+	t.Helper()
+
+	rec := serve(t, h.IntrospectToken, http.MethodPost, "/internal/auth/introspect", map[string]string{"token": token}, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("introspect: got %d %s", rec.Code, rec.Body.String())
+	}
+	var body struct {
+		Active bool `json:"active"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode introspection: %v", err)
+	}
+	return body.Active
+}
+
+func TestIntrospectTokenAppliesAccountChecks(t *testing.T) {
+	h := newTestHandler(t)
+	alice := createUser(t, h, "alice@example.com", "correct horse battery", models.RoleUser)
+	bob := createUser(t, h, "bob@example.com", "correct horse battery", models.RoleUser)
+
+	if !introspect(t, h, tokenFor(t, h, alice)) {
+		t.Errorf("token of an active account introspected as inactive")
+	}
+
+	// A token restricted to the password change routes is not usable elsewhere
+	if err := h.DB.Model(&bob).Update("must_change_password", true).Error; err != nil {
+		t.Fatalf("flag bob: %v", err)
+	}
+	if introspect(t, h, tokenFor(t, h, bob)) {
+		t.Errorf("token awaiting a forced password change introspected as active")
+	}
+
+	// An out-of-range user_id is refused rather than truncated onto some account
+	claims := jwt.MapClaims{"user_id": float64(alice.ID) + 0.5, "iat": time.Now().Unix(), "exp": time.Now().Add(time.Hour).Unix()}
+	fractional, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(h.JWT.Secret)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	if introspect(t, h, fractional) {
+		t.Errorf("token with a fractional user_id introspected as active")
+	}
+
+	// Only HS256 is accepted, even when the signature checks out with another HMAC
+	claims["user_id"] = alice.ID
+	hs512, err := jwt.NewWithClaims(jwt.SigningMethodHS512, claims).SignedString(h.JWT.Secret)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	if introspect(t, h, hs512) {
+		t.Errorf("HS512 token introspected as active")
+	}
+}
+
+func TestIntrospectTokenLimitsBody(t *testing.T) {
+	t.Setenv("MAX_REQUEST_BODY_BYTES", "1024")
+	h := newTestHandler(t)
+
+	body := map[string]string{"token": strings.Repeat("x", 4096)}
+	rec := serve(t, h.IntrospectToken, http.MethodPost, "/internal/auth/introspect", body, "")
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("got %d %s, want 413", rec.Code, rec.Body.String())
+	}
+}
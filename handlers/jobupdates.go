@@ -0,0 +1,339 @@
+package handlers
+
+import (
+	"auth-service/middleware"
+	"auth-service/models"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/net/websocket"
+)
+
+// jobUpdate is the message pushed to socket subscribers with a job's current state.
+// Clients can order updates by updated_at.
+type jobUpdate struct {
+	Type         string                      `json:"type"`
+	JobID        string                      `json:"job_id"`
+	Status       models.TranscodingJobStatus `json:"status"`
+	ErrorMessage *string                     `json:"error_message,omitempty"`
+	OutputURL    *string                     `json:"output_url,omitempty"`
+	UpdatedAt    time.Time                   `json:"updated_at"`
+}
+
+func newJobUpdate(job *models.TranscodingJob) jobUpdate {
+	return jobUpdate{
+		Type:         "status",
+		JobID:        job.ID.String(),
+		Status:       job.Status,
+		ErrorMessage: job.ErrorMessage,
+		OutputURL:    job.OutputURL,
+		UpdatedAt:    job.UpdatedAt,
+	}
+}
+
+// jobSubscriber receives the updates of the jobs one socket is subscribed to
+type jobSubscriber struct {
+	updates chan jobUpdate
+}
+
+// jobUpdateHub fans job status changes out to socket subscribers. It is in memory,
+// so only sockets on the instance that received the status update are notified.
+type jobUpdateHub struct {
+	mu   sync.Mutex
+	subs map[string]map[*jobSubscriber]struct{}
+}
+
+var jobUpdates = &jobUpdateHub{subs: make(map[string]map[*jobSubscriber]struct{})}
+
+func (hub *jobUpdateHub) subscribe(jobID string, sub *jobSubscriber) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	if hub.subs[jobID] == nil {
+		hub.subs[jobID] = make(map[*jobSubscriber]struct{})
+	}
+	hub.subs[jobID][sub] = struct{}{}
+}
+
+func (hub *jobUpdateHub) unsubscribe(jobID string, sub *jobSubscriber) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	delete(hub.subs[jobID], sub)
+	if len(hub.subs[jobID]) == 0 {
+		delete(hub.subs, jobID)
+	}
+}
+
+// publish delivers an update without blocking; a subscriber too slow to keep up
+// misses it
+func (hub *jobUpdateHub) publish(update jobUpdate) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	for sub := range hub.subs[update.JobID] {
+		select {
+		case sub.updates <- update:
+		default:
+			log.Printf("Dropped update for job %s: socket subscriber is not keeping up", update.JobID)
+		}
+	}
+}
+
+// socketRequest is a message from the client on the job updates socket:
+// {"action": "subscribe"|"unsubscribe", "job_ids": [...]} or {"action": "ping"}
+type socketRequest struct {
+	Action string   `json:"action"`
+	JobIDs []string `json:"job_ids"`
+}
+
+// socketReply answers a socketRequest
+type socketReply struct {
+	Type     string   `json:"type"`
+	JobIDs   []string `json:"job_ids,omitempty"`
+	Rejected []string `json:"rejected,omitempty"`
+	Message  string   `json:"message,omitempty"`
+}
+
+// JobUpdatesSocket upgrades to a WebSocket that pushes status updates for the
+// transcoding jobs the client subscribes to. Jobs are checked against the same read
+// scope as the info endpoint. The server pings every WS_PING_INTERVAL (30s) and drops
+// connections that send nothing, pongs included, for twice that long.
+func (h *Handler) JobUpdatesSocket(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, "invalid_user_context", "Invalid user context")
+		return
+	}
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		writeJSONError(w, http.StatusBadRequest, "websocket_required", "This endpoint requires a WebSocket upgrade")
+		return
+	}
+
+	pingInterval := getEnvDuration("WS_PING_INTERVAL", 30*time.Second)
+
+	conn, buf, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		log.Printf("Cannot upgrade job updates socket: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "WebSocket upgrades are not supported here")
+		return
+	}
+
+	// Tokens are bearer credentials rather than cookies, so any origin may connect
+	server := websocket.Server{Handler: func(ws *websocket.Conn) {
+		h.serveJobUpdates(ws, r, userID, pingInterval)
+	}}
+	server.ServeHTTP(newHijackedWriter(w, conn, buf, 2*pingInterval), r)
+}
+
+// serveJobUpdates runs one socket: a reader goroutine handles client requests while
+// this goroutine does every write, so pings and messages never interleave
+func (h *Handler) serveJobUpdates(ws *websocket.Conn, r *http.Request, userID uint, pingInterval time.Duration) {
+	ws.MaxPayloadBytes = 64 << 10
+	scope := jobScopeFor(r, userID)
+	maxSubscriptions := getEnvInt("WS_MAX_SUBSCRIPTIONS", 100)
+
+	sub := &jobSubscriber{updates: make(chan jobUpdate, 32)}
+	subscribed := make(map[string]bool)
+	replies := make(chan interface{}, 32)
+	done := make(chan struct{})
+	stop := make(chan struct{})
+
+	// send queues a message for the writer, giving up once the socket is closing
+	send := func(message interface{}) bool {
+		select {
+		case replies <- message:
+			return true
+		case <-stop:
+			return false
+		}
+	}
+
+	go func() {
+		defer close(done)
+		for {
+			var req socketRequest
+			if err := websocket.JSON.Receive(ws, &req); err != nil {
+				var syntaxErr *json.SyntaxError
+				var typeErr *json.UnmarshalTypeError
+				if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+					if send(socketReply{Type: "error", Message: "Invalid JSON message"}) {
+						continue
+					}
+				}
+				return
+			}
+			if !send(h.handleSocketRequest(req, scope, sub, subscribed, maxSubscriptions, send)) {
+				return
+			}
+		}
+	}()
+
+	// Tear down subscriptions once the reader has stopped touching them
+	defer func() {
+		close(stop)
+		ws.Close()
+		<-done
+		for jobID := range subscribed {
+			jobUpdates.unsubscribe(jobID, sub)
+		}
+		log.Printf("Job updates socket closed for user %d", userID)
+	}()
+
+	log.Printf("Job updates socket opened for user %d", userID)
+
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		var err error
+		select {
+		case <-done:
+			return
+		case message := <-replies:
+			err = writeSocketJSON(ws, message)
+		case update := <-sub.updates:
+			err = writeSocketJSON(ws, update)
+		case <-ticker.C:
+			err = writeSocketPing(ws)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// handleSocketRequest applies one client request and returns the reply. Current job
+// states for new subscriptions are queued with send after the subscriptions are made,
+// so no update in between is lost.
+func (h *Handler) handleSocketRequest(req socketRequest, scope jobScope, sub *jobSubscriber, subscribed map[string]bool, maxSubscriptions int, send func(interface{}) bool) socketReply {
+	switch req.Action {
+	case "ping":
+		return socketReply{Type: "pong"}
+
+	case "subscribe":
+		reply := socketReply{Type: "subscribed"}
+		var snapshots []jobUpdate
+		for _, rawID := range req.JobIDs {
+			parsed, err := uuid.Parse(rawID)
+			if err != nil {
+				reply.Rejected = append(reply.Rejected, rawID)
+				continue
+			}
+			jobID := parsed.String()
+			if subscribed[jobID] {
+				reply.JobIDs = append(reply.JobIDs, jobID)
+				continue
+			}
+			if len(subscribed) >= maxSubscriptions {
+				reply.Rejected = append(reply.Rejected, rawID)
+				continue
+			}
+
+			jobUpdates.subscribe(jobID, sub)
+			var job models.TranscodingJob
+			if err := fetchVisible(h.DB, "id", jobID, scope, &job); err != nil {
+				jobUpdates.unsubscribe(jobID, sub)
+				if !errors.Is(err, errNotOwned) {
+					log.Printf("Error retrieving transcoding job %s for socket subscription: %v", jobID, err)
+				}
+				reply.Rejected = append(reply.Rejected, rawID)
+				continue
+			}
+			subscribed[jobID] = true
+			reply.JobIDs = append(reply.JobIDs, jobID)
+			snapshots = append(snapshots, newJobUpdate(&job))
+		}
+		if len(reply.Rejected) > 0 {
+			reply.Message = "Some jobs were not found, are not visible to you or are over the subscription limit"
+		}
+		// The reply goes first so the client knows its subscriptions before the states arrive
+		if !send(reply) {
+			return reply
+		}
+		for _, snapshot := range snapshots {
+			if !send(snapshot) {
+				break
+			}
+		}
+		return socketReply{Type: "snapshot_complete"}
+
+	case "unsubscribe":
+		reply := socketReply{Type: "unsubscribed"}
+		for _, rawID := range req.JobIDs {
+			if parsed, err := uuid.Parse(rawID); err == nil && subscribed[parsed.String()] {
+				jobUpdates.unsubscribe(parsed.String(), sub)
+				delete(subscribed, parsed.String())
+				reply.JobIDs = append(reply.JobIDs, parsed.String())
+			}
+		}
+		return reply
+
+	default:
+		return socketReply{Type: "error", Message: "Unknown action: " + req.Action}
+	}
+}
+
+// socketWriteTimeout bounds each write so a stalled client cannot block the socket
+const socketWriteTimeout = 10 * time.Second
+
+func writeSocketJSON(ws *websocket.Conn, message interface{}) error {
+	ws.SetWriteDeadline(time.Now().Add(socketWriteTimeout))
+	return websocket.JSON.Send(ws, message)
+}
+
+func writeSocketPing(ws *websocket.Conn) error {
+	ws.SetWriteDeadline(time.Now().Add(socketWriteTimeout))
+	ws.PayloadType = websocket.PingFrame
+	defer func() { ws.PayloadType = websocket.TextFrame }()
+	_, err := ws.Write(nil)
+	return err
+}
+
+// idleTimeoutConn fails a read when the client has sent nothing for timeout. Pongs
+// are consumed inside the websocket package, so the deadline is renewed on every
+// read of the raw connection instead.
+type idleTimeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *idleTimeoutConn) Read(b []byte) (int, error) {
+	c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Read(b)
+}
+
+// hijackedWriter hands an already hijacked connection to websocket.Server, which
+// insists on hijacking the ResponseWriter itself
+type hijackedWriter struct {
+	http.ResponseWriter
+	conn net.Conn
+	buf  *bufio.ReadWriter
+}
+
+func newHijackedWriter(w http.ResponseWriter, conn net.Conn, buf *bufio.ReadWriter, idleTimeout time.Duration) *hijackedWriter {
+	idle := &idleTimeoutConn{Conn: conn, timeout: idleTimeout}
+
+	// Keep any bytes the HTTP server already read past the request
+	reader := io.Reader(idle)
+	if pending := buf.Reader.Buffered(); pending > 0 {
+		early, _ := buf.Reader.Peek(pending)
+		reader = io.MultiReader(bytes.NewReader(bytes.Clone(early)), idle)
+	}
+
+	return &hijackedWriter{
+		ResponseWriter: w,
+		conn:           idle,
+		buf:            bufio.NewReadWriter(bufio.NewReader(reader), bufio.NewWriter(idle)),
+	}
+}
+
+func (w *hijackedWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.conn, w.buf, nil
+}
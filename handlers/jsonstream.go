@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// jsonArrayStream writes a JSON array one element at a time, so list endpoints can
+// encode rows as they are read instead of holding the whole result in memory
+type jsonArrayStream struct {
+	w     io.Writer
+	count int
+}
+
+func newJSONArrayStream(w io.Writer) *jsonArrayStream {
+	return &jsonArrayStream{w: w}
+}
+
+// Write appends one element
+func (s *jsonArrayStream) Write(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	separator := ","
+	if s.count == 0 {
+		separator = "["
+	}
+	if _, err := io.WriteString(s.w, separator); err != nil {
+		return err
+	}
+	s.count++
+	_, err = s.w.Write(data)
+	return err
+}
+
+// Close ends the array; an array without elements is written as []
+func (s *jsonArrayStream) Close() error {
+	end := "]"
+	if s.count == 0 {
+		end = "[]"
+	}
+	_, err := io.WriteString(s.w, end)
+	return err
+}
+
+// pageMetadata is pageResponse without its items, written after a streamed array
+type pageMetadata struct {
+	Total           int64 `json:"total"`
+	Page            int   `json:"page"`
+	PageSize        int   `json:"page_size"`
+	DefaultPageSize int   `json:"default_page_size"`
+	MaxPageSize     int   `json:"max_page_size"`
+}
+
+// sentWriter records whether anything has been passed on to the response yet
+type sentWriter struct {
+	w    io.Writer
+	sent bool
+}
+
+func (s *sentWriter) Write(p []byte) (int, error) {
+	s.sent = true
+	return s.w.Write(p)
+}
+
+// streamList writes the same body as listBody, with the items produced by writeItems
+// as they are read. Headers must be set before calling it. When writeItems fails
+// before any of the body has been sent, nothing is written and the error is returned
+// so the caller can answer with an error status. Once bytes are out the status cannot
+// change, so a later failure aborts the response (the client sees a cut-off body
+// rather than a valid but incomplete list).
+func streamList(w http.ResponseWriter, total int64, page, pageSize int, paginate bool, writeItems func(*jsonArrayStream) error) error {
+	out := &sentWriter{w: w}
+	buffered := bufio.NewWriterSize(out, 32*1024)
+	if paginate {
+		io.WriteString(buffered, `{"items":`)
+	}
+
+	items := newJSONArrayStream(buffered)
+	if err := writeItems(items); err != nil {
+		if !out.sent {
+			return err
+		}
+		panic(http.ErrAbortHandler)
+	}
+	items.Close()
+
+	if paginate {
+		defaultSize, maxSize := pageSizeLimits()
+		metadata, _ := json.Marshal(pageMetadata{
+			Total:           total,
+			Page:            page,
+			PageSize:        pageSize,
+			DefaultPageSize: defaultSize,
+			MaxPageSize:     maxSize,
+		})
+		io.WriteString(buffered, ",")
+		buffered.Write(metadata[1:])
+	}
+	io.WriteString(buffered, "\n")
+	buffered.Flush()
+	return nil
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStreamListMatchesListBody(t *testing.T) {
+	items := []map[string]int{{"n": 1}, {"n": 2}, {"n": 3}}
+	for _, paginate := range []bool{false, true} {
+		rec := httptest.NewRecorder()
+		err := streamList(rec, 7, 2, 3, paginate, func(s *jsonArrayStream) error {
+			for _, item := range items {
+				if err := s.Write(item); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("streamList(paginate=%v): %v", paginate, err)
+		}
+
+		want, _ := json.Marshal(listBody(items, 7, 2, 3, paginate))
+		if got := rec.Body.String(); got != string(want)+"\n" {
+			t.Errorf("paginate=%v:\n got %s\nwant %s", paginate, got, want)
+		}
+	}
+}
+
+func TestStreamListEmpty(t *testing.T) {
+	rec := httptest.NewRecorder()
+	if err := streamList(rec, 0, 1, 20, false, func(*jsonArrayStream) error { return nil }); err != nil {
+		t.Fatalf("streamList: %v", err)
+	}
+	if got := rec.Body.String(); got != "[]\n" {
+		t.Errorf("empty list = %q, want []", got)
+	}
+}
+
+// A failure before anything reached the client leaves the response untouched, so the
+// handler can still send a proper error
+func TestStreamListEarlyErrorIsReturned(t *testing.T) {
+	errRead := errors.New("read failed")
+	rec := httptest.NewRecorder()
+
+	err := streamList(rec, 10, 1, 20, true, func(s *jsonArrayStream) error {
+		s.Write(map[string]string{"n": "first"})
+		return errRead
+	})
+	if !errors.Is(err, errRead) {
+		t.Fatalf("streamList = %v, want the writeItems error", err)
+	}
+	if rec.Body.Len() != 0 || rec.Flushed {
+		t.Errorf("response already has %q", rec.Body.String())
+	}
+}
+
+// Once part of the body has been sent the status cannot change, so the handler aborts
+func TestStreamListLateErrorAborts(t *testing.T) {
+	rec := httptest.NewRecorder()
+	defer func() {
+		if recovered := recover(); recovered != http.ErrAbortHandler {
+			t.Fatalf("recovered %v, want http.ErrAbortHandler", recovered)
+		}
+		if rec.Body.Len() == 0 {
+			t.Errorf("abort without any body sent")
+		}
+	}()
+
+	streamList(rec, 10, 1, 20, false, func(s *jsonArrayStream) error {
+		// More than the 32KiB buffer, so part of it has been sent
+		for i := 0; i < 100; i++ {
+			s.Write(strings.Repeat("x", 1024))
+		}
+		return errors.New("read failed")
+	})
+	t.Fatal("streamList returned after a late failure")
+}
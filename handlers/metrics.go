@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	loginTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_login_total",
+		Help: "Login attempts by result (success, invalid_credentials, locked, invalid_request, rate_limited, error).",
+	}, []string{"result"})
+
+	registerTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_register_total",
+		Help: "Registration attempts by result (success, user_exists, invalid_request, invalid_invite, disabled, rate_limited, error).",
+	}, []string{"result"})
+
+	downstreamDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "downstream_request_duration_seconds",
+		Help: "Duration of calls to the analyze and transcode services, measured until response headers arrive.",
+	}, []string{"service", "status_code"})
+)
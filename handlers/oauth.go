@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"auth-service/audit"
+	"auth-service/middleware"
+	"auth-service/models"
+	"auth-service/oauth"
+	"auth-service/signing"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// oauthStateCookie carries the state of an OAuth flow between login and callback
+const oauthStateCookie = "oauth_state"
+
+// oauthStateMaxAge is how long (seconds) a user has to complete the provider's consent page
+const oauthStateMaxAge = 10 * 60
+
+var errOAuthEmailUnverified = errors.New("provider did not return a verified email address")
+
+// errOAuthRegistrationClosed is returned when an OAuth login would create an account
+// while open registration is off
+var errOAuthRegistrationClosed = errors.New("registration is closed")
+
+// oauthFlow is the per-flow data kept in the signed state cookie between login and callback
+type oauthFlow struct {
+	Provider string `json:"p"`
+	State    string `json:"s"`
+	Nonce    string `json:"n"`
+	// Redirect is where the callback sends the browser, with the token in the fragment
+	Redirect string `json:"r,omitempty"`
+}
+
+// OAuthLogin starts an OAuth flow. It generates a random state and nonce, stores them in
+// a signed, short-lived cookie and redirects to the provider's consent page. An optional
+// ?redirect_uri= must be allowed by OAUTH_REDIRECT_ALLOWLIST.
+func (h *Handler) OAuthLogin(w http.ResponseWriter, r *http.Request) {
+	provider, ok := h.OAuth.Get(mux.Vars(r)["provider"])
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "unknown_provider", "Unknown OAuth provider")
+		return
+	}
+
+	redirect, err := oauthRedirectTarget(r)
+	if err != nil {
+		log.Printf("Rejected %s OAuth login with redirect_uri %q from %s", provider.Name(), r.URL.Query().Get("redirect_uri"), middleware.ClientIP(r))
+		writeJSONError(w, http.StatusBadRequest, "invalid_redirect_uri", "redirect_uri is not an allowed redirect target")
+		return
+	}
+
+	state, err := newSecureToken()
+	if err != nil {
+		log.Printf("Failed to generate OAuth state: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+	nonce, err := newSecureToken()
+	if err != nil {
+		log.Printf("Failed to generate OAuth nonce: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+
+	payload, _ := json.Marshal(oauthFlow{Provider: provider.Name(), State: state, Nonce: nonce, Redirect: redirect})
+	cookieValue := h.oauthStateSigner().Sign(payload, time.Now().Add(oauthStateMaxAge*time.Second))
+
+	http.SetCookie(w, oauthCookie(r, provider.Name(), cookieValue, oauthStateMaxAge))
+	http.Redirect(w, r, provider.AuthURL(state, nonce), http.StatusFound)
+}
+
+// OAuthCallback completes an OAuth flow. The state must match the signed cookie set by
+// OAuthLogin (login-CSRF protection) before the code is exchanged, and an ID token, if
+// the provider returns one, must carry the flow's nonce. The provider
+// identity is then linked to an account and a JWT is issued as for password login. When
+// the flow has a redirect target the browser is sent there with #token=<jwt>.
+func (h *Handler) OAuthCallback(w http.ResponseWriter, r *http.Request) {
+	provider, ok := h.OAuth.Get(mux.Vars(r)["provider"])
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "unknown_provider", "Unknown OAuth provider")
+		return
+	}
+
+	// The state is single-use whatever the outcome
+	flow, flowErr := h.readOAuthFlow(r)
+	http.SetCookie(w, oauthCookie(r, provider.Name(), "", -1))
+
+	query := r.URL.Query()
+	state := query.Get("state")
+	if flowErr != nil || flow.Provider != provider.Name() || state == "" ||
+		subtle.ConstantTimeCompare([]byte(state), []byte(flow.State)) != 1 {
+		log.Printf("Rejected %s OAuth callback with invalid state from %s", provider.Name(), middleware.ClientIP(r))
+		writeJSONError(w, http.StatusBadRequest, "invalid_state", "Invalid or expired OAuth state")
+		return
+	}
+
+	if providerErr := query.Get("error"); providerErr != "" {
+		writeJSONError(w, http.StatusBadRequest, "oauth_denied", "Authorization was denied: "+providerErr)
+		return
+	}
+
+	code := query.Get("code")
+	if code == "" {
+		writeJSONError(w, http.StatusBadRequest, "code_required", "Authorization code is required")
+		return
+	}
+
+	token, err := provider.Exchange(r.Context(), code)
+	if err != nil {
+		log.Printf("%s OAuth code exchange failed: %v", provider.Name(), err)
+		writeJSONError(w, http.StatusBadGateway, "oauth_exchange_failed", "Could not complete sign-in with the provider")
+		return
+	}
+
+	// Bind the ID token to this flow when the provider issues one
+	if verifier, ok := provider.(oauth.NonceVerifier); ok {
+		if err := verifier.VerifyNonce(token, flow.Nonce); err != nil {
+			log.Printf("Rejected %s OAuth callback from %s: %v", provider.Name(), middleware.ClientIP(r), err)
+			writeJSONError(w, http.StatusBadRequest, "invalid_nonce", "OAuth response does not belong to this sign-in")
+			return
+		}
+	}
+
+	profile, err := provider.FetchUser(r.Context(), token)
+	if err != nil {
+		log.Printf("Failed to fetch %s OAuth profile: %v", provider.Name(), err)
+		writeJSONError(w, http.StatusBadGateway, "oauth_profile_failed", "Could not load the provider profile")
+		return
+	}
+
+	user, err := h.oauthUser(provider.Name(), profile)
+	if err != nil {
+		if errors.Is(err, errOAuthEmailUnverified) {
+			writeJSONError(w, http.StatusForbidden, "email_not_verified", "The provider account has no verified email address")
+			return
+		}
+		if errors.Is(err, errOAuthRegistrationClosed) {
+			writeJSONError(w, http.StatusForbidden, "registration_disabled", "Registration is disabled")
+			return
+		}
+		log.Printf("Failed to sign in %s OAuth user: %v", provider.Name(), err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+
+	if user.DeletedAt.Valid {
+		writeJSONError(w, http.StatusForbidden, "account_deleted", "Account has been deleted")
+		return
+	}
+	if user.IsSuspended() {
+		writeJSONError(w, http.StatusForbidden, "account_suspended", "Account has been suspended")
+		return
+	}
+
+	jwtToken, err := h.generateJWT(user.ID, user.Email, user.Role)
+	if err != nil {
+		log.Printf("Failed to generate token: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to generate token")
+		return
+	}
+
+	log.Printf("User %d signed in with %s from %s", user.ID, provider.Name(), middleware.ClientIP(r))
+	audit.Record(r, audit.ForUser(audit.ActionLoginSucceeded, user.ID).By(user.ID).With("method", provider.Name()))
+
+	// The fragment keeps the token out of server logs and Referer headers
+	if flow.Redirect != "" {
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, flow.Redirect+"#"+url.Values{"token": {jwtToken}}.Encode(), http.StatusFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.AuthResponse{Token: jwtToken, User: *user})
+}
+
+// oauthUser returns the account linked to the provider identity. Unknown identities
+// are linked to the account with the same verified email, or get a new account.
+func (h *Handler) oauthUser(providerName string, profile *oauth.User) (*models.User, error) {
+	var user models.User
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		var identity models.OAuthIdentity
+		err := tx.Where("provider = ? AND provider_user_id = ?", providerName, profile.ProviderUserID).First(&identity).Error
+		if err == nil {
+			return tx.Unscoped().First(&user, identity.UserID).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		// Only a verified address may claim an existing account
+		if profile.Email == "" || !profile.EmailVerified {
+			return errOAuthEmailUnverified
+		}
+		email := strings.TrimSpace(profile.Email)
+
+		err = tx.Unscoped().Where("email = ?", email).First(&user).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// Without open registration only existing accounts can be linked
+			if !registrationEnabled() || inviteRequired() {
+				return errOAuthRegistrationClosed
+			}
+
+			// OAuth-only accounts get an unusable random password
+			randomPassword, err := newSecureToken()
+			if err != nil {
+				return err
+			}
+			hashedPassword, err := hashPassword(randomPassword)
+			if err != nil {
+				return err
+			}
+
+			// The provider has already verified the address
+			verifiedAt := time.Now()
+			user = models.User{
+				Email:           email,
+				Password:        hashedPassword,
+				Role:            models.RoleUser,
+				Status:          models.UserStatusActive,
+				EmailVerifiedAt: &verifiedAt,
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+
+		return tx.Create(&models.OAuthIdentity{
+			UserID:         user.ID,
+			Provider:       providerName,
+			ProviderUserID: profile.ProviderUserID,
+			Email:          email,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// oauthStateSigner signs state cookies with a key derived from the JWT secret
+func (h *Handler) oauthStateSigner() *signing.Signer {
+	return signing.New(h.JWT.Secret, "oauth-state")
+}
+
+// readOAuthFlow verifies the signed state cookie and decodes its flow data
+func (h *Handler) readOAuthFlow(r *http.Request) (*oauthFlow, error) {
+	cookie, err := r.Cookie(oauthStateCookie)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := h.oauthStateSigner().Verify(cookie.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	var flow oauthFlow
+	if err := json.Unmarshal(payload, &flow); err != nil {
+		return nil, err
+	}
+	return &flow, nil
+}
+
+// oauthCookie builds the state cookie, scoped to the provider's OAuth routes.
+// A negative maxAge deletes it.
+func oauthCookie(r *http.Request, providerName, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    value,
+		Path:     "/auth/oauth/" + providerName,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || strings.HasPrefix(getEnv("APP_BASE_URL", ""), "https://"),
+		// Lax keeps the cookie on the top-level redirect back from the provider
+		SameSite: http.SameSiteLaxMode,
+	}
+}
@@ -0,0 +1,552 @@
+package handlers
+
+import (
+	"auth-service/audit"
+	"auth-service/mail"
+	"auth-service/middleware"
+	"auth-service/models"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// errAlreadyInOrg is returned when a user who already has an organization would join another
+	errAlreadyInOrg = errors.New("user is already a member of an organization")
+	// errLastOrgAdmin is returned when a change would leave an organization without an admin
+	errLastOrgAdmin = errors.New("an organization must keep at least one admin")
+)
+
+// orgMember is one member in organization responses
+type orgMember struct {
+	ID      uint   `json:"id"`
+	Email   string `json:"email"`
+	OrgRole string `json:"org_role"`
+}
+
+// organizationResponse is an organization with its members
+type organizationResponse struct {
+	models.Organization
+	Members []orgMember `json:"members"`
+}
+
+// callerOrg returns the caller's user ID, organization and org role. When adminOnly is
+// set the caller must be an org admin. On failure it writes the error response and
+// returns ok=false.
+func callerOrg(w http.ResponseWriter, r *http.Request, adminOnly bool) (userID, orgID uint, role string, ok bool) {
+	userID, ok = middleware.UserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, "invalid_user_context", "Invalid user context")
+		return 0, 0, "", false
+	}
+
+	orgID, role, ok = middleware.OrgFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "not_in_organization", "You are not a member of an organization")
+		return 0, 0, "", false
+	}
+	if adminOnly && role != models.OrgRoleAdmin {
+		writeJSONError(w, http.StatusForbidden, "org_admin_required", "Organization admin access required")
+		return 0, 0, "", false
+	}
+	return userID, orgID, role, true
+}
+
+// orgMemberID parses the member ID in the URL path
+func orgMemberID(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	memberID, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_id", "Invalid user ID")
+		return 0, false
+	}
+	return uint(memberID), true
+}
+
+// keepsOrgAdmin fails with errLastOrgAdmin when memberID is the organization's only
+// admin, so demoting or removing them would leave it unmanaged. The admin rows stay
+// locked until tx ends, so two admins demoting each other cannot both pass.
+func keepsOrgAdmin(tx *gorm.DB, orgID, memberID uint) error {
+	var admins []uint
+	if err := tx.Model(&models.User{}).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("org_id = ? AND org_role = ?", orgID, models.OrgRoleAdmin).
+		Pluck("id", &admins).Error; err != nil {
+		return err
+	}
+	if len(admins) == 1 && admins[0] == memberID {
+		return errLastOrgAdmin
+	}
+	return nil
+}
+
+// inviteEmail is the form invite addresses are stored and matched in, so an invite
+// reaches the account whatever case either was typed in
+func inviteEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// orgMembers lists the members of an organization in ID order
+func orgMembers(db *gorm.DB, orgID uint) ([]orgMember, error) {
+	members := []orgMember{}
+	err := db.Model(&models.User{}).
+		Select("id", "email", "org_role").
+		Where("org_id = ?", orgID).
+		Order("id").
+		Scan(&members).Error
+	return members, err
+}
+
+// CreateOrganization creates an organization with the caller as its first admin.
+// Users belong to at most one organization.
+// Body: {"name": "..."}
+func (h *Handler) CreateOrganization(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, "invalid_user_context", "Invalid user context")
+		return
+	}
+
+	var req models.CreateOrganizationRequest
+	limitBody(w, r)
+	if err := decodeJSON(r, &req); err != nil {
+		writeBodyError(w, err, "Invalid JSON")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		writeJSONError(w, http.StatusBadRequest, "validation_failed", "Organization name is required")
+		return
+	}
+	if len(req.Name) > 255 {
+		writeJSONError(w, http.StatusBadRequest, "validation_failed", "Organization name must be at most 255 characters")
+		return
+	}
+
+	org := models.Organization{Name: req.Name, CreatedBy: userID}
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&org).Error; err != nil {
+			return err
+		}
+		// Only join if the caller is not already in an organization
+		result := tx.Model(&models.User{}).
+			Where("id = ? AND org_id IS NULL", userID).
+			Updates(map[string]interface{}{"org_id": org.ID, "org_role": models.OrgRoleAdmin})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errAlreadyInOrg
+		}
+		return nil
+	})
+	if errors.Is(err, errAlreadyInOrg) {
+		writeJSONError(w, http.StatusConflict, "already_in_organization", "You are already a member of an organization")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to create organization for user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to create organization")
+		return
+	}
+
+	log.Printf("Organization %d created by user %d", org.ID, userID)
+	audit.Record(r, audit.Event{Action: audit.ActionOrgCreated, TargetType: "organization", TargetID: strconv.FormatUint(uint64(org.ID), 10)})
+
+	members, err := orgMembers(h.DB, org.ID)
+	if err != nil {
+		log.Printf("Failed to list members of organization %d: %v", org.ID, err)
+		members = []orgMember{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(organizationResponse{Organization: org, Members: members})
+}
+
+// GetOrganization returns the caller's organization and its members
+func (h *Handler) GetOrganization(w http.ResponseWriter, r *http.Request) {
+	_, orgID, _, ok := callerOrg(w, r, false)
+	if !ok {
+		return
+	}
+
+	var org models.Organization
+	if err := h.DB.First(&org, orgID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSONError(w, http.StatusNotFound, "not_in_organization", "You are not a member of an organization")
+			return
+		}
+		log.Printf("Failed to load organization %d: %v", orgID, err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+
+	members, err := orgMembers(h.DB, orgID)
+	if err != nil {
+		log.Printf("Failed to list members of organization %d: %v", orgID, err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(organizationResponse{Organization: org, Members: members})
+}
+
+// InviteOrgMember invites an email address to the caller's organization (org admin
+// only). Nobody is added until the invitee accepts (see AcceptOrgInvite), and the
+// response is the same whether or not an account with that address exists. Inviting
+// the same address again refreshes the pending invite. The role defaults to member.
+// Body: {"email": "...", "role": "member|manager|admin"}
+func (h *Handler) InviteOrgMember(w http.ResponseWriter, r *http.Request) {
+	adminID, orgID, _, ok := callerOrg(w, r, true)
+	if !ok {
+		return
+	}
+
+	if ok, retryAfter := orgInviteLimiter().Allow(strconv.FormatUint(uint64(orgID), 10)); !ok {
+		writeRateLimited(w, retryAfter)
+		return
+	}
+
+	var req models.InviteOrgMemberRequest
+	limitBody(w, r)
+	if err := decodeJSON(r, &req); err != nil {
+		writeBodyError(w, err, "Invalid JSON")
+		return
+	}
+	req.Email = strings.TrimSpace(req.Email)
+	if req.Email == "" {
+		writeJSONError(w, http.StatusBadRequest, "validation_failed", "Email is required")
+		return
+	}
+	if !strings.Contains(req.Email, "@") || len(req.Email) > 255 {
+		writeJSONError(w, http.StatusBadRequest, "invalid_email", "Invalid email format")
+		return
+	}
+	if req.Role == "" {
+		req.Role = models.OrgRoleMember
+	}
+	if !models.IsValidOrgRole(req.Role) {
+		writeJSONError(w, http.StatusBadRequest, "invalid_role", "Role must be member, manager or admin")
+		return
+	}
+
+	var org models.Organization
+	if err := h.DB.First(&org, orgID).Error; err != nil {
+		log.Printf("Failed to load organization %d: %v", orgID, err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+
+	invite := models.OrgInvite{
+		OrgID:     orgID,
+		Email:     inviteEmail(req.Email),
+		Role:      req.Role,
+		InvitedBy: adminID,
+		ExpiresAt: time.Now().Add(getEnvDuration("ORG_INVITE_TTL", 7*24*time.Hour)),
+		CreatedAt: time.Now(),
+	}
+	err := h.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "org_id"}, {Name: "email"}},
+		DoUpdates: clause.AssignmentColumns([]string{"role", "invited_by", "expires_at", "created_at"}),
+	}).Create(&invite).Error
+	if err != nil {
+		log.Printf("Failed to invite to organization %d: %v", orgID, err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to invite member")
+		return
+	}
+
+	// A failed email is only logged; the invite is listed to the invitee either way
+	inviter, _ := middleware.EmailFromContext(r.Context())
+	link := getEnv("APP_BASE_URL", "http://localhost:8080") + "/auth/org/invites"
+	data := mail.OrgInvite{Link: link, Organization: org.Name, Role: req.Role, InvitedBy: inviter, ExpiresAt: invite.ExpiresAt}
+	if err := h.sendEmail(r.Context(), req.Email, data); err != nil {
+		log.Printf("Failed to send invite email for organization %d: %v", orgID, err)
+	}
+
+	log.Printf("Invite to organization %d as %s sent by user %d", orgID, req.Role, adminID)
+	audit.Record(r, audit.Event{Action: audit.ActionOrgMemberInvited, TargetType: "organization", TargetID: strconv.FormatUint(uint64(orgID), 10)}.
+		With("email", req.Email).With("role", req.Role))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(orgInviteSent{Email: req.Email, Role: req.Role, ExpiresAt: invite.ExpiresAt})
+}
+
+// orgInviteSent is the response to an invite; it says nothing about the invitee's account
+type orgInviteSent struct {
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// orgInvite is one pending invite in the invitee's list
+type orgInvite struct {
+	ID        uint      `json:"id"`
+	OrgID     uint      `json:"org_id"`
+	OrgName   string    `json:"org_name"`
+	Role      string    `json:"role"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Per-organization invite limiter, created on first use from ORG_INVITE_RATE_LIMIT, so
+// an organization cannot be used to mail arbitrary addresses in bulk
+var (
+	orgInviteLimiterOnce sync.Once
+	orgInviteLimit       *middleware.RateLimiter
+)
+
+func orgInviteLimiter() *middleware.RateLimiter {
+	orgInviteLimiterOnce.Do(func() {
+		orgInviteLimit = middleware.NewRateLimiter(getEnvInt("ORG_INVITE_RATE_LIMIT", 20), time.Hour)
+	})
+	return orgInviteLimit
+}
+
+// invitee loads the caller's account for the invite endpoints. Invites are addressed
+// to an email, so only a verified address may see or accept them. On failure it
+// writes the error response and returns ok=false.
+func (h *Handler) invitee(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, "invalid_user_context", "Invalid user context")
+		return nil, false
+	}
+
+	var user models.User
+	if err := h.DB.Select("id", "email", "email_verified_at").First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSONError(w, http.StatusNotFound, "user_not_found", "User not found")
+			return nil, false
+		}
+		log.Printf("Database error: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return nil, false
+	}
+	if !user.IsEmailVerified() {
+		writeJSONError(w, http.StatusForbidden, "email_not_verified", "Verify your email address to see and accept organization invites")
+		return nil, false
+	}
+	return &user, true
+}
+
+// orgInviteID parses the invite ID in the URL path
+func orgInviteID(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	inviteID, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_id", "Invalid invite ID")
+		return 0, false
+	}
+	return uint(inviteID), true
+}
+
+// ListOrgInvites returns the pending invites addressed to the caller's verified email
+func (h *Handler) ListOrgInvites(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.invitee(w, r)
+	if !ok {
+		return
+	}
+
+	invites := []orgInvite{}
+	err := h.DB.Table("org_invites").
+		Select("org_invites.id, org_invites.org_id, organizations.name AS org_name, org_invites.role, org_invites.expires_at").
+		Joins("JOIN organizations ON organizations.id = org_invites.org_id").
+		Where("org_invites.email = ? AND org_invites.expires_at > ?", inviteEmail(user.Email), time.Now()).
+		Order("org_invites.id").
+		Scan(&invites).Error
+	if err != nil {
+		log.Printf("Failed to list invites for user %d: %v", user.ID, err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"invites": invites})
+}
+
+// AcceptOrgInvite joins the organization of a pending invite addressed to the caller's
+// verified email, with the invited role. Users belong to at most one organization.
+func (h *Handler) AcceptOrgInvite(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.invitee(w, r)
+	if !ok {
+		return
+	}
+	inviteID, ok := orgInviteID(w, r)
+	if !ok {
+		return
+	}
+
+	var invite models.OrgInvite
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ? AND email = ? AND expires_at > ?", inviteID, inviteEmail(user.Email), time.Now()).First(&invite).Error; err != nil {
+			return err
+		}
+		// The org_id check keeps a concurrent join of another organization out
+		result := tx.Model(&models.User{}).
+			Where("id = ? AND org_id IS NULL", user.ID).
+			Updates(map[string]interface{}{"org_id": invite.OrgID, "org_role": invite.Role})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errAlreadyInOrg
+		}
+		return tx.Delete(&invite).Error
+	})
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		writeJSONError(w, http.StatusNotFound, "invite_not_found", "Invite not found")
+		return
+	case errors.Is(err, errAlreadyInOrg):
+		writeJSONError(w, http.StatusConflict, "already_in_organization", "You are already a member of an organization")
+		return
+	case err != nil:
+		log.Printf("Failed to accept invite %d for user %d: %v", inviteID, user.ID, err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to accept invite")
+		return
+	}
+
+	log.Printf("User %d joined organization %d as %s (invited by user %d)", user.ID, invite.OrgID, invite.Role, invite.InvitedBy)
+	audit.Record(r, audit.ForUser(audit.ActionOrgMemberAdded, user.ID).
+		With("org_id", invite.OrgID).With("role", invite.Role).With("invited_by", invite.InvitedBy))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(orgMember{ID: user.ID, Email: user.Email, OrgRole: invite.Role})
+}
+
+// DeclineOrgInvite deletes a pending invite addressed to the caller's verified email
+func (h *Handler) DeclineOrgInvite(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.invitee(w, r)
+	if !ok {
+		return
+	}
+	inviteID, ok := orgInviteID(w, r)
+	if !ok {
+		return
+	}
+
+	result := h.DB.Where("id = ? AND email = ?", inviteID, inviteEmail(user.Email)).Delete(&models.OrgInvite{})
+	if result.Error != nil {
+		log.Printf("Failed to decline invite %d for user %d: %v", inviteID, user.ID, result.Error)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to decline invite")
+		return
+	}
+	if result.RowsAffected == 0 {
+		writeJSONError(w, http.StatusNotFound, "invite_not_found", "Invite not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UpdateOrgMember changes a member's organization role (org admin only). The last
+// admin cannot be demoted.
+// Body: {"role": "member|manager|admin"}
+func (h *Handler) UpdateOrgMember(w http.ResponseWriter, r *http.Request) {
+	adminID, orgID, _, ok := callerOrg(w, r, true)
+	if !ok {
+		return
+	}
+	memberID, ok := orgMemberID(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateOrgMemberRequest
+	limitBody(w, r)
+	if err := decodeJSON(r, &req); err != nil {
+		writeBodyError(w, err, "Invalid JSON")
+		return
+	}
+	if !models.IsValidOrgRole(req.Role) {
+		writeJSONError(w, http.StatusBadRequest, "invalid_role", "Role must be member, manager or admin")
+		return
+	}
+
+	var member models.User
+	var previousRole string
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ? AND org_id = ?", memberID, orgID).First(&member).Error; err != nil {
+			return err
+		}
+		previousRole = member.OrgRole
+		if req.Role != models.OrgRoleAdmin {
+			if err := keepsOrgAdmin(tx, orgID, memberID); err != nil {
+				return err
+			}
+		}
+		member.OrgRole = req.Role
+		return tx.Model(&member).Update("org_role", req.Role).Error
+	})
+	if !writeOrgMemberError(w, err, memberID, orgID, "Failed to update member") {
+		return
+	}
+
+	log.Printf("User %d in organization %d set to %s by user %d", memberID, orgID, req.Role, adminID)
+	audit.Record(r, audit.ForUser(audit.ActionOrgRoleChanged, memberID).
+		With("org_id", orgID).With("from", previousRole).With("to", req.Role))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(orgMember{ID: member.ID, Email: member.Email, OrgRole: member.OrgRole})
+}
+
+// RemoveOrgMember removes a member from the caller's organization. Org admins may
+// remove anyone and members may remove themselves to leave; the last admin cannot
+// leave. Jobs the member created stay with the organization.
+func (h *Handler) RemoveOrgMember(w http.ResponseWriter, r *http.Request) {
+	userID, orgID, role, ok := callerOrg(w, r, false)
+	if !ok {
+		return
+	}
+	memberID, ok := orgMemberID(w, r)
+	if !ok {
+		return
+	}
+	if memberID != userID && role != models.OrgRoleAdmin {
+		writeJSONError(w, http.StatusForbidden, "org_admin_required", "Organization admin access required")
+		return
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		var member models.User
+		if err := tx.Where("id = ? AND org_id = ?", memberID, orgID).First(&member).Error; err != nil {
+			return err
+		}
+		if err := keepsOrgAdmin(tx, orgID, memberID); err != nil {
+			return err
+		}
+		return tx.Model(&member).Updates(map[string]interface{}{"org_id": nil, "org_role": ""}).Error
+	})
+	if !writeOrgMemberError(w, err, memberID, orgID, "Failed to remove member") {
+		return
+	}
+
+	log.Printf("User %d removed from organization %d by user %d", memberID, orgID, userID)
+	audit.Record(r, audit.ForUser(audit.ActionOrgMemberRemoved, memberID).With("org_id", orgID))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeOrgMemberError answers a failed member change. It returns true when err is nil
+// and the handler should go on to write its success response.
+func writeOrgMemberError(w http.ResponseWriter, err error, memberID, orgID uint, failure string) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		writeJSONError(w, http.StatusNotFound, "member_not_found", "Member not found")
+	case errors.Is(err, errLastOrgAdmin):
+		writeJSONError(w, http.StatusConflict, "last_org_admin", "An organization must keep at least one admin")
+	default:
+		log.Printf("Failed to change member %d of organization %d: %v", memberID, orgID, err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", failure)
+	}
+	return false
+}
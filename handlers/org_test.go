@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"auth-service/mail"
+	"auth-service/middleware"
+	"auth-service/models"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// orgRouter wires the organization routes the way main does
+func orgRouter(h *Handler) *mux.Router {
+	router := mux.NewRouter()
+	router.HandleFunc("/auth/org", middleware.AuthMiddleware(h.CreateOrganization)).Methods("POST")
+	router.HandleFunc("/auth/org", middleware.AuthMiddleware(h.GetOrganization)).Methods("GET")
+	router.HandleFunc("/auth/org/members", middleware.AuthMiddleware(h.InviteOrgMember)).Methods("POST")
+	router.HandleFunc("/auth/org/members/{id}", middleware.AuthMiddleware(h.UpdateOrgMember)).Methods("PATCH")
+	router.HandleFunc("/auth/org/members/{id}", middleware.AuthMiddleware(h.RemoveOrgMember)).Methods("DELETE")
+	router.HandleFunc("/auth/org/invites", middleware.AuthMiddleware(h.ListOrgInvites)).Methods("GET")
+	router.HandleFunc("/auth/org/invites/{id}/accept", middleware.AuthMiddleware(h.AcceptOrgInvite)).Methods("POST")
+	router.HandleFunc("/auth/org/invites/{id}", middleware.AuthMiddleware(h.DeclineOrgInvite)).Methods("DELETE")
+	return router
+}
+
+func TestOrgInviteDoesNotRevealAccounts(t *testing.T) {
+	h := newTestHandler(t)
+	router := orgRouter(h)
+	admin := createUser(t, h, "admin@example.com", "correct horse battery", models.RoleUser)
+	createUser(t, h, "bob@example.com", "correct horse battery", models.RoleUser)
+	adminToken := tokenFor(t, h, admin)
+
+	if rec := serve(t, router.ServeHTTP, http.MethodPost, "/auth/org", models.CreateOrganizationRequest{Name: "Acme"}, adminToken); rec.Code != http.StatusCreated {
+		t.Fatalf("create organization: got %d %s", rec.Code, rec.Body.String())
+	}
+
+	invite := func(email string) map[string]interface{} {
+		rec := serve(t, router.ServeHTTP, http.MethodPost, "/auth/org/members", models.InviteOrgMemberRequest{Email: email}, adminToken)
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("invite %s: got %d %s", email, rec.Code, rec.Body.String())
+		}
+		var body map[string]interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decode invite response: %v", err)
+		}
+		delete(body, "email")
+		delete(body, "expires_at")
+		return body
+	}
+
+	existing, unknown := invite("bob@example.com"), invite("nobody@example.com")
+	if !reflect.DeepEqual(existing, unknown) {
+		t.Fatalf("responses differ: existing %v, unknown %v", existing, unknown)
+	}
+
+	// Nobody joins until the invite is accepted
+	var bob models.User
+	if err := h.DB.Where("email = ?", "bob@example.com").First(&bob).Error; err != nil {
+		t.Fatalf("load bob: %v", err)
+	}
+	if bob.OrgID != nil {
+		t.Fatalf("invite added bob to organization %d", *bob.OrgID)
+	}
+
+	sent := h.Mail.Mailer.(*mail.Capture).Messages()
+	if len(sent) != 2 {
+		t.Fatalf("sent %d emails, want one per invite", len(sent))
+	}
+}
+
+func TestOrgInviteAccept(t *testing.T) {
+	h := newTestHandler(t)
+	router := orgRouter(h)
+	admin := createUser(t, h, "admin@example.com", "correct horse battery", models.RoleUser)
+	bob := createUser(t, h, "bob@example.com", "correct horse battery", models.RoleUser)
+	carol := createUser(t, h, "carol@example.com", "correct horse battery", models.RoleUser)
+	adminToken, bobToken, carolToken := tokenFor(t, h, admin), tokenFor(t, h, bob), tokenFor(t, h, carol)
+
+	serve(t, router.ServeHTTP, http.MethodPost, "/auth/org", models.CreateOrganizationRequest{Name: "Acme"}, adminToken)
+	// The address is matched whatever case the admin typed it in
+	rec := serve(t, router.ServeHTTP, http.MethodPost, "/auth/org/members", models.InviteOrgMemberRequest{Email: "Bob@Example.com", Role: models.OrgRoleManager}, adminToken)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("invite: got %d %s", rec.Code, rec.Body.String())
+	}
+
+	// An unverified address could belong to someone who merely typed it in
+	rec = serve(t, router.ServeHTTP, http.MethodGet, "/auth/org/invites", nil, bobToken)
+	if rec.Code != http.StatusForbidden || errorCode(t, rec) != "email_not_verified" {
+		t.Fatalf("list unverified: got %d %s, want 403 email_not_verified", rec.Code, rec.Body.String())
+	}
+	for _, user := range []models.User{bob, carol} {
+		if err := h.DB.Model(&models.User{}).Where("id = ?", user.ID).Update("email_verified_at", time.Now()).Error; err != nil {
+			t.Fatalf("verify %s: %v", user.Email, err)
+		}
+	}
+
+	rec = serve(t, router.ServeHTTP, http.MethodGet, "/auth/org/invites", nil, bobToken)
+	var list struct {
+		Invites []orgInvite `json:"invites"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || len(list.Invites) != 1 {
+		t.Fatalf("list: got %d %s", rec.Code, rec.Body.String())
+	}
+	got := list.Invites[0]
+	if got.OrgName != "Acme" || got.Role != models.OrgRoleManager {
+		t.Fatalf("invite = %+v, want Acme as manager", got)
+	}
+	acceptPath := "/auth/org/invites/" + strconv.FormatUint(uint64(got.ID), 10) + "/accept"
+
+	// Invites addressed to someone else cannot be accepted
+	rec = serve(t, router.ServeHTTP, http.MethodPost, acceptPath, nil, carolToken)
+	if rec.Code != http.StatusNotFound || errorCode(t, rec) != "invite_not_found" {
+		t.Fatalf("accept by other user: got %d %s, want 404 invite_not_found", rec.Code, rec.Body.String())
+	}
+
+	rec = serve(t, router.ServeHTTP, http.MethodPost, acceptPath, nil, bobToken)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("accept: got %d %s", rec.Code, rec.Body.String())
+	}
+	var joined models.User
+	if err := h.DB.First(&joined, bob.ID).Error; err != nil {
+		t.Fatalf("load bob: %v", err)
+	}
+	if joined.OrgID == nil || joined.OrgRole != models.OrgRoleManager {
+		t.Fatalf("after accept: org_id=%v org_role=%q", joined.OrgID, joined.OrgRole)
+	}
+
+	// The invite is used up
+	rec = serve(t, router.ServeHTTP, http.MethodPost, acceptPath, nil, bobToken)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("second accept: got %d, want 404", rec.Code)
+	}
+}
+
+func TestOrgKeepsLastAdmin(t *testing.T) {
+	h := newTestHandler(t)
+	router := orgRouter(h)
+	alice := createUser(t, h, "alice@example.com", "correct horse battery", models.RoleUser)
+	bob := createUser(t, h, "bob@example.com", "correct horse battery", models.RoleUser)
+	aliceToken := tokenFor(t, h, alice)
+
+	if rec := serve(t, router.ServeHTTP, http.MethodPost, "/auth/org", models.CreateOrganizationRequest{Name: "Acme"}, aliceToken); rec.Code != http.StatusCreated {
+		t.Fatalf("create organization: got %d %s", rec.Code, rec.Body.String())
+	}
+	var org models.User
+	if err := h.DB.First(&org, alice.ID).Error; err != nil {
+		t.Fatalf("load alice: %v", err)
+	}
+	if err := h.DB.Model(&bob).Updates(map[string]interface{}{"org_id": org.OrgID, "org_role": models.OrgRoleAdmin}).Error; err != nil {
+		t.Fatalf("make bob an admin: %v", err)
+	}
+
+	memberPath := func(user models.User) string {
+		return "/auth/org/members/" + strconv.FormatUint(uint64(user.ID), 10)
+	}
+	demote := models.UpdateOrgMemberRequest{Role: models.OrgRoleMember}
+	if rec := serve(t, router.ServeHTTP, http.MethodPatch, memberPath(bob), demote, aliceToken); rec.Code != http.StatusOK {
+		t.Fatalf("demote the other admin: got %d %s", rec.Code, rec.Body.String())
+	}
+
+	// alice is now the only admin and can neither step down nor leave
+	if rec := serve(t, router.ServeHTTP, http.MethodPatch, memberPath(alice), demote, aliceToken); rec.Code != http.StatusConflict {
+		t.Errorf("demote the last admin: got %d %s, want 409", rec.Code, rec.Body.String())
+	}
+	if rec := serve(t, router.ServeHTTP, http.MethodDelete, memberPath(alice), nil, aliceToken); rec.Code != http.StatusConflict {
+		t.Errorf("remove the last admin: got %d %s, want 409", rec.Code, rec.Body.String())
+	}
+}
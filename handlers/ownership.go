@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"auth-service/middleware"
+	"auth-service/models"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"gorm.io/gorm"
+)
+
+// errNotOwned is returned by fetchOwned and fetchVisible when no record with the ID belongs to the user,
+// whether it does not exist or was created by someone else. It wraps
+// gorm.ErrRecordNotFound.
+var errNotOwned = fmt.Errorf("record not found or not owned by user: %w", gorm.ErrRecordNotFound)
+
+// fetchOwned loads into out the record whose idCol equals id and that was created by
+// userID. idCol is interpolated into the query, so it must be a column name constant,
+// never user input.
+func fetchOwned[T any](db *gorm.DB, idCol, id string, userID uint, out *T) error {
+	err := db.Where(idCol+" = ? AND created_by = ?", id, userID).First(out).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errNotOwned
+	}
+	return err
+}
+
+// jobScope describes which jobs a caller may read: their own, plus every job of
+// their organization when their org role allows it
+type jobScope struct {
+	userID  uint
+	orgID   uint
+	orgWide bool
+}
+
+// jobScopeFor builds the read scope of the authenticated user
+func jobScopeFor(r *http.Request, userID uint) jobScope {
+	scope := jobScope{userID: userID}
+	if orgID, role, ok := middleware.OrgFromContext(r.Context()); ok && models.OrgRoleSeesAllJobs(role) {
+		scope.orgID, scope.orgWide = orgID, true
+	}
+	return scope
+}
+
+// apply restricts a job query to the scope
+func (s jobScope) apply(db *gorm.DB) *gorm.DB {
+	if s.orgWide {
+		return db.Where("(created_by = ? OR org_id = ?)", s.userID, s.orgID)
+	}
+	return db.Where("created_by = ?", s.userID)
+}
+
+// fetchVisible is fetchOwned for reads: it also finds organization jobs the caller's
+// org role lets them see. Changes to a job still go through fetchOwned.
+func fetchVisible[T any](db *gorm.DB, idCol, id string, scope jobScope, out *T) error {
+	err := scope.apply(db.Where(idCol+" = ?", id)).First(out).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errNotOwned
+	}
+	return err
+}
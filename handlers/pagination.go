@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// pageSizeLimits returns the default and maximum page_size, configurable with
+// PAGE_SIZE_DEFAULT and PAGE_SIZE_MAX. The default never exceeds the maximum.
+func pageSizeLimits() (defaultSize, maxSize int) {
+	maxSize = getEnvInt("PAGE_SIZE_MAX", maxPageSize)
+	if maxSize < 1 {
+		maxSize = maxPageSize
+	}
+	defaultSize = getEnvInt("PAGE_SIZE_DEFAULT", defaultPageSize)
+	if defaultSize < 1 {
+		defaultSize = defaultPageSize
+	}
+	if defaultSize > maxSize {
+		defaultSize = maxSize
+	}
+	return defaultSize, maxSize
+}
+
+// pageResponse is the envelope returned by paginated list endpoints. PageSize is the
+// effective page size, after capping to MaxPageSize.
+type pageResponse struct {
+	Items           interface{} `json:"items"`
+	Total           int64       `json:"total"`
+	Page            int         `json:"page"`
+	PageSize        int         `json:"page_size"`
+	DefaultPageSize int         `json:"default_page_size"`
+	MaxPageSize     int         `json:"max_page_size"`
+}
+
+// newPageResponse builds the envelope for one page of items
+func newPageResponse(items interface{}, total int64, page, pageSize int) pageResponse {
+	defaultSize, maxSize := pageSizeLimits()
+	return pageResponse{
+		Items:           items,
+		Total:           total,
+		Page:            page,
+		PageSize:        pageSize,
+		DefaultPageSize: defaultSize,
+		MaxPageSize:     maxSize,
+	}
+}
+
+// parsePagination reads the page (1-based) and page_size query parameters. A
+// page_size above the maximum is capped rather than rejected.
+func parsePagination(r *http.Request) (page, pageSize int, err error) {
+	defaultSize, maxSize := pageSizeLimits()
+	page, pageSize = 1, defaultSize
+
+	if value := r.URL.Query().Get("page"); value != "" {
+		page, err = strconv.Atoi(value)
+		if err != nil || page < 1 {
+			return 0, 0, fmt.Errorf("page must be a positive integer")
+		}
+	}
+
+	if value := r.URL.Query().Get("page_size"); value != "" {
+		pageSize, err = strconv.Atoi(value)
+		if err != nil || pageSize < 1 {
+			return 0, 0, fmt.Errorf("page_size must be a positive integer")
+		}
+		if pageSize > maxSize {
+			pageSize = maxSize
+		}
+	}
+
+	return page, pageSize, nil
+}
+
+// parseListPagination is parsePagination for list endpoints that predate pagination:
+// they return every item unless the client passes page or page_size, so paginate is
+// false when neither is present
+func parseListPagination(r *http.Request) (page, pageSize int, paginate bool, err error) {
+	query := r.URL.Query()
+	if query.Get("page") == "" && query.Get("page_size") == "" {
+		return 0, 0, false, nil
+	}
+	page, pageSize, err = parsePagination(r)
+	return page, pageSize, err == nil, err
+}
+
+// listBody returns the response body for such an endpoint: the bare items, or a
+// pageResponse envelope when paginating
+func listBody(items interface{}, total int64, page, pageSize int, paginate bool) interface{} {
+	if !paginate {
+		return items
+	}
+	return newPageResponse(items, total, page, pageSize)
+}
+
+// setPaginationHeaders sets X-Total-Count and an RFC 8288 Link header with first, prev,
+// next and last page URLs. Links are relative to the request and keep its other query
+// parameters.
+func setPaginationHeaders(w http.ResponseWriter, r *http.Request, page, pageSize int, total int64) {
+	w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+
+	lastPage := int((total + int64(pageSize) - 1) / int64(pageSize))
+	if lastPage < 1 {
+		lastPage = 1
+	}
+
+	pageURL := func(n int) string {
+		query := r.URL.Query()
+		query.Set("page", strconv.Itoa(n))
+		query.Set("page_size", strconv.Itoa(pageSize))
+		return r.URL.Path + "?" + query.Encode()
+	}
+
+	links := []string{fmt.Sprintf(`<%s>; rel="first"`, pageURL(1))}
+	if page > 1 {
+		prev := page - 1
+		if prev > lastPage {
+			prev = lastPage
+		}
+		links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, pageURL(prev)))
+	}
+	if page < lastPage {
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, pageURL(page+1)))
+	}
+	links = append(links, fmt.Sprintf(`<%s>; rel="last"`, pageURL(lastPage)))
+
+	w.Header().Set("Link", strings.Join(links, ", "))
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hash algorithms selectable with PASSWORD_HASH_ALGORITHM
+const (
+	passwordAlgorithmArgon2id = "argon2id"
+	passwordAlgorithmBcrypt   = "bcrypt"
+)
+
+// argon2idPrefix starts every argon2id hash. Hashes are stored in the PHC string
+// format, $argon2id$v=19$m=<KiB>,t=<iterations>,p=<threads>$<salt>$<key>, so the
+// algorithm and parameters travel with the hash. bcrypt hashes start with $2a$/$2b$.
+const argon2idPrefix = "$argon2id$"
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// Upper bounds on argon2id parameters. Stored and imported hashes carry their own
+// parameters, so without a cap a single hash could make every login attempt against
+// it allocate gigabytes or run for minutes.
+const (
+	argon2MaxMemory     = 1024 * 1024 // KiB, 1 GiB
+	argon2MaxIterations = 10
+)
+
+// errPasswordMismatch is returned when a password does not match its stored hash
+var errPasswordMismatch = errors.New("password does not match")
+
+// argon2Params are the argon2id cost parameters
+type argon2Params struct {
+	memory      uint32 // KiB
+	iterations  uint32
+	parallelism uint8
+}
+
+// passwordAlgorithm returns the algorithm used for new hashes (PASSWORD_HASH_ALGORITHM)
+func passwordAlgorithm() string {
+	switch algorithm := getEnv("PASSWORD_HASH_ALGORITHM", passwordAlgorithmArgon2id); algorithm {
+	case passwordAlgorithmArgon2id, passwordAlgorithmBcrypt:
+		return algorithm
+	default:
+		log.Printf("Unknown PASSWORD_HASH_ALGORITHM %q, using %s", algorithm, passwordAlgorithmArgon2id)
+		return passwordAlgorithmArgon2id
+	}
+}
+
+// configuredArgon2Params returns the argon2id parameters from ARGON2_MEMORY_KIB,
+// ARGON2_ITERATIONS and ARGON2_PARALLELISM. The defaults follow the OWASP baseline.
+func configuredArgon2Params() argon2Params {
+	params := argon2Params{memory: 64 * 1024, iterations: 3, parallelism: 2}
+	if memory := getEnvInt("ARGON2_MEMORY_KIB", int(params.memory)); memory >= 8*1024 && memory <= argon2MaxMemory {
+		params.memory = uint32(memory)
+	}
+	if iterations := getEnvInt("ARGON2_ITERATIONS", int(params.iterations)); iterations >= 1 && iterations <= argon2MaxIterations {
+		params.iterations = uint32(iterations)
+	}
+	if parallelism := getEnvInt("ARGON2_PARALLELISM", int(params.parallelism)); parallelism >= 1 && parallelism <= 255 {
+		params.parallelism = uint8(parallelism)
+	}
+	return params
+}
+
+// bcryptCost returns the configured bcrypt work factor (BCRYPT_COST), falling back
+// to bcrypt.DefaultCost when it is unset or outside bcrypt's supported range
+func bcryptCost() int {
+	cost := getEnvInt("BCRYPT_COST", bcrypt.DefaultCost)
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		log.Printf("BCRYPT_COST %d is outside %d-%d, using default %d", cost, bcrypt.MinCost, bcrypt.MaxCost, bcrypt.DefaultCost)
+		return bcrypt.DefaultCost
+	}
+	return cost
+}
+
+// hashPassword hashes a plaintext password with the configured algorithm
+func hashPassword(password string) (string, error) {
+	if passwordAlgorithm() == passwordAlgorithmBcrypt {
+		hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost())
+		if err != nil {
+			return "", err
+		}
+		return string(hashed), nil
+	}
+
+	params := configuredArgon2Params()
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, params.iterations, params.memory, params.parallelism, argon2KeyLength)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version,
+		params.memory, params.iterations, params.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// verifyPassword checks a plaintext password against a stored hash of either
+// algorithm. It returns errPasswordMismatch when the password is wrong.
+func verifyPassword(hash, password string) error {
+	if strings.HasPrefix(hash, argon2idPrefix) {
+		params, salt, key, err := decodeArgon2Hash(hash)
+		if err != nil {
+			return err
+		}
+		computed := argon2.IDKey([]byte(password), salt, params.iterations, params.memory, params.parallelism, uint32(len(key)))
+		if subtle.ConstantTimeCompare(computed, key) != 1 {
+			return errPasswordMismatch
+		}
+		return nil
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return errPasswordMismatch
+	}
+	return err
+}
+
+// validPasswordHash reports whether hash is a well-formed bcrypt or argon2id hash
+func validPasswordHash(hash string) bool {
+	if strings.HasPrefix(hash, argon2idPrefix) {
+		_, _, _, err := decodeArgon2Hash(hash)
+		return err == nil
+	}
+	_, err := bcrypt.Cost([]byte(hash))
+	return err == nil
+}
+
+// passwordNeedsRehash reports whether a stored hash should be replaced on the next
+// successful login: it uses a different algorithm than the configured one, or
+// weaker parameters than currently configured
+func passwordNeedsRehash(hash string) bool {
+	algorithm := passwordAlgorithm()
+
+	if strings.HasPrefix(hash, argon2idPrefix) {
+		if algorithm != passwordAlgorithmArgon2id {
+			return true
+		}
+		params, _, _, err := decodeArgon2Hash(hash)
+		if err != nil {
+			return false
+		}
+		want := configuredArgon2Params()
+		return params.memory < want.memory || params.iterations < want.iterations || params.parallelism < want.parallelism
+	}
+
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return false
+	}
+	return algorithm != passwordAlgorithmBcrypt || cost < bcryptCost()
+}
+
+// decodeArgon2Hash parses a PHC-format argon2id hash
+func decodeArgon2Hash(hash string) (argon2Params, []byte, []byte, error) {
+	var params argon2Params
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, errors.New("malformed argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, errors.New("unsupported argon2 version")
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism); err != nil {
+		return params, nil, nil, errors.New("malformed argon2id parameters")
+	}
+	if params.iterations == 0 || params.parallelism == 0 {
+		return params, nil, nil, errors.New("malformed argon2id parameters")
+	}
+	if params.memory > argon2MaxMemory || params.iterations > argon2MaxIterations {
+		return params, nil, nil, errors.New("argon2id parameters exceed the supported maximum")
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, errors.New("malformed argon2id salt")
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, errors.New("malformed argon2id key")
+	}
+	return params, salt, key, nil
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"fmt"
+	"testing"
+)
+
+// argon2Hash builds a PHC-format argon2id hash with the given parameters; the salt
+// and key are fixed, since only the parameters are parsed
+func argon2Hash(memory, iterations, parallelism int) string {
+	return fmt.Sprintf("%sv=19$m=%d,t=%d,p=%d$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U",
+		argon2idPrefix, memory, iterations, parallelism)
+}
+
+func TestDecodeArgon2HashBounds(t *testing.T) {
+	tests := []struct {
+		name  string
+		hash  string
+		valid bool
+	}{
+		{"defaults", argon2Hash(64*1024, 3, 2), true},
+		{"at the maximum", argon2Hash(argon2MaxMemory, argon2MaxIterations, 255), true},
+		{"memory above 1 GiB", argon2Hash(argon2MaxMemory+1, 3, 2), false},
+		{"4 GiB memory", argon2Hash(4*1024*1024-1, 3, 2), false},
+		{"too many iterations", argon2Hash(64*1024, argon2MaxIterations+1, 2), false},
+		{"huge iteration count", argon2Hash(64*1024, 1<<31, 2), false},
+		{"parallelism above 255", argon2Hash(64*1024, 3, 256), false},
+		{"zero iterations", argon2Hash(64*1024, 0, 2), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, _, err := decodeArgon2Hash(tt.hash)
+			if (err == nil) != tt.valid {
+				t.Errorf("decodeArgon2Hash(%q) error = %v, want valid=%v", tt.hash, err, tt.valid)
+			}
+			if got := validPasswordHash(tt.hash); got != tt.valid {
+				t.Errorf("validPasswordHash(%q) = %v, want %v", tt.hash, got, tt.valid)
+			}
+		})
+	}
+}
+
+// A stored hash with parameters beyond the bounds is refused before any work is done
+func TestVerifyPasswordRejectsExcessiveParameters(t *testing.T) {
+	if err := verifyPassword(argon2Hash(argon2MaxMemory*4, 3, 2), "correct horse battery"); err == nil {
+		t.Fatal("verifyPassword accepted a hash asking for 4 GiB")
+	}
+}
+
+func TestConfiguredArgon2ParamsBounds(t *testing.T) {
+	t.Setenv("ARGON2_MEMORY_KIB", "4194304")
+	t.Setenv("ARGON2_ITERATIONS", "50")
+	params := configuredArgon2Params()
+	if params.memory != 64*1024 || params.iterations != 3 {
+		t.Errorf("out-of-range settings gave m=%d t=%d, want the defaults", params.memory, params.iterations)
+	}
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"auth-service/middleware"
+	"auth-service/models"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Limits of the editable profile fields
+const (
+	maxDisplayNameLength = 100
+	maxAvatarURLLength   = 2048
+)
+
+// profilePatchFields are the members a PATCH /auth/profile body may contain.
+// current_password only accompanies an email change.
+var profilePatchFields = map[string]bool{
+	"display_name":     true,
+	"avatar_url":       true,
+	"email":            true,
+	"current_password": true,
+}
+
+// errPatchNotObject is returned for PATCH bodies that are not a JSON object
+var errPatchNotObject = errors.New("body must be a JSON object")
+
+// PatchProfile applies a JSON merge patch (RFC 7396) to the caller's profile: only the
+// fields in the body change, and null clears one. Every field is validated before
+// anything is written. A new email is not applied directly but goes through the same
+// confirmation flow as PUT /auth/profile, which makes the response 202.
+func (h *Handler) PatchProfile(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, "invalid_user_context", "Invalid user context")
+		return
+	}
+
+	var patch map[string]interface{}
+	limitBody(w, r)
+	if err := decodeJSON(r, &patch); err != nil {
+		writeBodyError(w, err, "Invalid JSON")
+		return
+	}
+	if patch == nil {
+		writeValidationError(w, errPatchNotObject)
+		return
+	}
+
+	updates, email, err := validateProfilePatch(patch)
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, userID).Error; err != nil {
+		writeJSONError(w, http.StatusNotFound, "user_not_found", "User not found")
+		return
+	}
+
+	status := http.StatusOK
+	if email != "" && email != user.Email {
+		password, _ := patch["current_password"].(string)
+		if !h.allowEmailChange(w, &user, email, password) {
+			return
+		}
+		if err := h.startEmailChange(r.Context(), &user, email); err != nil {
+			log.Printf("Failed to start email change for user %d: %v", user.ID, err)
+			writeEmailError(w, err, "Failed to update user")
+			return
+		}
+		status = http.StatusAccepted
+	}
+
+	if len(updates) > 0 {
+		if err := h.DB.Model(&user).Updates(updates).Error; err != nil {
+			log.Printf("Failed to update profile of user %d: %v", user.ID, err)
+			writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to update user")
+			return
+		}
+	}
+	if err := h.DB.First(&user, userID).Error; err != nil {
+		log.Printf("Failed to reload user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(user)
+}
+
+// validateProfilePatch checks every member of a profile merge patch and returns the
+// column updates to apply and the requested email, if any. Blank strings clear a
+// field like null does.
+func validateProfilePatch(patch map[string]interface{}) (updates map[string]interface{}, email string, err error) {
+	v := newBodyValidator(patch)
+	updates = make(map[string]interface{})
+
+	var unknown []string
+	for field := range patch {
+		if !profilePatchFields[field] {
+			unknown = append(unknown, field)
+		}
+	}
+	sort.Strings(unknown)
+	for _, field := range unknown {
+		v.fail(field, "unknown", "%s cannot be changed with this endpoint", field)
+	}
+
+	if value, set := v.nullableString("display_name"); set {
+		updates["display_name"] = nil
+		if value != nil {
+			if name := strings.TrimSpace(*value); name != "" {
+				v.maxLength("display_name", name, maxDisplayNameLength)
+				updates["display_name"] = name
+			}
+		}
+	}
+
+	if value, set := v.nullableString("avatar_url"); set {
+		updates["avatar_url"] = nil
+		if value != nil {
+			if avatar := strings.TrimSpace(*value); avatar != "" {
+				if u, err := url.Parse(avatar); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+					v.fail("avatar_url", "url", "avatar_url must be an absolute http or https URL")
+				}
+				v.maxLength("avatar_url", avatar, maxAvatarURLLength)
+				updates["avatar_url"] = avatar
+			}
+		}
+	}
+
+	if _, set := patch["email"]; set {
+		email, _ = v.requiredString("email")
+		email = strings.TrimSpace(email)
+	}
+	if _, set := patch["current_password"]; set {
+		v.optionalString("current_password")
+	}
+
+	return updates, email, v.err()
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"auth-service/middleware"
+	"auth-service/models"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestPatchProfileMovesUpdatedAt(t *testing.T) {
+	h := newTestHandler(t)
+	user := createUser(t, h, "alice@example.com", "correct horse battery", models.RoleUser)
+	if user.CreatedAt.IsZero() || user.UpdatedAt.IsZero() {
+		t.Fatalf("create left timestamps unset: created_at=%v updated_at=%v", user.CreatedAt, user.UpdatedAt)
+	}
+
+	// Age the row so the update is visible regardless of clock resolution
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := h.DB.Model(&models.User{}).Where("id = ?", user.ID).
+		UpdateColumns(map[string]interface{}{"created_at": past, "updated_at": past}).Error; err != nil {
+		t.Fatalf("age user: %v", err)
+	}
+
+	patch := middleware.AuthMiddleware(h.PatchProfile)
+	rec := serve(t, patch, http.MethodPatch, "/auth/profile", map[string]string{"display_name": "Alice"}, tokenFor(t, h, user))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("patch: got %d %s", rec.Code, rec.Body.String())
+	}
+
+	var body models.User
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if !body.CreatedAt.Equal(past) {
+		t.Errorf("created_at = %v, want unchanged %v", body.CreatedAt, past)
+	}
+	if !body.UpdatedAt.After(past) {
+		t.Errorf("updated_at = %v, want after %v", body.UpdatedAt, past)
+	}
+
+	var stored models.User
+	if err := h.DB.First(&stored, user.ID).Error; err != nil {
+		t.Fatalf("load user: %v", err)
+	}
+	if !stored.UpdatedAt.Equal(body.UpdatedAt) {
+		t.Errorf("stored updated_at = %v, response has %v", stored.UpdatedAt, body.UpdatedAt)
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// redactedValue replaces sensitive values in logged payloads
+const redactedValue = "[REDACTED]"
+
+// sensitiveKeyParts marks JSON keys and headers whose values must never be logged
+var sensitiveKeyParts = []string{"password", "token", "authorization", "secret"}
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, part := range sensitiveKeyParts {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactJSON returns body as a string safe for logging, with the values of
+// password, token, authorization and secret fields masked at any depth.
+// Bodies that are not valid JSON are not logged at all.
+func redactJSON(body []byte) string {
+	var payload interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return fmt.Sprintf("[non-JSON body, %d bytes]", len(body))
+	}
+
+	redacted, err := json.Marshal(redactValue(payload))
+	if err != nil {
+		return fmt.Sprintf("[unloggable body, %d bytes]", len(body))
+	}
+	return string(redacted)
+}
+
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, nested := range v {
+			if isSensitiveKey(key) {
+				v[key] = redactedValue
+			} else {
+				v[key] = redactValue(nested)
+			}
+		}
+		return v
+	case []interface{}:
+		for i, nested := range v {
+			v[i] = redactValue(nested)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// redactHeaders returns a copy of headers with sensitive values masked
+func redactHeaders(headers http.Header) http.Header {
+	redacted := make(http.Header, len(headers))
+	for name, values := range headers {
+		if isSensitiveKey(name) || strings.EqualFold(name, "Cookie") {
+			redacted[name] = []string{redactedValue}
+			continue
+		}
+		redacted[name] = values
+	}
+	return redacted
+}
+
+// debugf logs only when LOG_LEVEL=debug. Payloads passed to it must go through
+// redactJSON / redactHeaders first.
+func debugf(format string, args ...interface{}) {
+	if strings.EqualFold(getEnv("LOG_LEVEL", "info"), "debug") {
+		log.Printf("[debug] "+format, args...)
+	}
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRedactJSONMasksPasswords(t *testing.T) {
+	body := `{"email":"alice@example.com","password":"hunter2hunter2","profile":{"new_password":"s3cret-value"},"items":[{"access_token":"abc.def.ghi"}]}`
+
+	got := redactJSON([]byte(body))
+	for _, secret := range []string{"hunter2hunter2", "s3cret-value", "abc.def.ghi"} {
+		if strings.Contains(got, secret) {
+			t.Errorf("redacted body %s still contains %q", got, secret)
+		}
+	}
+	if !strings.Contains(got, `"password":"[REDACTED]"`) {
+		t.Errorf("redacted body %s does not mask password", got)
+	}
+	if !strings.Contains(got, "alice@example.com") {
+		t.Errorf("redacted body %s lost a field that is not sensitive", got)
+	}
+}
+
+func TestRedactJSONSkipsInvalidBodies(t *testing.T) {
+	got := redactJSON([]byte(`password=hunter2hunter2`))
+	if strings.Contains(got, "hunter2hunter2") {
+		t.Fatalf("non-JSON body logged as %q", got)
+	}
+}
+
+func TestRedactHeaders(t *testing.T) {
+	headers := http.Header{
+		"Authorization": {"Bearer abc.def.ghi"},
+		"Cookie":        {"session=xyz"},
+		"X-Request-Id":  {"req-1"},
+	}
+
+	got := redactHeaders(headers)
+	if got.Get("Authorization") != redactedValue || got.Get("Cookie") != redactedValue {
+		t.Errorf("sensitive headers not masked: %v", got)
+	}
+	if got.Get("X-Request-Id") != "req-1" {
+		t.Errorf("X-Request-Id = %q, want it kept", got.Get("X-Request-Id"))
+	}
+	if headers.Get("Authorization") != "Bearer abc.def.ghi" {
+		t.Errorf("redactHeaders modified its input")
+	}
+}
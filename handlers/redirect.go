@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var errRedirectNotAllowed = errors.New("redirect_uri is not on the allowlist")
+
+// oauthRedirectTarget returns where the browser goes after an OAuth sign-in started by
+// r: its ?redirect_uri= when OAUTH_REDIRECT_ALLOWLIST allows it, otherwise
+// OAUTH_DEFAULT_REDIRECT_URL. "" means the callback answers with JSON instead.
+func oauthRedirectTarget(r *http.Request) (string, error) {
+	target := r.URL.Query().Get("redirect_uri")
+	if target == "" {
+		return getEnv("OAUTH_DEFAULT_REDIRECT_URL", ""), nil
+	}
+	if !redirectAllowed(target, strings.Split(getEnv("OAUTH_REDIRECT_ALLOWLIST", ""), ",")) {
+		return "", errRedirectNotAllowed
+	}
+	return target, nil
+}
+
+// redirectAllowed reports whether target is an absolute https URL (http is accepted
+// for localhost only) matching one of allowlist's entries. An entry is a host
+// ("app.example.com", "localhost:3000"), a host with a path prefix
+// ("app.example.com/oauth/done") or a wildcard for subdomains ("*.example.com").
+// URLs with credentials, a fragment or dot segments ("/done/../admin") never match.
+func redirectAllowed(target string, allowlist []string) bool {
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" || u.User != nil || u.Fragment != "" || u.Opaque != "" {
+		return false
+	}
+	for _, segment := range strings.Split(u.Path, "/") {
+		if segment == "." || segment == ".." {
+			return false
+		}
+	}
+	host := strings.ToLower(u.Host)
+	switch u.Scheme {
+	case "https":
+	case "http":
+		if name := strings.ToLower(u.Hostname()); name != "localhost" && !isLoopbackIP(name) {
+			return false
+		}
+	default:
+		return false
+	}
+
+	for _, entry := range allowlist {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		entryHost, entryPath, _ := strings.Cut(entry, "/")
+		if !hostMatches(host, entryHost) {
+			continue
+		}
+		if entryPath == "" || pathHasPrefix(u.EscapedPath(), "/"+strings.TrimSuffix(entryPath, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostMatches compares a URL host (with port, if any) to an allowlist host. A
+// "*.example.com" pattern matches subdomains of example.com but not example.com.
+func hostMatches(host, pattern string) bool {
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return host == pattern
+}
+
+// pathHasPrefix reports whether path is prefix or below it, on segment boundaries
+func pathHasPrefix(path, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+func isLoopbackIP(host string) bool {
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"auth-service/audit"
+	"auth-service/middleware"
+	"auth-service/models"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// errInvalidInvite is returned when an invite code is unknown, used or expired
+var errInvalidInvite = errors.New("invalid or expired invite code")
+
+// registrationEnabled reports whether self-service signups are open (REGISTRATION_ENABLED).
+// Admins can create accounts either way.
+func registrationEnabled() bool {
+	return getEnv("REGISTRATION_ENABLED", "true") != "false"
+}
+
+// inviteRequired reports whether Register demands a single-use invite code
+func inviteRequired() bool {
+	return getEnv("REGISTRATION_INVITE_REQUIRED", "false") == "true"
+}
+
+// validateCredentials checks the email and password of a new account. It returns the
+// error code and message to report, or empty strings when both are acceptable.
+func validateCredentials(email, password string) (code, message string) {
+	if email == "" || password == "" {
+		return "validation_failed", "Email and password are required"
+	}
+	if !strings.Contains(email, "@") {
+		return "invalid_email", "Invalid email format"
+	}
+	if len(password) < 6 {
+		return "validation_failed", "Password must be at least 6 characters"
+	}
+	return "", ""
+}
+
+// redeemInvite marks an unused, unexpired invite code as used by the user. It must run
+// in the transaction that creates the user so a code is consumed at most once.
+func redeemInvite(tx *gorm.DB, code string, userID uint) error {
+	now := time.Now()
+	result := tx.Model(&models.InviteCode{}).
+		Where("code_hash = ? AND used_at IS NULL AND expires_at > ?", hashToken(code), now).
+		Updates(map[string]interface{}{"used_by": userID, "used_at": now})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errInvalidInvite
+	}
+	return nil
+}
+
+// CreateInvite issues a single-use invite code (admin only). The code is only returned
+// here; it expires after INVITE_CODE_TTL (7 days by default).
+func (h *Handler) CreateInvite(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, "invalid_user_context", "Invalid user context")
+		return
+	}
+
+	code, err := newSecureToken()
+	if err != nil {
+		log.Printf("Failed to generate invite code: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to create invite")
+		return
+	}
+
+	invite := models.InviteCode{
+		CodeHash:  hashToken(code),
+		CreatedBy: adminID,
+		ExpiresAt: time.Now().Add(getEnvDuration("INVITE_CODE_TTL", 7*24*time.Hour)),
+	}
+	if err := h.DB.Create(&invite).Error; err != nil {
+		log.Printf("Failed to store invite code: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to create invite")
+		return
+	}
+
+	log.Printf("Invite %d created by user %d from %s", invite.ID, adminID, middleware.ClientIP(r))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(struct {
+		models.InviteCode
+		Code string `json:"code"`
+	}{invite, code})
+}
+
+// CreateUser creates an account directly (admin only). It works while registration
+// is disabled and does not need an invite code.
+// Body: {"email", "password", "role", "must_change_password"}
+func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateUserRequest
+	limitBody(w, r)
+	if err := decodeJSON(r, &req); err != nil {
+		writeBodyError(w, err, "Invalid JSON")
+		return
+	}
+
+	req.Email = strings.TrimSpace(req.Email)
+	if code, message := validateCredentials(req.Email, req.Password); code != "" {
+		writeJSONError(w, http.StatusBadRequest, code, message)
+		return
+	}
+
+	if req.Role == "" {
+		req.Role = models.RoleUser
+	}
+	if req.Role != models.RoleUser && req.Role != models.RoleAdmin {
+		writeJSONError(w, http.StatusBadRequest, "invalid_role", "role must be user or admin")
+		return
+	}
+
+	var existing models.User
+	if err := h.DB.Unscoped().Where("email = ?", req.Email).First(&existing).Error; err == nil {
+		writeJSONError(w, http.StatusConflict, "user_exists", "User already exists")
+		return
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("Database error: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+
+	hashedPassword, err := hashPassword(req.Password)
+	if err != nil {
+		log.Printf("Failed to hash password: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to hash password")
+		return
+	}
+
+	user := models.User{
+		Email:              req.Email,
+		Password:           hashedPassword,
+		Role:               req.Role,
+		Status:             models.UserStatusActive,
+		MustChangePassword: req.MustChangePassword,
+	}
+	if err := h.DB.Create(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			writeJSONError(w, http.StatusConflict, "user_exists", "User already exists")
+			return
+		}
+		log.Printf("Failed to create user: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to create user")
+		return
+	}
+
+	if err := h.startEmailVerification(r.Context(), &user); err != nil {
+		log.Printf("Failed to send verification email for user %d: %v", user.ID, err)
+	}
+
+	adminID, _ := middleware.UserIDFromContext(r.Context())
+	log.Printf("User %d (role %s) created by admin %d from %s", user.ID, user.Role, adminID, middleware.ClientIP(r))
+	audit.Record(r, audit.ForUser(audit.ActionUserCreated, user.ID).With("role", user.Role))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(user)
+}
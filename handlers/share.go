@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"auth-service/audit"
+	"auth-service/middleware"
+	"auth-service/models"
+	"auth-service/signing"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// shareLinkResponse is a share link with its token, which is only returned on creation
+type shareLinkResponse struct {
+	models.ShareLink
+	Token string `json:"token"`
+	URL   string `json:"url"`
+}
+
+// shareSigner signs share link tokens
+func (h *Handler) shareSigner() *signing.Signer {
+	return signing.New(h.JWT.Secret, "share-link")
+}
+
+// encodeSharePayload packs the job ID (16 bytes) and link ID (8 bytes) of a share token
+func encodeSharePayload(jobID uuid.UUID, linkID uint) []byte {
+	payload := make([]byte, 24)
+	copy(payload, jobID[:])
+	binary.BigEndian.PutUint64(payload[16:], uint64(linkID))
+	return payload
+}
+
+// decodeSharePayload is the inverse of encodeSharePayload
+func decodeSharePayload(payload []byte) (jobID uuid.UUID, linkID uint, err error) {
+	if len(payload) != 24 {
+		return uuid.Nil, 0, signing.ErrInvalid
+	}
+	copy(jobID[:], payload[:16])
+	return jobID, uint(binary.BigEndian.Uint64(payload[16:])), nil
+}
+
+// CreateShareLink mints a signed link to one of the caller's transcoded videos that
+// works without logging in. It is valid for SHARE_LINK_TTL (24h by default), or for
+// expires_in seconds up to SHARE_LINK_MAX_TTL (7 days).
+// Body (optional): {"expires_in": 3600}
+func (h *Handler) CreateShareLink(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, "invalid_user_context", "Invalid user context")
+		return
+	}
+
+	videoID := mux.Vars(r)["id"]
+	if _, err := uuid.Parse(videoID); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_id", "Invalid video ID format")
+		return
+	}
+
+	var req models.CreateShareLinkRequest
+	limitBody(w, r)
+	if err := decodeJSON(r, &req); err != nil && !errors.Is(err, io.EOF) {
+		writeBodyError(w, err, "Invalid JSON")
+		return
+	}
+
+	ttl := getEnvDuration("SHARE_LINK_TTL", 24*time.Hour)
+	maxTTL := getEnvDuration("SHARE_LINK_MAX_TTL", 7*24*time.Hour)
+	if req.ExpiresIn < 0 {
+		writeJSONError(w, http.StatusBadRequest, "invalid_expiry", "expires_in must be a positive number of seconds")
+		return
+	}
+	// Compared in seconds first: a huge expires_in would overflow the Duration
+	tooLong := float64(req.ExpiresIn) > maxTTL.Seconds()
+	if req.ExpiresIn > 0 && !tooLong {
+		ttl = time.Duration(req.ExpiresIn) * time.Second
+	}
+	if tooLong || ttl > maxTTL {
+		writeJSONError(w, http.StatusBadRequest, "invalid_expiry", fmt.Sprintf("Share links can be valid for at most %d seconds", int(maxTTL.Seconds())))
+		return
+	}
+
+	// Only the creator may share a job
+	var transcodingJob models.TranscodingJob
+	if err := fetchOwned(h.DB, "id", videoID, userID, &transcodingJob); err != nil {
+		if errors.Is(err, errNotOwned) {
+			writeJSONError(w, http.StatusNotFound, "video_not_found", "Video not found or access denied")
+			return
+		}
+		log.Printf("Error retrieving transcoding job %s for user %d: %v", videoID, userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error retrieving video information")
+		return
+	}
+	if transcodingJob.OutputURL == nil || *transcodingJob.OutputURL == "" {
+		writeJSONError(w, http.StatusNotFound, "video_not_ready", "Video is not ready for download")
+		return
+	}
+
+	link := models.ShareLink{
+		JobID:     transcodingJob.ID,
+		CreatedBy: userID,
+		// The token carries whole seconds, so keep the stored expiry in step with it
+		ExpiresAt: time.Now().Add(ttl).Truncate(time.Second),
+	}
+	if err := h.DB.Create(&link).Error; err != nil {
+		log.Printf("Failed to store share link for video %s: %v", transcodingJob.ID, err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to create share link")
+		return
+	}
+
+	token := h.shareSigner().Sign(encodeSharePayload(link.JobID, link.ID), link.ExpiresAt)
+	log.Printf("Share link %d for video %s created by user %d", link.ID, link.JobID, userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(shareLinkResponse{
+		ShareLink: link,
+		Token:     token,
+		URL:       fmt.Sprintf("%s/auth/share/%s", getEnv("APP_BASE_URL", "http://localhost:8080"), token),
+	})
+}
+
+// ListShareLinks lists the share links of one of the caller's videos, newest first.
+// Tokens are not included; revoked and expired links are, until the janitor removes them.
+func (h *Handler) ListShareLinks(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, "invalid_user_context", "Invalid user context")
+		return
+	}
+
+	videoID := mux.Vars(r)["id"]
+	if _, err := uuid.Parse(videoID); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_id", "Invalid video ID format")
+		return
+	}
+
+	links := []models.ShareLink{}
+	if err := h.DB.Where("job_id = ? AND created_by = ?", videoID, userID).
+		Order("created_at DESC").
+		Find(&links).Error; err != nil {
+		log.Printf("Error listing share links for video %s: %v", videoID, err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error retrieving share links")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(links)
+}
+
+// RevokeShareLink stops one of the caller's share links from working
+func (h *Handler) RevokeShareLink(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, "invalid_user_context", "Invalid user context")
+		return
+	}
+
+	vars := mux.Vars(r)
+	if _, err := uuid.Parse(vars["id"]); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_id", "Invalid video ID format")
+		return
+	}
+	linkID, err := strconv.ParseUint(vars["share_id"], 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_id", "Invalid share link ID")
+		return
+	}
+
+	result := h.DB.Model(&models.ShareLink{}).
+		Where("id = ? AND job_id = ? AND created_by = ? AND revoked_at IS NULL", linkID, vars["id"], userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		log.Printf("Failed to revoke share link %d: %v", linkID, result.Error)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to revoke share link")
+		return
+	}
+	if result.RowsAffected == 0 {
+		writeJSONError(w, http.StatusNotFound, "share_link_not_found", "Share link not found or already revoked")
+		return
+	}
+
+	log.Printf("Share link %d revoked by user %d", linkID, userID)
+	audit.Record(r, audit.Event{Action: audit.ActionShareLinkRevoked, TargetType: "share_link", TargetID: strconv.FormatUint(linkID, 10)}.
+		With("job_id", vars["id"]))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// OpenShareLink is the public side of a share link: it checks the token's signature,
+// expiry and revocation, then redirects to a presigned S3 URL for the video. The
+// presigned URL never outlives the link.
+func (h *Handler) OpenShareLink(w http.ResponseWriter, r *http.Request) {
+	payload, err := h.shareSigner().Verify(mux.Vars(r)["token"])
+	if errors.Is(err, signing.ErrExpired) {
+		writeJSONError(w, http.StatusGone, "share_link_expired", "Share link has expired")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "share_link_not_found", "Share link not found")
+		return
+	}
+	jobID, linkID, err := decodeSharePayload(payload)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "share_link_not_found", "Share link not found")
+		return
+	}
+
+	var link models.ShareLink
+	if err := h.DB.Where("id = ? AND job_id = ?", linkID, jobID).First(&link).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSONError(w, http.StatusNotFound, "share_link_not_found", "Share link not found")
+			return
+		}
+		log.Printf("Error loading share link %d: %v", linkID, err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+	now := time.Now()
+	if !link.IsActive(now) {
+		writeJSONError(w, http.StatusGone, "share_link_revoked", "Share link is no longer available")
+		return
+	}
+
+	// Links die with their creator's account, like download tokens: deleted, suspended
+	// or with tokens revoked since the link was made
+	active, err := middleware.AccountActive(link.CreatedBy, link.CreatedAt)
+	if err != nil {
+		log.Printf("Error loading the creator of share link %d: %v", linkID, err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+	if !active {
+		writeJSONError(w, http.StatusGone, "share_link_revoked", "Share link is no longer available")
+		return
+	}
+
+	// A deleted job takes its links with it
+	var transcodingJob models.TranscodingJob
+	if err := h.DB.Where("id = ?", jobID).First(&transcodingJob).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSONError(w, http.StatusNotFound, "share_link_not_found", "Share link not found")
+			return
+		}
+		log.Printf("Error retrieving transcoding job %s for share link %d: %v", jobID, linkID, err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error retrieving video information")
+		return
+	}
+	if transcodingJob.OutputURL == nil || *transcodingJob.OutputURL == "" {
+		writeJSONError(w, http.StatusNotFound, "video_not_ready", "Video is not ready for download")
+		return
+	}
+
+	ttl := getEnvDuration("S3_PRESIGN_TTL", 5*time.Minute)
+	if remaining := link.ExpiresAt.Sub(now); remaining < ttl {
+		ttl = remaining
+	}
+	if !redirectToPresignedOutput(w, r, &transcodingJob, ttl) {
+		return
+	}
+
+	log.Printf("Share link %d opened for video %s from %s", link.ID, jobID, middleware.ClientIP(r))
+}
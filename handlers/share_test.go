@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"auth-service/middleware"
+	"auth-service/models"
+	"encoding/json"
+	"math"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/gorilla/mux"
+)
+
+// shareRouter routes the share link endpoints to h
+func shareRouter(h *Handler) *mux.Router {
+	router := mux.NewRouter()
+	router.HandleFunc("/auth/video/transcode/{id}/share", middleware.AuthMiddleware(h.CreateShareLink)).Methods("POST")
+	router.HandleFunc("/auth/share/{token}", h.OpenShareLink).Methods("GET")
+	return router
+}
+
+func TestShareLinkDiesWithCreatorAccount(t *testing.T) {
+	resetS3Client(t)
+	t.Setenv("AWS_REGION", "eu-west-1")
+	t.Setenv("S3_RESOLVE_BUCKET_REGION", "false")
+	s3Credentials = func() *credentials.Credentials {
+		return credentials.NewStaticCredentials("test-key", "test-secret", "")
+	}
+
+	h := newTestHandler(t)
+	router := shareRouter(h)
+	alice := createUser(t, h, "alice@example.com", "correct horse battery", models.RoleUser)
+	job := createJob(t, h, alice.ID, models.StatusCompleted)
+
+	rec := serve(t, router.ServeHTTP, http.MethodPost, "/auth/video/transcode/"+job.ID.String()+"/share", nil, tokenFor(t, h, alice))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create share link: got %d %s", rec.Code, rec.Body.String())
+	}
+	var created struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decode share link: %v", err)
+	}
+	openPath := "/auth/share/" + created.Token
+
+	if rec := serve(t, router.ServeHTTP, http.MethodGet, openPath, nil, ""); rec.Code != http.StatusFound {
+		t.Fatalf("open share link: got %d %s, want 302", rec.Code, rec.Body.String())
+	}
+
+	if err := h.DB.Model(&alice).Update("status", models.UserStatusSuspended).Error; err != nil {
+		t.Fatalf("suspend alice: %v", err)
+	}
+	rec = serve(t, router.ServeHTTP, http.MethodGet, openPath, nil, "")
+	if rec.Code != http.StatusGone || errorCode(t, rec) != "share_link_revoked" {
+		t.Fatalf("open after suspension: got %d %s, want 410 share_link_revoked", rec.Code, rec.Body.String())
+	}
+}
+
+func TestShareLinkExpiresInOverflow(t *testing.T) {
+	h := newTestHandler(t)
+	router := shareRouter(h)
+	alice := createUser(t, h, "alice@example.com", "correct horse battery", models.RoleUser)
+	job := createJob(t, h, alice.ID, models.StatusCompleted)
+
+	// math.MaxInt64 seconds wraps to a negative Duration when multiplied
+	body := models.CreateShareLinkRequest{ExpiresIn: math.MaxInt64}
+	rec := serve(t, router.ServeHTTP, http.MethodPost, "/auth/video/transcode/"+job.ID.String()+"/share", body, tokenFor(t, h, alice))
+	if rec.Code != http.StatusBadRequest || errorCode(t, rec) != "invalid_expiry" {
+		t.Fatalf("got %d %s, want 400 invalid_expiry", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"auth-service/cache"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// componentStatus is the result of one dependency check in GET /status. Failure
+// details are only logged: they name internal hosts and ports.
+type componentStatus struct {
+	Healthy   bool  `json:"healthy"`
+	LatencyMS int64 `json:"latency_ms"`
+}
+
+// statusResponse is an encoded GET /status answer, reused for STATUS_CACHE_TTL
+type statusResponse struct {
+	code int
+	body []byte
+}
+
+// statusCacheKey is the only key of statusCache
+const statusCacheKey = "status"
+
+// The last GET /status answer. statusMu makes concurrent misses wait for one run of
+// the checks instead of each probing every dependency.
+var (
+	statusOnce  sync.Once
+	statusMu    sync.Mutex
+	statusCache *cache.TTL[string, statusResponse]
+)
+
+// statusCheck probes a single dependency and returns an error when it is unhealthy
+type statusCheck func(ctx context.Context) error
+
+// Ready is the readiness probe: 200 while the database answers within
+// STATUS_CHECK_TIMEOUT, 503 otherwise. Unlike Status it does not depend on the video
+// services, so an outage there does not take every instance out of rotation.
+func (h *Handler) Ready(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), getEnvDuration("STATUS_CHECK_TIMEOUT", 2*time.Second))
+	defer cancel()
+
+	w.Header().Set("Cache-Control", "no-store")
+	if err := h.checkDatabase(ctx); err != nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "not_ready", "Database is unavailable")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ready"})
+}
+
+// Status reports the health of the service's dependencies for dashboards: the
+// database, both video services and, when AWS_S3_BUCKET is set, S3. The checks run
+// concurrently, each bounded by STATUS_CHECK_TIMEOUT (2s by default). Responds 200
+// when every component is healthy and 503 otherwise. The endpoint is public, so the
+// answer is cached for STATUS_CACHE_TTL (5s) and anonymous callers cannot make the
+// service probe its dependencies more often than that.
+func (h *Handler) Status(w http.ResponseWriter, r *http.Request) {
+	statusOnce.Do(func() {
+		statusCache = cache.New[string, statusResponse](getEnvDuration("STATUS_CACHE_TTL", 5*time.Second))
+	})
+
+	statusMu.Lock()
+	response, ok := statusCache.Get(statusCacheKey)
+	if !ok {
+		// Detached from the request: the answer is shared with other callers
+		response = h.checkStatus(context.WithoutCancel(r.Context()))
+		statusCache.Set(statusCacheKey, response)
+	}
+	statusMu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(response.code)
+	w.Write(response.body)
+}
+
+// checkStatus runs the GET /status checks and encodes the answer
+func (h *Handler) checkStatus(ctx context.Context) statusResponse {
+	checks := map[string]statusCheck{
+		"database":  h.checkDatabase,
+		"analyze":   h.checkService(h.Services.AnalyzeURL.String() + getEnv("ANALYZE_HEALTH_PATH", "/health")),
+		"transcode": h.checkService(h.Services.TranscodeURL.String() + getEnv("TRANSCODE_HEALTH_PATH", "/health")),
+	}
+	if bucket := getEnv("AWS_S3_BUCKET", ""); bucket != "" {
+		checks["s3"] = checkS3Bucket(bucket)
+	}
+
+	timeout := getEnvDuration("STATUS_CHECK_TIMEOUT", 2*time.Second)
+	components := make(map[string]componentStatus, len(checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check statusCheck) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check(ctx)
+			status := componentStatus{Healthy: err == nil, LatencyMS: time.Since(start).Milliseconds()}
+			if err != nil {
+				log.Printf("Status check %s failed: %v", name, err)
+			}
+
+			mu.Lock()
+			components[name] = status
+			mu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+
+	overall, statusCode := "ok", http.StatusOK
+	for _, component := range components {
+		if !component.Healthy {
+			overall, statusCode = "degraded", http.StatusServiceUnavailable
+			break
+		}
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"status":     overall,
+		"components": components,
+	})
+	return statusResponse{code: statusCode, body: append(body, '\n')}
+}
+
+// checkDatabase pings the database connection pool
+func (h *Handler) checkDatabase(ctx context.Context) error {
+	sqlDB, err := h.DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// checkService returns a check that expects a 2xx from a video service health URL
+func (h *Handler) checkService(healthURL string) statusCheck {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, healthURL, nil)
+		if err != nil {
+			return err
+		}
+
+		client := h.Downstream
+		if client == nil {
+			client = defaultDownstreamClient
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		io.Copy(io.Discard, io.LimitReader(resp.Body, maxDownstreamErrorBytes))
+
+		if !isSuccess(resp.StatusCode) {
+			return fmt.Errorf("health check returned %d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+		}
+		return nil
+	}
+}
+
+// checkS3Bucket returns a check that issues a HeadBucket for bucket
+func checkS3Bucket(bucket string) statusCheck {
+	return func(ctx context.Context) error {
+		svc, err := s3ClientForBucket(ctx, bucket)
+		if err != nil {
+			return err
+		}
+		_, err = svc.HeadBucketWithContext(ctx, &s3.HeadBucketInput{Bucket: aws.String(bucket)})
+		return err
+	}
+}
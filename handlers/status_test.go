@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// resetStatusCache forgets the cached GET /status answer
+func resetStatusCache(t *testing.T) {
+	t.Helper()
+
+	statusOnce = sync.Once{}
+	t.Cleanup(func() { statusOnce = sync.Once{} })
+}
+
+// GET /status is public, so it must not show why a check failed and must not probe
+// the dependencies on every call
+func TestStatusHidesErrorsAndCaches(t *testing.T) {
+	resetStatusCache(t)
+
+	var probes atomic.Int32
+	transcoder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probes.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer transcoder.Close()
+
+	// A port nothing listens on, so the analyze check fails with a dial error
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	analyzeURL := "http://" + listener.Addr().String()
+	listener.Close()
+
+	t.Setenv("ANALYZE_VIDEO_URL", analyzeURL)
+	t.Setenv("TRANSCODE_VIDEO_URL", transcoder.URL)
+	t.Setenv("AWS_S3_BUCKET", "")
+	t.Setenv("STATUS_CACHE_TTL", "1m")
+	h := newTestHandler(t)
+
+	rec := serve(t, h.Status, http.MethodGet, "/status", nil, "")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("got %d %s, want 503", rec.Code, rec.Body.String())
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, `"analyze":{"healthy":false`) {
+		t.Errorf("body %s does not report analyze as unhealthy", body)
+	}
+	if strings.Contains(body, "error") || strings.Contains(body, listener.Addr().String()) {
+		t.Errorf("body %s reveals the failure", body)
+	}
+
+	again := serve(t, h.Status, http.MethodGet, "/status", nil, "")
+	if again.Code != rec.Code || again.Body.String() != body {
+		t.Errorf("second call got %d %s, want the cached answer", again.Code, again.Body.String())
+	}
+	if got := probes.Load(); got != 1 {
+		t.Errorf("transcode service probed %d times, want once within STATUS_CACHE_TTL", got)
+	}
+}
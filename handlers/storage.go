@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"auth-service/cache"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+var (
+	s3ClientOnce sync.Once
+	s3Session    *session.Session
+	s3Client     *s3.S3
+	s3ClientErr  error
+)
+
+// Bucket regions, resolved on first use, and the S3 client for each region
+var (
+	bucketRegionsOnce  sync.Once
+	bucketRegionMap    map[string]string
+	bucketRegions      *cache.TTL[string, string]
+	bucketRegionMisses *cache.TTL[string, bool]
+
+	regionClientsMu sync.Mutex
+	regionClients   = make(map[string]*s3.S3)
+)
+
+// bucketRegionRetry is how long a failed GetBucketLocation is not retried for a bucket
+const bucketRegionRetry = time.Minute
+
+// bucketRegionTimeout bounds a GetBucketLocation call. The call runs detached from
+// the request that triggered it: its answer is cached for every later request, so a
+// client hanging up must not turn it into a miss.
+const bucketRegionTimeout = 5 * time.Second
+
+// Download slots, created on first use from S3_MAX_CONCURRENT_DOWNLOADS
+var (
+	downloadSlotsOnce sync.Once
+	downloadSlots     chan struct{}
+)
+
+// Downloads streaming through this instance, tracked so a shutdown can wait for them
+var (
+	activeDownloads   atomic.Int64
+	downloadsDraining atomic.Bool
+)
+
+// errDownloadsDraining and errDownloadsBusy are why acquireDownloadSlot refused a download
+var (
+	errDownloadsDraining = errors.New("shutting down")
+	errDownloadsBusy     = errors.New("download limit reached")
+)
+
+// acquireDownloadSlot reserves one of the S3_MAX_CONCURRENT_DOWNLOADS slots for a
+// proxied download without waiting. It returns the function that frees the slot, or
+// an error when every slot is taken or the instance is shutting down. A limit of 0
+// (the default) means unlimited.
+func acquireDownloadSlot() (release func(), err error) {
+	downloadSlotsOnce.Do(func() {
+		if limit := getEnvInt("S3_MAX_CONCURRENT_DOWNLOADS", 0); limit > 0 {
+			downloadSlots = make(chan struct{}, limit)
+		}
+	})
+
+	// Counted before the draining check, so DrainDownloads never misses a download
+	// that slipped in as draining started
+	activeDownloads.Add(1)
+	if downloadsDraining.Load() {
+		activeDownloads.Add(-1)
+		return nil, errDownloadsDraining
+	}
+	if downloadSlots == nil {
+		return func() { activeDownloads.Add(-1) }, nil
+	}
+
+	select {
+	case downloadSlots <- struct{}{}:
+		return func() { <-downloadSlots; activeDownloads.Add(-1) }, nil
+	default:
+		activeDownloads.Add(-1)
+		return nil, errDownloadsBusy
+	}
+}
+
+// StopDownloads makes this instance refuse new downloads with 503, for a shutdown,
+// and returns how many are still streaming
+func StopDownloads() int64 {
+	downloadsDraining.Store(true)
+	return activeDownloads.Load()
+}
+
+// ActiveDownloads returns how many downloads are streaming through this instance
+func ActiveDownloads() int64 {
+	return activeDownloads.Load()
+}
+
+// DrainDownloads waits until every download in progress has finished or ctx is done,
+// and returns how many were still running. Call StopDownloads first.
+func DrainDownloads(ctx context.Context) int64 {
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		active := activeDownloads.Load()
+		if active == 0 {
+			return 0
+		}
+		select {
+		case <-ctx.Done():
+			return active
+		case <-ticker.C:
+		}
+	}
+}
+
+// writeDownloadsBusy answers a download refused because every slot is in use or the
+// instance is shutting down; either way another attempt (or instance) will do
+func writeDownloadsBusy(w http.ResponseWriter, err error) {
+	retryAfter := getEnvDuration("S3_DOWNLOAD_RETRY_AFTER", 5*time.Second)
+	w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+	if errors.Is(err, errDownloadsDraining) {
+		writeJSONError(w, http.StatusServiceUnavailable, "shutting_down", "The service is shutting down, try again shortly")
+		return
+	}
+	writeJSONError(w, http.StatusServiceUnavailable, "too_many_downloads", "Too many downloads in progress, try again later")
+}
+
+// s3Credentials supplies the credentials for the shared S3 client. It can be
+// replaced before the first download, e.g. with an IAM role provider.
+//
+// Static AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY are used when both are set (handy
+// for local development). Otherwise it returns nil so the session falls back to the
+// AWS default credential chain: shared config, web identity (EKS pod roles) and
+// EC2/ECS instance roles.
+var s3Credentials = func() *credentials.Credentials {
+	accessKeyID := getEnv("AWS_ACCESS_KEY_ID", "")
+	secretAccessKey := getEnv("AWS_SECRET_ACCESS_KEY", "")
+	if accessKeyID == "" || secretAccessKey == "" {
+		return nil
+	}
+	return credentials.NewStaticCredentials(accessKeyID, secretAccessKey, getEnv("AWS_SESSION_TOKEN", ""))
+}
+
+// sharedS3Client returns the S3 client for the default AWS_REGION. The AWS session
+// is created on first use and reused by every later request.
+func sharedS3Client() (*s3.S3, error) {
+	s3ClientOnce.Do(func() {
+		if s3Session, s3ClientErr = newS3Session(); s3ClientErr == nil {
+			s3Client = s3.New(s3Session)
+		}
+	})
+	return s3Client, s3ClientErr
+}
+
+// s3ClientForBucket returns an S3 client for the region bucket lives in, so output
+// buckets outside AWS_REGION can be read. The region comes from S3_BUCKET_REGIONS
+// ("bucket=region,..."), else from GetBucketLocation, cached per bucket for
+// S3_BUCKET_REGION_TTL (24h). When that call is not allowed, AWS_REGION is used.
+// S3_RESOLVE_BUCKET_REGION turns the lookup on or off; by default it is off for a
+// custom AWS_S3_ENDPOINT, whose stores rarely have regions.
+func s3ClientForBucket(ctx context.Context, bucket string) (*s3.S3, error) {
+	svc, err := sharedS3Client()
+	if err != nil {
+		return nil, err
+	}
+	region := bucketRegion(ctx, svc, bucket)
+	if region == aws.StringValue(svc.Config.Region) {
+		return svc, nil
+	}
+
+	regionClientsMu.Lock()
+	defer regionClientsMu.Unlock()
+	client, ok := regionClients[region]
+	if !ok {
+		client = s3.New(s3Session, aws.NewConfig().WithRegion(region))
+		regionClients[region] = client
+	}
+	return client, nil
+}
+
+// bucketRegion resolves the region of bucket, falling back to the default client's
+func bucketRegion(ctx context.Context, svc *s3.S3, bucket string) string {
+	bucketRegionsOnce.Do(func() {
+		bucketRegionMap = make(map[string]string)
+		for _, entry := range strings.Split(getEnv("S3_BUCKET_REGIONS", ""), ",") {
+			name, region, ok := strings.Cut(strings.TrimSpace(entry), "=")
+			if name, region = strings.TrimSpace(name), strings.TrimSpace(region); ok && name != "" && region != "" {
+				bucketRegionMap[name] = region
+			}
+		}
+		bucketRegions = cache.New[string, string](getEnvDuration("S3_BUCKET_REGION_TTL", 24*time.Hour))
+		bucketRegionMisses = cache.New[string, bool](bucketRegionRetry)
+	})
+
+	defaultRegion := aws.StringValue(svc.Config.Region)
+	if region, ok := bucketRegionMap[bucket]; ok {
+		return region
+	}
+	resolve := getEnv("AWS_S3_ENDPOINT", "") == ""
+	if value, err := strconv.ParseBool(getEnv("S3_RESOLVE_BUCKET_REGION", "")); err == nil {
+		resolve = value
+	}
+	if !resolve {
+		return defaultRegion
+	}
+	if region, ok := bucketRegions.Get(bucket); ok {
+		return region
+	}
+	if _, ok := bucketRegionMisses.Get(bucket); ok {
+		return defaultRegion
+	}
+
+	lookupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), bucketRegionTimeout)
+	defer cancel()
+	location, err := svc.GetBucketLocationWithContext(lookupCtx, &s3.GetBucketLocationInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		log.Printf("Could not resolve the region of bucket %s, using %s: %v", bucket, defaultRegion, err)
+		bucketRegionMisses.Set(bucket, true)
+		return defaultRegion
+	}
+	// An empty location constraint means us-east-1 and "EU" means eu-west-1
+	region := s3.NormalizeBucketLocation(aws.StringValue(location.LocationConstraint))
+	bucketRegions.Set(bucket, region)
+	return region
+}
+
+// newS3Session creates the AWS session for S3 from the AWS_* environment variables.
+// AWS_S3_ENDPOINT points it at an S3-compatible store such as MinIO or localstack;
+// when unset the regular AWS endpoint for the region is used.
+func newS3Session() (*session.Session, error) {
+	awsRegion := getEnv("AWS_REGION", "us-east-1")
+	cfg := &aws.Config{
+		Region:      aws.String(awsRegion),
+		Credentials: s3Credentials(),
+	}
+
+	if endpoint := getEnv("AWS_S3_ENDPOINT", ""); endpoint != "" {
+		cfg.Endpoint = aws.String(endpoint)
+	}
+	// MinIO and localstack usually need http://host/bucket/key instead of bucket subdomains
+	if forcePathStyle, err := strconv.ParseBool(getEnv("AWS_S3_FORCE_PATH_STYLE", "false")); err == nil && forcePathStyle {
+		cfg.S3ForcePathStyle = aws.Bool(true)
+	}
+
+	return session.NewSession(cfg)
+}
+
+// writeS3Error maps S3 errors to API errors: a missing object is a 404, an
+// unsatisfiable Range is a 416 and anything else is logged and reported as a 500
+func writeS3Error(w http.ResponseWriter, err error, message string) {
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case s3.ErrCodeNoSuchKey, "NotFound":
+			writeJSONError(w, http.StatusNotFound, "video_file_not_found", "Video file not found in storage")
+			return
+		case "InvalidRange":
+			writeJSONError(w, http.StatusRequestedRangeNotSatisfiable, "invalid_range", "Requested range not satisfiable")
+			return
+		}
+	}
+
+	log.Printf("Error getting object from S3: %v", err)
+	writeJSONError(w, http.StatusInternalServerError, "internal_error", message)
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// resetS3Client forgets the shared S3 client so a test can observe its creation
+func resetS3Client(t *testing.T) {
+	t.Helper()
+
+	restore := s3Credentials
+	reset := func() {
+		s3ClientOnce = sync.Once{}
+		s3Session, s3Client, s3ClientErr = nil, nil, nil
+		bucketRegionsOnce = sync.Once{}
+		regionClients = make(map[string]*s3.S3)
+	}
+	reset()
+	t.Cleanup(func() {
+		s3Credentials = restore
+		reset()
+	})
+}
+
+func TestSharedS3ClientCreatedOnce(t *testing.T) {
+	resetS3Client(t)
+	t.Setenv("AWS_REGION", "eu-central-1")
+	t.Setenv("S3_BUCKET_REGIONS", "eu-bucket=eu-west-1")
+
+	var created atomic.Int32
+	s3Credentials = func() *credentials.Credentials {
+		created.Add(1)
+		return credentials.NewStaticCredentials("test-key", "test-secret", "")
+	}
+
+	const callers = 20
+	clients := make([]*s3.S3, callers)
+	var wg sync.WaitGroup
+	for i := range clients {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			client, err := sharedS3Client()
+			if err != nil {
+				t.Errorf("sharedS3Client: %v", err)
+			}
+			clients[i] = client
+		}(i)
+	}
+	wg.Wait()
+
+	if got := created.Load(); got != 1 {
+		t.Fatalf("session created %d times, want once", got)
+	}
+	for i, client := range clients {
+		if client == nil || client != clients[0] {
+			t.Fatalf("caller %d got client %p, want the shared %p", i, client, clients[0])
+		}
+	}
+	if region := *clients[0].Config.Region; region != "eu-central-1" {
+		t.Errorf("region = %q, want AWS_REGION", region)
+	}
+
+	// Clients for buckets in other regions are built from the same session, once per region
+	first, err := s3ClientForBucket(context.Background(), "eu-bucket")
+	if err != nil {
+		t.Fatalf("s3ClientForBucket: %v", err)
+	}
+	second, _ := s3ClientForBucket(context.Background(), "eu-bucket")
+	if first != second || first == clients[0] || *first.Config.Region != "eu-west-1" {
+		t.Errorf("eu-bucket clients %p and %p in %q, want one eu-west-1 client", first, second, *first.Config.Region)
+	}
+	if got := created.Load(); got != 1 {
+		t.Errorf("session created %d times after regional clients, want once", got)
+	}
+}
+
+// A request that is already gone must not make the shared region lookup fail and be
+// cached as a miss for everyone else
+func TestBucketRegionLookupOutlivesRequest(t *testing.T) {
+	resetS3Client(t)
+	t.Setenv("S3_RESOLVE_BUCKET_REGION", "true")
+
+	var lookups atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups.Add(1)
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>` +
+			`<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">eu-west-1</LocationConstraint>`))
+	}))
+	defer server.Close()
+
+	svc := s3.New(session.Must(session.NewSession(aws.NewConfig().
+		WithRegion("us-east-1").
+		WithEndpoint(server.URL).
+		WithS3ForcePathStyle(true).
+		WithCredentials(credentials.NewStaticCredentials("test-key", "test-secret", "")))))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if region := bucketRegion(ctx, svc, "videos"); region != "eu-west-1" {
+		t.Fatalf("region with a cancelled request = %q, want eu-west-1", region)
+	}
+	if region := bucketRegion(context.Background(), svc, "videos"); region != "eu-west-1" || lookups.Load() != 1 {
+		t.Errorf("second lookup = %q after %d calls, want the cached eu-west-1", region, lookups.Load())
+	}
+}
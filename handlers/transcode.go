@@ -1,43 +1,51 @@
 package handlers
 
 import (
-	"auth-service/database"
+	"auth-service/config"
+	"auth-service/middleware"
 	"auth-service/models"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
 // TranscodeVideoProxy redirects requests to the TranscodeVideo handler at http://localhost:4000/video/transcode
-// and adds the user ID to the request body
-func TranscodeVideoProxy(w http.ResponseWriter, r *http.Request) {
+// and adds the user ID to the request body. With ?dry_run=true the spec is validated
+// and the body that would be forwarded is returned, without contacting the service.
+func (h *Handler) TranscodeVideoProxy(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context (set by auth middleware)
-	userID, ok := r.Context().Value("user_id").(float64)
+	userID, ok := middleware.UserIDFromContext(r.Context())
 	if !ok {
-		http.Error(w, "Invalid user context", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "invalid_user_context", "Invalid user context")
 		return
 	}
 
 	// Read the original request body
 	var originalBody map[string]interface{}
 	if r.Body != nil {
+		limitBody(w, r)
 		bodyBytes, err := io.ReadAll(r.Body)
 		if err != nil {
 			log.Printf("Error reading request body: %v", err)
-			http.Error(w, "Error reading request body", http.StatusBadRequest)
+			writeBodyError(w, err, "Error reading request body")
 			return
 		}
 		r.Body.Close()
@@ -46,7 +54,7 @@ func TranscodeVideoProxy(w http.ResponseWriter, r *http.Request) {
 		if len(bodyBytes) > 0 {
 			if err := json.Unmarshal(bodyBytes, &originalBody); err != nil {
 				log.Printf("Error parsing JSON body: %v", err)
-				http.Error(w, "Invalid JSON in request body", http.StatusBadRequest)
+				writeJSONError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON in request body")
 				return
 			}
 		} else {
@@ -56,25 +64,72 @@ func TranscodeVideoProxy(w http.ResponseWriter, r *http.Request) {
 		originalBody = make(map[string]interface{})
 	}
 
-	// Add user ID to the request body
-	originalBody["created_by"] = uint(userID)
+	// Drop fields the client may not set, then reject malformed job specs before they
+	// reach the transcode service
+	sanitizeForwardBody(originalBody, h.Services.TranscodeFields)
+	if err := validateTranscodeSpec(originalBody, h.Services.Transcode); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	applyTranscodeDefaults(originalBody, h.Services.Transcode, h.Services.TranscodeFields)
+
+	// Add user and organization IDs to the request body
+	originalBody["created_by"] = userID
+	setForwardOrg(r, originalBody)
 
 	// Marshal the modified body
 	modifiedBodyBytes, err := json.Marshal(originalBody)
 	if err != nil {
 		log.Printf("Error marshaling modified body: %v", err)
-		http.Error(w, "Error preparing request", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error preparing request")
 		return
 	}
 
+	// The quota applies to dry runs too, so they refuse whatever a real submit would
+	if !h.requireTranscodeQuota(w, userID) {
+		return
+	}
+
+	// A dry run stops here: nothing is forwarded and no idempotency key is used up
+	if r.URL.Query().Get("dry_run") == "true" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(transcodeDryRunResponse{DryRun: true, Payload: json.RawMessage(modifiedBodyBytes)})
+		return
+	}
+
+	// Reserve the idempotency key, or replay the original response for a retried request
+	idempotencyKey := r.Header.Get(IdempotencyKeyHeader)
+	if len(idempotencyKey) > 255 {
+		writeJSONError(w, http.StatusBadRequest, "invalid_idempotency_key", "Idempotency-Key must be at most 255 characters")
+		return
+	}
+	if idempotencyKey != "" {
+		stored, err := h.claimIdempotencyKey(userID, idempotencyKey, modifiedBodyBytes)
+		switch {
+		case errors.Is(err, errIdempotencyInProgress):
+			writeJSONError(w, http.StatusConflict, "idempotency_key_in_use", err.Error())
+			return
+		case errors.Is(err, errIdempotencyMismatch):
+			writeJSONError(w, http.StatusUnprocessableEntity, "idempotency_key_mismatch", err.Error())
+			return
+		case err != nil:
+			log.Printf("Error claiming idempotency key for user %d: %v", userID, err)
+			writeJSONError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+			return
+		case stored != nil:
+			log.Printf("Replaying transcode response for user %d (idempotency key reused)", userID)
+			replayIdempotentResponse(w, stored)
+			return
+		}
+	}
+
 	// Create a new request to the video transcode service
-	var transcodeLink = []byte(getEnv("TRANSCODE_VIDEO_URL", "http://localhost:4000"))
-	transcodeURL := fmt.Sprintf("%s/transcode", transcodeLink)
-	req, err := http.NewRequest(r.Method, transcodeURL, bytes.NewBuffer(modifiedBodyBytes))
+	transcodeURL := h.Services.TranscodeEndpoint("/transcode")
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, transcodeURL, bytes.NewBuffer(modifiedBodyBytes))
 
 	if err != nil {
 		log.Printf("Error creating request: %v", err)
-		http.Error(w, "Error creating request to video service", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error creating request to video service")
 		return
 	}
 
@@ -91,16 +146,35 @@ func TranscodeVideoProxy(w http.ResponseWriter, r *http.Request) {
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Content-Length", fmt.Sprintf("%d", len(modifiedBodyBytes)))
 
+	debugf("Forwarding request to %s: headers=%v body=%s", transcodeURL, redactHeaders(req.Header), redactJSON(modifiedBodyBytes))
+
 	// Make the request to the video transcode service
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := h.doDownstream(serviceTranscode, req)
 	if err != nil {
 		log.Printf("Error making request to video service: %v", err)
-		http.Error(w, "Error connecting to video service", http.StatusBadGateway)
+		if idempotencyKey != "" {
+			if err := h.releaseIdempotencyKey(userID, idempotencyKey); err != nil {
+				log.Printf("Error releasing idempotency key for user %d: %v", userID, err)
+			}
+		}
+		writeJSONError(w, http.StatusBadGateway, "downstream_unavailable", "Error connecting to video service")
 		return
 	}
 	defer resp.Body.Close()
 
+	if !isSuccess(resp.StatusCode) {
+		// Failures are not remembered; the same key can be used to try again
+		if idempotencyKey != "" {
+			if err := h.releaseIdempotencyKey(userID, idempotencyKey); err != nil {
+				log.Printf("Error releasing idempotency key for user %d: %v", userID, err)
+			}
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxDownstreamErrorBytes))
+		writeDownstreamError(w, serviceTranscode, resp.StatusCode, body)
+		return
+	}
+	invalidateProfileStats(&userID)
+
 	// Copy response headers
 	for name, values := range resp.Header {
 		for _, value := range values {
@@ -108,6 +182,29 @@ func TranscodeVideoProxy(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if idempotencyKey != "" {
+		// Buffer the response so it can be stored for replays
+		respBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			log.Printf("Error reading response body: %v", err)
+			if err := h.releaseIdempotencyKey(userID, idempotencyKey); err != nil {
+				log.Printf("Error releasing idempotency key for user %d: %v", userID, err)
+			}
+			writeJSONError(w, http.StatusBadGateway, "downstream_error", "Error reading response from video service")
+			return
+		}
+
+		err = h.completeIdempotencyKey(userID, idempotencyKey, resp.StatusCode, resp.Header.Get("Content-Type"), respBody)
+		if err != nil {
+			log.Printf("Error storing idempotency key for user %d: %v", userID, err)
+		}
+
+		w.WriteHeader(resp.StatusCode)
+		w.Write(respBody)
+		log.Printf("Successfully proxied video transcode request for user %d", userID)
+		return
+	}
+
 	// Set response status code
 	w.WriteHeader(resp.StatusCode)
 
@@ -117,46 +214,440 @@ func TranscodeVideoProxy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("Successfully proxied video transcode request for user %d", uint(userID))
+	log.Printf("Successfully proxied video transcode request for user %d", userID)
 }
 
-func GetVideoTranscodes(w http.ResponseWriter, r *http.Request) {
+// transcodeDryRunResponse is the body of a ?dry_run=true transcode submission:
+// Payload is exactly what would have been sent to the transcode service
+type transcodeDryRunResponse struct {
+	DryRun  bool            `json:"dry_run"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// batchItemResult describes the outcome of a single job spec in a batch submission
+type batchItemResult struct {
+	Index      int    `json:"index"`
+	Success    bool   `json:"success"`
+	StatusCode int    `json:"status_code"`
+	JobID      string `json:"job_id,omitempty"`
+	Error      string `json:"error,omitempty"`
+	// Fields lists the invalid fields when the spec failed validation
+	Fields []fieldError `json:"fields,omitempty"`
+}
+
+// TranscodeVideoBatchProxy accepts an array of transcode job specs, validates each one,
+// adds the user ID and forwards them one by one to the transcode service.
+// It responds with 207 Multi-Status and a per-item result array; a failing item never
+// aborts the rest of the batch.
+func (h *Handler) TranscodeVideoBatchProxy(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context (set by auth middleware)
-	userID, ok := r.Context().Value("user_id").(float64)
+	userID, ok := middleware.UserIDFromContext(r.Context())
 	if !ok {
-		http.Error(w, "Invalid user context", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "invalid_user_context", "Invalid user context")
 		return
 	}
 
-	// Get transcoding jobs from the database filtered by user ID
-	var transcodingJobs []models.TranscodingJob
-	result := database.DB.Where("created_by = ?", uint(userID)).Order("inserted_at DESC").Find(&transcodingJobs)
+	var specs []json.RawMessage
+	limitBody(w, r)
+	if err := decodeJSON(r, &specs); err != nil {
+		writeBodyError(w, err, "Request body must be a JSON array of job specs")
+		return
+	}
 
-	if result.Error != nil {
-		log.Printf("Error retrieving transcoding jobs for user %d: %v", uint(userID), result.Error)
-		http.Error(w, "Error retrieving transcoding jobs", http.StatusInternalServerError)
+	if len(specs) == 0 {
+		writeJSONError(w, http.StatusBadRequest, "validation_failed", "Batch must contain at least one job spec")
+		return
+	}
+
+	maxBatchSize := getEnvInt("TRANSCODE_BATCH_MAX_SIZE", 100)
+	if len(specs) > maxBatchSize {
+		writeJSONError(w, http.StatusBadRequest, "batch_too_large", fmt.Sprintf("Batch exceeds the maximum of %d job specs", maxBatchSize))
 		return
 	}
 
-	// Set response header
+	// Items past the user's quota of pending and processing jobs are refused with 429
+	// instead of being forwarded
+	remaining, maxActive, ok := h.transcodeQuota(w, userID)
+	if !ok {
+		return
+	}
+
+	results := make([]batchItemResult, 0, len(specs))
+	succeeded := 0
+
+	for i, raw := range specs {
+		result := batchItemResult{Index: i}
+
+		var spec map[string]interface{}
+		if err := json.Unmarshal(raw, &spec); err != nil || spec == nil {
+			result.StatusCode = http.StatusBadRequest
+			result.Error = "job spec must be a JSON object"
+			results = append(results, result)
+			continue
+		}
+
+		sanitizeForwardBody(spec, h.Services.TranscodeFields)
+		if err := validateTranscodeSpec(spec, h.Services.Transcode); err != nil {
+			result.StatusCode = http.StatusBadRequest
+			result.Error = err.Error()
+			result.Fields = fieldErrors(err)
+			results = append(results, result)
+			continue
+		}
+		applyTranscodeDefaults(spec, h.Services.Transcode, h.Services.TranscodeFields)
+
+		// Add user and organization IDs to the job spec
+		spec["created_by"] = userID
+		setForwardOrg(r, spec)
+
+		if remaining == 0 {
+			result.StatusCode = http.StatusTooManyRequests
+			result.Error = fmt.Sprintf("active job quota of %d reached", maxActive)
+			results = append(results, result)
+			continue
+		}
+
+		statusCode, body, err := h.forwardTranscodeJob(r, spec)
+		if err != nil {
+			log.Printf("Error forwarding batch item %d for user %d: %v", i, userID, err)
+			result.StatusCode = http.StatusBadGateway
+			result.Error = "error connecting to video service"
+			results = append(results, result)
+			continue
+		}
+
+		result.StatusCode = statusCode
+		if isSuccess(statusCode) {
+			result.Success = true
+			result.JobID = extractJobID(body)
+			succeeded++
+			if remaining > 0 {
+				remaining--
+			}
+		} else {
+			result.Error = downstreamErrorMessage(serviceTranscode, statusCode, body)
+		}
+		results = append(results, result)
+	}
+	if succeeded > 0 {
+		invalidateProfileStats(&userID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusMultiStatus)
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"results": results}); err != nil {
+		log.Printf("Error encoding batch response: %v", err)
+		return
+	}
+
+	log.Printf("Proxied transcode batch for user %d: %d of %d jobs submitted", userID, succeeded, len(specs))
+}
+
+// transcodeOptionsResponse is the body of GET /auth/video/transcode/options
+type transcodeOptionsResponse struct {
+	Codecs         []string `json:"codecs"`
+	Containers     []string `json:"containers"`
+	QualityPresets []string `json:"quality_presets"`
+	// DefaultQualityPreset is used for submissions that do not give one
+	DefaultQualityPreset string `json:"default_quality_preset,omitempty"`
+}
+
+// GetTranscodeOptions lists the target codecs, containers and quality presets that
+// transcode submissions may use, from the same configuration validation reads. The
+// encoded response is cached for CACHE_OPTIONS_TTL, and clients may reuse it as long.
+func (h *Handler) GetTranscodeOptions(w http.ResponseWriter, r *http.Request) {
+	cached, _ := responseCaches()
+	body, ok := cached.Get(transcodeOptionsKey)
+	if !ok {
+		options := h.Services.Transcode
+		encoded, err := json.Marshal(transcodeOptionsResponse{
+			Codecs:               options.Codecs,
+			Containers:           options.Containers,
+			QualityPresets:       options.QualityPresets,
+			DefaultQualityPreset: options.DefaultQualityPreset,
+		})
+		if err != nil {
+			log.Printf("Error encoding transcode options: %v", err)
+			writeJSONError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+			return
+		}
+		body = append(encoded, '\n')
+		cached.Set(transcodeOptionsKey, body)
+	}
+
+	setCacheControl(w, "public", cached.TTL())
 	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
 
-	// Return the transcoding jobs as JSON
-	if err := json.NewEncoder(w).Encode(transcodingJobs); err != nil {
-		log.Printf("Error encoding transcoding jobs response: %v", err)
-		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+// validateTranscodeSpec checks that a job spec carries the fields the transcode service
+// requires, that the target codec and container are among options and that the
+// optional fields have the right types. Every problem is reported, as validationErrors.
+func validateTranscodeSpec(spec map[string]interface{}, options config.TranscodeOptions) error {
+	v := newBodyValidator(spec)
+
+	v.requiredString("source_path")
+	if codec, ok := v.requiredString("target_codec"); ok {
+		v.oneOf("target_codec", codec, options.Codecs)
+	}
+	if container, ok := v.requiredString("target_container"); ok {
+		v.oneOf("target_container", container, options.Containers)
+	}
+	if preset, ok := v.optionalString("quality_preset"); ok {
+		v.oneOf("quality_preset", preset, options.QualityPresets)
+	}
+	v.optionalPositiveInt("bitrate")
+
+	return v.err()
+}
+
+// applyTranscodeDefaults fills in the default quality preset when a validated spec
+// has none, unless the forward allowlist keeps quality_preset from the transcode
+// service. Given presets are lowercased to match the configured list.
+func applyTranscodeDefaults(spec map[string]interface{}, options config.TranscodeOptions, allowed []string) {
+	if preset, ok := spec["quality_preset"].(string); ok {
+		spec["quality_preset"] = strings.ToLower(preset)
+		return
+	}
+	if options.DefaultQualityPreset == "" || (len(allowed) > 0 && !slices.Contains(allowed, "quality_preset")) {
 		return
 	}
+	spec["quality_preset"] = options.DefaultQualityPreset
+}
+
+// transcodeQuota returns how many more jobs the user may submit before holding
+// TRANSCODE_MAX_ACTIVE_JOBS pending or processing ones, and that limit. remaining is
+// -1 when the quota is disabled (0). On failure it writes the error response and
+// returns ok=false.
+func (h *Handler) transcodeQuota(w http.ResponseWriter, userID uint) (remaining, limit int, ok bool) {
+	limit = getEnvInt("TRANSCODE_MAX_ACTIVE_JOBS", 100)
+	if limit <= 0 {
+		return -1, limit, true
+	}
 
-	log.Printf("Successfully retrieved %d transcoding jobs for user %d", len(transcodingJobs), uint(userID))
+	var active int64
+	if err := h.DB.Model(&models.TranscodingJob{}).
+		Where("created_by = ? AND status IN ?", userID, []models.TranscodingJobStatus{models.StatusPending, models.StatusProcessing}).
+		Count(&active).Error; err != nil {
+		log.Printf("Error counting active transcoding jobs for user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return 0, limit, false
+	}
+	return max(limit-int(active), 0), limit, true
 }
 
-// GetVideoTranscodeInfo gets information about a specific transcoding job by ID
-func GetVideoTranscodeInfo(w http.ResponseWriter, r *http.Request) {
+// requireTranscodeQuota checks that the user may submit one more job, and otherwise
+// answers 429 quota_exceeded. It returns false when a response has been written.
+func (h *Handler) requireTranscodeQuota(w http.ResponseWriter, userID uint) bool {
+	remaining, limit, ok := h.transcodeQuota(w, userID)
+	if !ok {
+		return false
+	}
+	if remaining == 0 {
+		writeJSONError(w, http.StatusTooManyRequests, "quota_exceeded", fmt.Sprintf("Active job quota of %d reached", limit))
+		return false
+	}
+	return true
+}
+
+// forwardTranscodeJob sends a single job spec to the transcode service and returns
+// the downstream status code and response body
+func (h *Handler) forwardTranscodeJob(r *http.Request, spec map[string]interface{}) (int, []byte, error) {
+	bodyBytes, err := json.Marshal(spec)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	transcodeURL := h.Services.TranscodeEndpoint("/transcode")
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, transcodeURL, bytes.NewBuffer(bodyBytes))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// Copy headers from the original request (except Authorization)
+	for name, values := range r.Header {
+		if name != "Authorization" && name != "Content-Length" {
+			for _, value := range values {
+				req.Header.Add(name, value)
+			}
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	debugf("Forwarding batch item to %s: body=%s", transcodeURL, redactJSON(bodyBytes))
+
+	resp, err := h.doDownstream(serviceTranscode, req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return resp.StatusCode, respBody, nil
+}
+
+// extractJobID pulls the job identifier out of a transcode service response
+func extractJobID(body []byte) string {
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return ""
+	}
+	for _, key := range []string{"job_id", "id"} {
+		if value, ok := payload[key]; ok && value != nil {
+			return fmt.Sprintf("%v", value)
+		}
+	}
+	return ""
+}
+
+func (h *Handler) GetVideoTranscodes(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by auth middleware)
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, "invalid_user_context", "Invalid user context")
+		return
+	}
+
+	// Resolve the requested ordering against the allowlist
+	orderClause, err := transcodeOrderClause(r.URL.Query().Get("sort"), r.URL.Query().Get("order"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_sort", err.Error())
+		return
+	}
+
+	page, pageSize, paginate, err := parseListPagination(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_pagination", err.Error())
+		return
+	}
+
+	db, err := h.jobsDB(r)
+	if err != nil {
+		writeJSONError(w, http.StatusForbidden, "admin_required", err.Error())
+		return
+	}
+
+	// Get the user's transcoding jobs, or their organization's when their org role allows
+	query := jobScopeFor(r, userID).apply(db.Model(&models.TranscodingJob{}))
+
+	// Optional status filter
+	if status := models.TranscodingJobStatus(r.URL.Query().Get("status")); status != "" {
+		if !status.IsValid() {
+			writeJSONError(w, http.StatusBadRequest, "invalid_status", "Invalid status filter")
+			return
+		}
+		query = query.Where("status = ?", status)
+	}
+
+	// Optional case-insensitive search over source path, codec and GPU.
+	// LOWER/LIKE with an explicit ESCAPE works on both Postgres and SQLite.
+	if q := strings.TrimSpace(r.URL.Query().Get("q")); q != "" {
+		pattern := "%" + escapeLikePattern(strings.ToLower(q)) + "%"
+		query = query.Where(
+			`(LOWER(source_path) LIKE ? ESCAPE '\' OR LOWER(target_codec) LIKE ? ESCAPE '\' OR LOWER(gpu_used) LIKE ? ESCAPE '\')`,
+			pattern, pattern, pattern,
+		)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		log.Printf("Error counting transcoding jobs for user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error retrieving transcoding jobs")
+		return
+	}
+
+	query = query.Order(orderClause)
+	if paginate {
+		query = query.Offset((page - 1) * pageSize).Limit(pageSize)
+		setPaginationHeaders(w, r, page, pageSize, total)
+	} else {
+		w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+	}
+
+	// Rows are encoded as they are read, so a large list is never held in memory
+	rows, err := query.Rows()
+	if err != nil {
+		log.Printf("Error retrieving transcoding jobs for user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error retrieving transcoding jobs")
+		return
+	}
+	defer rows.Close()
+
+	w.Header().Set("Content-Type", "application/json")
+	count := 0
+	err = streamList(w, total, page, pageSize, paginate, func(items *jsonArrayStream) error {
+		for rows.Next() {
+			var job models.TranscodingJob
+			if err := query.ScanRows(rows, &job); err != nil {
+				log.Printf("Error reading transcoding jobs for user %d: %v", userID, err)
+				return err
+			}
+			if err := items.Write(job); err != nil {
+				return err
+			}
+			count++
+		}
+		if err := rows.Err(); err != nil {
+			log.Printf("Error reading transcoding jobs for user %d: %v", userID, err)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		w.Header().Del("X-Total-Count")
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error retrieving transcoding jobs")
+		return
+	}
+
+	log.Printf("Successfully retrieved %d transcoding jobs for user %d", count, userID)
+}
+
+// transcodeSortColumns lists the columns the transcode list may be sorted by.
+// Only these values are ever interpolated into the ORDER BY clause.
+var transcodeSortColumns = map[string]bool{
+	"inserted_at":      true,
+	"updated_at":       true,
+	"status":           true,
+	"duration_seconds": true,
+}
+
+// transcodeOrderClause builds a safe ORDER BY clause from the sort and order query params
+func transcodeOrderClause(sort, order string) (string, error) {
+	if sort == "" {
+		sort = "inserted_at"
+	}
+	if !transcodeSortColumns[sort] {
+		return "", fmt.Errorf("Invalid sort field: %s", sort)
+	}
+
+	switch strings.ToLower(order) {
+	case "", "desc":
+		order = "DESC"
+	case "asc":
+		order = "ASC"
+	default:
+		return "", fmt.Errorf("Invalid sort order: %s", order)
+	}
+
+	return fmt.Sprintf("%s %s", sort, order), nil
+}
+
+// escapeLikePattern escapes LIKE wildcards so user input is matched literally
+func escapeLikePattern(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
+// RetryVideoTranscode resubmits a failed or cancelled transcoding job to the transcode
+// service with its original parameters. The new job is linked to the original via retry_of.
+func (h *Handler) RetryVideoTranscode(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context (set by auth middleware)
-	userID, ok := r.Context().Value("user_id").(float64)
+	userID, ok := middleware.UserIDFromContext(r.Context())
 	if !ok {
-		http.Error(w, "Invalid user context", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "invalid_user_context", "Invalid user context")
 		return
 	}
 
@@ -166,43 +657,141 @@ func GetVideoTranscodeInfo(w http.ResponseWriter, r *http.Request) {
 
 	// Validate UUID format
 	if _, err := uuid.Parse(videoID); err != nil {
-		http.Error(w, "Invalid video ID format", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, "invalid_id", "Invalid video ID format")
 		return
 	}
 
 	// Get transcoding job from database
 	var transcodingJob models.TranscodingJob
-	result := database.DB.Where("id = ? AND created_by = ?", videoID, uint(userID)).First(&transcodingJob)
-
-	if result.Error != nil {
-		if result.Error.Error() == "record not found" {
-			http.Error(w, "Video not found or access denied", http.StatusNotFound)
+	if err := fetchOwned(h.DB, "id", videoID, userID, &transcodingJob); err != nil {
+		if errors.Is(err, errNotOwned) {
+			writeJSONError(w, http.StatusNotFound, "video_not_found", "Video not found or access denied")
 			return
 		}
-		log.Printf("Error retrieving transcoding job %s for user %d: %v", videoID, uint(userID), result.Error)
-		http.Error(w, "Error retrieving video information", http.StatusInternalServerError)
+		log.Printf("Error retrieving transcoding job %s for user %d: %v", videoID, userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error retrieving video information")
+		return
+	}
+
+	if !transcodingJob.Status.IsRetryable() {
+		writeJSONError(w, http.StatusConflict, "job_not_retryable",
+			fmt.Sprintf("Only failed or cancelled jobs can be retried (job is %s)", transcodingJob.Status))
+		return
+	}
+
+	if !h.requireTranscodeQuota(w, userID) {
+		return
+	}
+
+	// Rebuild the original job spec
+	spec := map[string]interface{}{
+		"source_path":      transcodingJob.SourcePath,
+		"target_codec":     transcodingJob.TargetCodec,
+		"target_container": transcodingJob.TargetContainer,
+		"created_by":       userID,
+		"retry_of":         transcodingJob.ID.String(),
+	}
+	setForwardOrg(r, spec)
+	if transcodingJob.QualityPreset != nil {
+		spec["quality_preset"] = *transcodingJob.QualityPreset
+	}
+	if transcodingJob.Bitrate != nil {
+		spec["bitrate"] = *transcodingJob.Bitrate
+	}
+
+	statusCode, body, err := h.forwardTranscodeJob(r, spec)
+	if err != nil {
+		log.Printf("Error making request to video service: %v", err)
+		writeJSONError(w, http.StatusBadGateway, "downstream_unavailable", "Error connecting to video service")
+		return
+	}
+
+	if !isSuccess(statusCode) {
+		writeDownstreamError(w, serviceTranscode, statusCode, body)
 		return
 	}
+	invalidateProfileStats(&userID)
+
+	// Link the new job to the original one
+	if newID, err := uuid.Parse(extractJobID(body)); err == nil {
+		if err := h.DB.Model(&models.TranscodingJob{}).
+			Where("id = ?", newID).
+			Update("retry_of", transcodingJob.ID).Error; err != nil {
+			log.Printf("Error linking retry %s to transcoding job %s: %v", newID, transcodingJob.ID, err)
+		}
+	}
+	log.Printf("Retried transcoding job %s for user %d", transcodingJob.ID, userID)
 
-	// Set response header
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(body)
+}
 
-	// Return the transcoding job as JSON
-	if err := json.NewEncoder(w).Encode(transcodingJob); err != nil {
-		log.Printf("Error encoding transcoding job response: %v", err)
-		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+// GetVideoTranscodeStatuses returns the status of several of the user's transcoding jobs
+// in one query, as a map of job ID to status. IDs that don't exist or belong to someone
+// else are omitted from the map.
+func (h *Handler) GetVideoTranscodeStatuses(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by auth middleware)
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, "invalid_user_context", "Invalid user context")
+		return
+	}
+
+	rawIDs := r.URL.Query().Get("ids")
+	if strings.TrimSpace(rawIDs) == "" {
+		writeJSONError(w, http.StatusBadRequest, "validation_failed", "ids query parameter is required")
+		return
+	}
+
+	var ids []string
+	seen := make(map[string]bool)
+	for _, rawID := range strings.Split(rawIDs, ",") {
+		rawID = strings.TrimSpace(rawID)
+		if rawID == "" {
+			continue
+		}
+		parsed, err := uuid.Parse(rawID)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid_id", fmt.Sprintf("Invalid video ID format: %s", rawID))
+			return
+		}
+		if id := parsed.String(); !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	maxIDs := getEnvInt("TRANSCODE_STATUS_MAX_IDS", 100)
+	if len(ids) > maxIDs {
+		writeJSONError(w, http.StatusBadRequest, "too_many_ids", fmt.Sprintf("At most %d IDs may be requested at once", maxIDs))
+		return
+	}
+
+	var transcodingJobs []models.TranscodingJob
+	result := jobScopeFor(r, userID).apply(h.DB.Select("id", "status").Where("id IN ?", ids)).
+		Find(&transcodingJobs)
+	if result.Error != nil {
+		log.Printf("Error retrieving transcoding job statuses for user %d: %v", userID, result.Error)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error retrieving transcoding jobs")
 		return
 	}
 
-	log.Printf("Successfully retrieved transcoding job %s for user %d", videoID, uint(userID))
+	statuses := make(map[string]models.TranscodingJobStatus, len(transcodingJobs))
+	for _, job := range transcodingJobs {
+		statuses[job.ID.String()] = job.Status
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statuses)
 }
 
-// DownloadVideoFromS3 downloads a video file from S3 and streams it to the client
-func DownloadVideoFromS3(w http.ResponseWriter, r *http.Request) {
+// GetVideoTranscodeInfo gets information about a specific transcoding job by ID
+func (h *Handler) GetVideoTranscodeInfo(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context (set by auth middleware)
-	userID, ok := r.Context().Value("user_id").(float64)
+	userID, ok := middleware.UserIDFromContext(r.Context())
 	if !ok {
-		http.Error(w, "Invalid user context", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "invalid_user_context", "Invalid user context")
 		return
 	}
 
@@ -212,72 +801,113 @@ func DownloadVideoFromS3(w http.ResponseWriter, r *http.Request) {
 
 	// Validate UUID format
 	if _, err := uuid.Parse(videoID); err != nil {
-		http.Error(w, "Invalid video ID format", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, "invalid_id", "Invalid video ID format")
+		return
+	}
+
+	db, err := h.jobsDB(r)
+	if err != nil {
+		writeJSONError(w, http.StatusForbidden, "admin_required", err.Error())
 		return
 	}
 
 	// Get transcoding job from database
 	var transcodingJob models.TranscodingJob
-	result := database.DB.Where("id = ? AND created_by = ?", videoID, uint(userID)).First(&transcodingJob)
-
-	if result.Error != nil {
-		if result.Error.Error() == "record not found" {
-			http.Error(w, "Video not found or access denied", http.StatusNotFound)
+	if err := fetchVisible(db, "id", videoID, jobScopeFor(r, userID), &transcodingJob); err != nil {
+		if errors.Is(err, errNotOwned) {
+			writeJSONError(w, http.StatusNotFound, "video_not_found", "Video not found or access denied")
 			return
 		}
-		log.Printf("Error retrieving transcoding job %s for user %d: %v", videoID, uint(userID), result.Error)
-		http.Error(w, "Error retrieving video information", http.StatusInternalServerError)
+		log.Printf("Error retrieving transcoding job %s for user %d: %v", videoID, userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error retrieving video information")
+		return
+	}
+
+	// Return the transcoding job as JSON, or 304 if the client's copy is current
+	if err := writeJSONWithETag(w, r, transcodingJob); err != nil {
+		log.Printf("Error encoding transcoding job response: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error encoding response")
 		return
 	}
 
+	log.Printf("Successfully retrieved transcoding job %s for user %d", videoID, userID)
+}
+
+// downloadableJob loads the transcoding job named in the URL, if the caller may read it,
+// and checks that it has an output to download. On failure it writes the error response and returns ok=false.
+func (h *Handler) downloadableJob(w http.ResponseWriter, r *http.Request) (job *models.TranscodingJob, userID uint, ok bool) {
+	// Get user ID from context (set by auth middleware)
+	userID, ok = middleware.UserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, "invalid_user_context", "Invalid user context")
+		return nil, 0, false
+	}
+
+	// Get the video ID from URL path
+	vars := mux.Vars(r)
+	videoID := vars["id"]
+
+	// Validate UUID format
+	if _, err := uuid.Parse(videoID); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_id", "Invalid video ID format")
+		return nil, 0, false
+	}
+
+	// Get transcoding job from database
+	var transcodingJob models.TranscodingJob
+	if err := fetchVisible(h.DB, "id", videoID, jobScopeFor(r, userID), &transcodingJob); err != nil {
+		if errors.Is(err, errNotOwned) {
+			writeJSONError(w, http.StatusNotFound, "video_not_found", "Video not found or access denied")
+			return nil, 0, false
+		}
+		log.Printf("Error retrieving transcoding job %s for user %d: %v", videoID, userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error retrieving video information")
+		return nil, 0, false
+	}
+
 	// Check if the transcoding job has an output URL (completed job)
 	if transcodingJob.OutputURL == nil || *transcodingJob.OutputURL == "" {
-		http.Error(w, "Video is not ready for download", http.StatusNotFound)
-		return
+		writeJSONError(w, http.StatusNotFound, "video_not_ready", "Video is not ready for download")
+		return nil, 0, false
 	}
 
-	// Initialize AWS session
-	awsRegion := getEnv("AWS_REGION", "us-east-1")
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String(awsRegion),
-		Credentials: credentials.NewStaticCredentials(
-			getEnv("AWS_ACCESS_KEY_ID", ""),
-			getEnv("AWS_SECRET_ACCESS_KEY", ""),
-			"",
-		),
-	})
+	return &transcodingJob, userID, true
+}
 
-	if err != nil {
-		log.Printf("Error creating AWS session: %v", err)
-		http.Error(w, "Error connecting to storage service", http.StatusInternalServerError)
+// DownloadVideoFromS3 downloads a video file from S3 and streams it to the client
+func (h *Handler) DownloadVideoFromS3(w http.ResponseWriter, r *http.Request) {
+	transcodingJob, userID, ok := h.downloadableJob(w, r)
+	if !ok {
 		return
 	}
+	videoID := transcodingJob.ID.String()
 
-	// Create S3 service client
-	svc := s3.New(sess)
+	// Streams through this service are capped; HEAD requests do not move the body
+	if r.Method != http.MethodHead {
+		release, err := acquireDownloadSlot()
+		if err != nil {
+			log.Printf("Refused download of video %s for user %d: %v", videoID, userID, err)
+			writeDownloadsBusy(w, err)
+			return
+		}
+		defer release()
+	}
 
 	// Parse the S3 URL to get bucket and key
 	outputURL := *transcodingJob.OutputURL
 	bucket, key, err := parseS3URL(outputURL)
 	if err != nil {
 		log.Printf("Error parsing S3 URL %s: %v", outputURL, err)
-		http.Error(w, "Invalid video storage location", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Invalid video storage location")
 		return
 	}
 
-	// Get object from S3
-	input := &s3.GetObjectInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(key),
-	}
-
-	result_s3, err := svc.GetObject(input)
+	svc, err := s3ClientForBucket(r.Context(), bucket)
 	if err != nil {
-		log.Printf("Error getting object from S3: %v", err)
-		http.Error(w, "Error retrieving video file", http.StatusInternalServerError)
+		log.Printf("Error creating AWS session: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error connecting to storage service")
 		return
 	}
-	defer result_s3.Body.Close()
 
 	// Set appropriate headers for video download
 	filename := filepath.Base(key)
@@ -285,15 +915,55 @@ func DownloadVideoFromS3(w http.ResponseWriter, r *http.Request) {
 		filename = fmt.Sprintf("video_%s.mp4", videoID)
 	}
 
-	// Set content type based on file extension
-	contentType := getContentType(filename)
-	w.Header().Set("Content-Type", contentType)
+	// Content-Type is set once the object's stored type is known
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	w.Header().Set("Accept-Ranges", "bytes")
+	setVideoMetadataHeaders(w, transcodingJob)
+
+	// HEAD only reports size and type, without fetching the object body
+	if r.Method == http.MethodHead {
+		head, err := svc.HeadObject(&s3.HeadObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			writeS3Error(w, err, "Error retrieving video file")
+			return
+		}
+		w.Header().Set("Content-Type", objectContentType(head.ContentType, filename))
+		if head.ContentLength != nil {
+			w.Header().Set("Content-Length", fmt.Sprintf("%d", *head.ContentLength))
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// Get object from S3, passing through any byte range the client asked for
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" {
+		input.Range = aws.String(rangeHeader)
+	}
+
+	result_s3, err := svc.GetObject(input)
+	if err != nil {
+		writeS3Error(w, err, "Error retrieving video file")
+		return
+	}
+	defer result_s3.Body.Close()
+
+	w.Header().Set("Content-Type", objectContentType(result_s3.ContentType, filename))
 
 	// Set content length if available
 	if result_s3.ContentLength != nil {
 		w.Header().Set("Content-Length", fmt.Sprintf("%d", *result_s3.ContentLength))
 	}
+	if result_s3.ContentRange != nil {
+		w.Header().Set("Content-Range", *result_s3.ContentRange)
+		w.WriteHeader(http.StatusPartialContent)
+	}
 
 	// Stream the file to the client
 	bytesWritten, err := io.Copy(w, result_s3.Body)
@@ -302,44 +972,196 @@ func DownloadVideoFromS3(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("Successfully downloaded video %s for user %d (%d bytes)", videoID, uint(userID), bytesWritten)
+	log.Printf("Successfully downloaded video %s for user %d (%d bytes)", videoID, userID, bytesWritten)
+}
+
+// StreamVideoFromS3 redirects the client to a short-lived presigned URL for the video,
+// so browsers (e.g. <video> tags) can fetch it straight from S3
+func (h *Handler) StreamVideoFromS3(w http.ResponseWriter, r *http.Request) {
+	transcodingJob, userID, ok := h.downloadableJob(w, r)
+	if !ok {
+		return
+	}
+
+	if !redirectToPresignedOutput(w, r, transcodingJob, getEnvDuration("S3_PRESIGN_TTL", 5*time.Minute)) {
+		return
+	}
+
+	log.Printf("Redirected user %d to presigned URL for video %s", userID, transcodingJob.ID)
+}
+
+// redirectToPresignedOutput answers with a 302 to a presigned S3 URL for the job's
+// output, valid for ttl. On failure it writes the error response and returns false.
+func redirectToPresignedOutput(w http.ResponseWriter, r *http.Request, job *models.TranscodingJob, ttl time.Duration) bool {
+	outputURL := *job.OutputURL
+	bucket, key, err := parseS3URL(outputURL)
+	if err != nil {
+		log.Printf("Error parsing S3 URL %s: %v", outputURL, err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Invalid video storage location")
+		return false
+	}
+
+	svc, err := s3ClientForBucket(r.Context(), bucket)
+	if err != nil {
+		log.Printf("Error creating AWS session: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error connecting to storage service")
+		return false
+	}
+
+	req, _ := svc.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	presignedURL, err := req.Presign(ttl)
+	if err != nil {
+		log.Printf("Error presigning S3 URL for video %s: %v", job.ID, err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error generating video URL")
+		return false
+	}
+
+	// The URL expires quickly, so the redirect itself must not be cached
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, presignedURL, http.StatusFound)
+	return true
+}
+
+// setVideoMetadataHeaders exposes the job's stored media metadata as response headers.
+// Headers are only set for values the job actually has.
+func setVideoMetadataHeaders(w http.ResponseWriter, job *models.TranscodingJob) {
+	if job.DurationSeconds != nil {
+		w.Header().Set("X-Video-Duration", strconv.Itoa(*job.DurationSeconds))
+	} else if job.SourceDuration != nil {
+		w.Header().Set("X-Video-Duration", strconv.FormatFloat(*job.SourceDuration, 'f', -1, 64))
+	}
+	if job.Bitrate != nil {
+		w.Header().Set("X-Video-Bitrate", strconv.Itoa(*job.Bitrate))
+	}
+	if job.SourceWidth != nil && job.SourceHeight != nil {
+		w.Header().Set("X-Video-Resolution", fmt.Sprintf("%dx%d", *job.SourceWidth, *job.SourceHeight))
+	}
+	if job.TargetCodec != "" {
+		w.Header().Set("X-Video-Codec", job.TargetCodec)
+	}
 }
 
-// parseS3URL parses an S3 URL and returns bucket and key
+// s3HostPattern matches AWS S3 hostnames: path-style endpoints such as
+// s3.amazonaws.com or s3.eu-west-1.amazonaws.com, and virtual-hosted ones such as
+// bucket.s3.eu-west-1.amazonaws.com, where the first group is the bucket
+var s3HostPattern = regexp.MustCompile(`^(?:(.+)\.)?s3(?:[.-][a-z0-9-]+)*\.amazonaws\.com(?:\.cn)?$`)
+
+// parseS3URL parses an S3 URL and returns bucket and key. Accepted forms are
+// s3://bucket/key (or bare bucket/key), virtual-hosted https://bucket.s3.region.amazonaws.com/key
+// and path-style https://s3.region.amazonaws.com/bucket/key. Path-style URLs on the
+// AWS_S3_ENDPOINT host are recognised too.
 func parseS3URL(s3URL string) (bucket, key string, err error) {
-	// Remove s3:// prefix if present
-	s3URL = strings.TrimPrefix(s3URL, "s3://")
+	if !strings.HasPrefix(s3URL, "https://") && !strings.HasPrefix(s3URL, "http://") {
+		// Split into bucket and key
+		parts := strings.SplitN(strings.TrimPrefix(s3URL, "s3://"), "/", 2)
+		if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+			return "", "", fmt.Errorf("invalid S3 URL format")
+		}
+		return parts[0], parts[1], nil
+	}
+
+	u, err := url.Parse(s3URL)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid S3 URL: %w", err)
+	}
+	host := strings.ToLower(u.Hostname())
+	path := strings.TrimPrefix(u.Path, "/")
+
+	match := s3HostPattern.FindStringSubmatch(host)
+	switch {
+	case match != nil && match[1] != "":
+		bucket, key = match[1], path
+	case match != nil || isS3EndpointHost(host):
+		parts := strings.SplitN(path, "/", 2)
+		if len(parts) == 2 {
+			bucket, key = parts[0], parts[1]
+		}
+	default:
+		return "", "", fmt.Errorf("not an S3 URL: unrecognised host %s", host)
+	}
+
+	if bucket == "" || key == "" {
+		return "", "", fmt.Errorf("invalid S3 URL format: missing bucket or key")
+	}
+	return bucket, key, nil
+}
+
+// isS3EndpointHost reports whether host is that of the custom AWS_S3_ENDPOINT
+func isS3EndpointHost(host string) bool {
+	endpoint := getEnv("AWS_S3_ENDPOINT", "")
+	if endpoint == "" {
+		return false
+	}
+	u, err := url.Parse(endpoint)
+	return err == nil && strings.EqualFold(u.Hostname(), host)
+}
+
+// defaultContentTypes maps video file extensions to their content types
+var defaultContentTypes = map[string]string{
+	".mp4":  "video/mp4",
+	".avi":  "video/x-msvideo",
+	".mov":  "video/quicktime",
+	".wmv":  "video/x-ms-wmv",
+	".flv":  "video/x-flv",
+	".webm": "video/webm",
+	".mkv":  "video/x-matroska",
+}
+
+// Extension map with the VIDEO_CONTENT_TYPES overrides applied, built on first use
+var (
+	contentTypesOnce sync.Once
+	contentTypes     map[string]string
+)
 
-	// Split into bucket and key
-	parts := strings.SplitN(s3URL, "/", 2)
-	if len(parts) < 2 {
-		return "", "", fmt.Errorf("invalid S3 URL format")
+// loadContentTypes merges VIDEO_CONTENT_TYPES, a comma-separated list of ext=type
+// pairs (e.g. "ts=video/mp2t,.m4v=video/x-m4v"), over the default extension map
+func loadContentTypes() map[string]string {
+	types := make(map[string]string, len(defaultContentTypes))
+	for ext, contentType := range defaultContentTypes {
+		types[ext] = contentType
 	}
 
-	return parts[0], parts[1], nil
+	for _, entry := range strings.Split(getEnv("VIDEO_CONTENT_TYPES", ""), ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		ext, contentType, ok := strings.Cut(entry, "=")
+		ext, contentType = strings.ToLower(strings.TrimSpace(ext)), strings.TrimSpace(contentType)
+		if !ok || ext == "" || ext == "." || contentType == "" {
+			log.Printf("Ignoring invalid VIDEO_CONTENT_TYPES entry %q", entry)
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		types[ext] = contentType
+	}
+	return types
 }
 
 // getContentType returns the appropriate content type based on file extension
 func getContentType(filename string) string {
-	ext := strings.ToLower(filepath.Ext(filename))
-	switch ext {
-	case ".mp4":
-		return "video/mp4"
-	case ".avi":
-		return "video/x-msvideo"
-	case ".mov":
-		return "video/quicktime"
-	case ".wmv":
-		return "video/x-ms-wmv"
-	case ".flv":
-		return "video/x-flv"
-	case ".webm":
-		return "video/webm"
-	case ".mkv":
-		return "video/x-matroska"
-	default:
-		return "application/octet-stream"
+	contentTypesOnce.Do(func() { contentTypes = loadContentTypes() })
+	if contentType, ok := contentTypes[strings.ToLower(filepath.Ext(filename))]; ok {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// objectContentType prefers the content type stored with the S3 object, falling back
+// to the extension map when none was set or S3 only has its generic default
+func objectContentType(stored *string, filename string) string {
+	if stored != nil {
+		switch contentType := strings.TrimSpace(*stored); strings.ToLower(contentType) {
+		case "", "binary/octet-stream", "application/octet-stream":
+		default:
+			return contentType
+		}
 	}
+	return getContentType(filename)
 }
 
 // getEnv gets an environment variable with a default value
@@ -349,3 +1171,25 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvDuration gets a duration environment variable (e.g. "30s", "24h") with a default value
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil {
+			return parsed
+		}
+		log.Printf("Invalid duration for %s: %q, using default %s", key, value, defaultValue)
+	}
+	return defaultValue
+}
+
+// getEnvInt gets an integer environment variable with a default value
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+		log.Printf("Invalid integer for %s: %q, using default %d", key, value, defaultValue)
+	}
+	return defaultValue
+}
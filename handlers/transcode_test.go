@@ -0,0 +1,355 @@
+package handlers
+
+import (
+	"auth-service/middleware"
+	"auth-service/models"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"runtime/metrics"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+func TestParseS3URL(t *testing.T) {
+	tests := []struct {
+		name   string
+		url    string
+		bucket string
+		key    string
+	}{
+		{"s3 scheme", "s3://videos/out/clip.mp4", "videos", "out/clip.mp4"},
+		{"bare bucket and key", "videos/out/clip.mp4", "videos", "out/clip.mp4"},
+		{"virtual-hosted with region", "https://videos.s3.eu-west-1.amazonaws.com/out/clip.mp4", "videos", "out/clip.mp4"},
+		{"virtual-hosted global endpoint", "https://videos.s3.amazonaws.com/out/clip.mp4", "videos", "out/clip.mp4"},
+		{"virtual-hosted legacy dash region", "https://videos.s3-eu-west-1.amazonaws.com/clip.mp4", "videos", "clip.mp4"},
+		{"virtual-hosted dotted bucket", "https://my.videos.s3.us-east-2.amazonaws.com/clip.mp4", "my.videos", "clip.mp4"},
+		{"virtual-hosted dualstack", "https://videos.s3.dualstack.us-east-1.amazonaws.com/clip.mp4", "videos", "clip.mp4"},
+		{"virtual-hosted china", "https://videos.s3.cn-north-1.amazonaws.com.cn/clip.mp4", "videos", "clip.mp4"},
+		{"path-style with region", "https://s3.eu-west-1.amazonaws.com/videos/out/clip.mp4", "videos", "out/clip.mp4"},
+		{"path-style global endpoint", "https://s3.amazonaws.com/videos/clip.mp4", "videos", "clip.mp4"},
+		{"path-style plain http", "http://s3.amazonaws.com/videos/clip.mp4", "videos", "clip.mp4"},
+		{"uppercase host", "https://Videos.S3.EU-WEST-1.AMAZONAWS.COM/clip.mp4", "videos", "clip.mp4"},
+		{"escaped key", "https://videos.s3.amazonaws.com/out/my%20clip.mp4", "videos", "out/my clip.mp4"},
+		{"presigned query ignored", "https://videos.s3.amazonaws.com/clip.mp4?X-Amz-Signature=abc", "videos", "clip.mp4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucket, key, err := parseS3URL(tt.url)
+			if err != nil {
+				t.Fatalf("parseS3URL(%q): %v", tt.url, err)
+			}
+			if bucket != tt.bucket || key != tt.key {
+				t.Errorf("parseS3URL(%q) = %q, %q; want %q, %q", tt.url, bucket, key, tt.bucket, tt.key)
+			}
+		})
+	}
+}
+
+func TestParseS3URLCustomEndpoint(t *testing.T) {
+	t.Setenv("AWS_S3_ENDPOINT", "http://minio.internal:9000")
+
+	bucket, key, err := parseS3URL("http://minio.internal:9000/videos/out/clip.mp4")
+	if err != nil || bucket != "videos" || key != "out/clip.mp4" {
+		t.Errorf("parseS3URL on AWS_S3_ENDPOINT = %q, %q, %v; want videos, out/clip.mp4", bucket, key, err)
+	}
+}
+
+func TestParseS3URLInvalid(t *testing.T) {
+	for _, url := range []string{
+		"",
+		"s3://videos",
+		"s3://videos/",
+		"s3:///clip.mp4",
+		"https://videos.s3.amazonaws.com/",
+		"https://s3.amazonaws.com/videos",
+		"https://example.com/videos/clip.mp4",
+		"https://s3.amazonaws.com.evil.example/videos/clip.mp4",
+		"https://minio.internal:9000/videos/clip.mp4",
+	} {
+		if bucket, key, err := parseS3URL(url); err == nil {
+			t.Errorf("parseS3URL(%q) = %q, %q; want an error", url, bucket, key)
+		}
+	}
+}
+
+// createJob stores a transcoding job created by userID. Completed jobs get an output URL.
+func createJob(t *testing.T, h *Handler, userID uint, status models.TranscodingJobStatus) models.TranscodingJob {
+	t.Helper()
+
+	job := models.TranscodingJob{
+		JobID:           uuid.NewString(),
+		SourcePath:      "in/clip.mov",
+		TargetCodec:     "h264",
+		TargetContainer: "mp4",
+		Status:          status,
+		CreatedBy:       &userID,
+	}
+	if status == models.StatusCompleted {
+		outputURL := "s3://videos/out/" + job.JobID + ".mp4"
+		job.OutputURL = &outputURL
+	}
+	if err := h.DB.Create(&job).Error; err != nil {
+		t.Fatalf("create job: %v", err)
+	}
+	return job
+}
+
+func TestTranscodeNotFound(t *testing.T) {
+	h := newTestHandler(t)
+	alice := createUser(t, h, "alice@example.com", "correct horse battery", models.RoleUser)
+	bob := createUser(t, h, "bob@example.com", "correct horse battery", models.RoleUser)
+	own := createJob(t, h, alice.ID, models.StatusCompleted)
+	pending := createJob(t, h, alice.ID, models.StatusPending)
+	others := createJob(t, h, bob.ID, models.StatusCompleted)
+	deleted := createJob(t, h, alice.ID, models.StatusCompleted)
+	if err := h.DB.Delete(&deleted).Error; err != nil {
+		t.Fatalf("delete job: %v", err)
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/auth/video/transcode/{id}", middleware.AuthMiddleware(h.GetVideoTranscodeInfo))
+	router.HandleFunc("/auth/video/transcode/{id}/download", middleware.DownloadAuth(h.DownloadVideoFromS3))
+	token := tokenFor(t, h, alice)
+
+	tests := []struct {
+		name string
+		path string
+		code int
+		want string
+	}{
+		{"info of unknown job", "/auth/video/transcode/" + uuid.NewString(), http.StatusNotFound, "video_not_found"},
+		{"info of another user's job", "/auth/video/transcode/" + others.ID.String(), http.StatusNotFound, "video_not_found"},
+		{"info of deleted job", "/auth/video/transcode/" + deleted.ID.String(), http.StatusNotFound, "video_not_found"},
+		{"info of own job", "/auth/video/transcode/" + own.ID.String(), http.StatusOK, ""},
+		{"download of unknown job", "/auth/video/transcode/" + uuid.NewString() + "/download", http.StatusNotFound, "video_not_found"},
+		{"download of another user's job", "/auth/video/transcode/" + others.ID.String() + "/download", http.StatusNotFound, "video_not_found"},
+		{"download of pending job", "/auth/video/transcode/" + pending.ID.String() + "/download", http.StatusNotFound, "video_not_ready"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(t, router.ServeHTTP, http.MethodGet, tt.path, nil, token)
+			if rec.Code != tt.code {
+				t.Fatalf("got %d %s, want %d", rec.Code, rec.Body.String(), tt.code)
+			}
+			if tt.want != "" && errorCode(t, rec) != tt.want {
+				t.Fatalf("got code %s, want %s", errorCode(t, rec), tt.want)
+			}
+		})
+	}
+}
+
+// Batch items beyond the user's active job quota are refused with 429, not forwarded
+func TestTranscodeBatchQuota(t *testing.T) {
+	var forwarded atomic.Int32
+	transcoder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := forwarded.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"job_id": "job-" + strconv.Itoa(int(n))})
+	}))
+	defer transcoder.Close()
+	t.Setenv("TRANSCODE_VIDEO_URL", transcoder.URL)
+	t.Setenv("TRANSCODE_MAX_ACTIVE_JOBS", "3")
+
+	h := newTestHandler(t)
+	alice := createUser(t, h, "alice@example.com", "correct horse battery", models.RoleUser)
+	createJob(t, h, alice.ID, models.StatusProcessing)
+	createJob(t, h, alice.ID, models.StatusCompleted)
+
+	spec := map[string]string{"source_path": "in/clip.mov", "target_codec": "h264", "target_container": "mp4"}
+	batch := []interface{}{spec, spec, map[string]string{"source_path": "in/clip.mov"}, spec, spec}
+	rec := serve(t, middleware.AuthMiddleware(h.TranscodeVideoBatchProxy), http.MethodPost, "/auth/video/transcode/batch", batch, tokenFor(t, h, alice))
+	if rec.Code != http.StatusMultiStatus {
+		t.Fatalf("got %d %s, want 207", rec.Code, rec.Body.String())
+	}
+
+	var body struct {
+		Results []batchItemResult `json:"results"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	// One job is already processing, so two of the four valid items fit the quota of 3
+	want := []int{http.StatusCreated, http.StatusCreated, http.StatusBadRequest, http.StatusTooManyRequests, http.StatusTooManyRequests}
+	if len(body.Results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(body.Results), len(want))
+	}
+	for i, result := range body.Results {
+		if result.StatusCode != want[i] {
+			t.Errorf("item %d: status %d (%s), want %d", i, result.StatusCode, result.Error, want[i])
+		}
+		if result.StatusCode == http.StatusTooManyRequests && (result.Success || result.Error == "") {
+			t.Errorf("item %d refused by the quota without an error: %+v", i, result)
+		}
+	}
+	if got := forwarded.Load(); got != 2 {
+		t.Errorf("forwarded %d jobs, want 2", got)
+	}
+}
+
+// A single submit or a retry over the quota is refused before reaching the transcode service
+func TestTranscodeQuotaSingleSubmitAndRetry(t *testing.T) {
+	var forwarded atomic.Int32
+	transcoder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded.Add(1)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer transcoder.Close()
+	t.Setenv("TRANSCODE_VIDEO_URL", transcoder.URL)
+	t.Setenv("TRANSCODE_MAX_ACTIVE_JOBS", "1")
+
+	h := newTestHandler(t)
+	alice := createUser(t, h, "alice@example.com", "correct horse battery", models.RoleUser)
+	createJob(t, h, alice.ID, models.StatusPending)
+	failed := createJob(t, h, alice.ID, models.StatusFailed)
+	token := tokenFor(t, h, alice)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/auth/video/transcode", middleware.AuthMiddleware(h.TranscodeVideoProxy))
+	router.HandleFunc("/auth/video/transcode/{id}/retry", middleware.AuthMiddleware(h.RetryVideoTranscode))
+
+	spec := map[string]string{"source_path": "in/clip.mov", "target_codec": "h264", "target_container": "mp4"}
+	for _, path := range []string{
+		"/auth/video/transcode",
+		"/auth/video/transcode?dry_run=true",
+		"/auth/video/transcode/" + failed.ID.String() + "/retry",
+	} {
+		rec := serve(t, router.ServeHTTP, http.MethodPost, path, spec, token)
+		if rec.Code != http.StatusTooManyRequests || errorCode(t, rec) != "quota_exceeded" {
+			t.Errorf("POST %s over the quota: got %d %s, want 429 quota_exceeded", path, rec.Code, rec.Body.String())
+		}
+	}
+	if got := forwarded.Load(); got != 0 {
+		t.Errorf("forwarded %d jobs over the quota", got)
+	}
+}
+
+// benchmarkJobCount is the size of the job list in BenchmarkGetVideoTranscodes
+const benchmarkJobCount = 20000
+
+// discardResponse is a ResponseWriter that keeps nothing, so a benchmark measures the
+// handler's own memory rather than a recorder holding the whole body
+type discardResponse struct {
+	header http.Header
+	code   int
+	n      int64
+}
+
+func (d *discardResponse) Header() http.Header { return d.header }
+
+func (d *discardResponse) WriteHeader(code int) {
+	if d.code == 0 {
+		d.code = code
+	}
+}
+
+func (d *discardResponse) Write(p []byte) (int, error) {
+	d.WriteHeader(http.StatusOK)
+	d.n += int64(len(p))
+	return len(p), nil
+}
+
+// peakHeap samples the live heap until stop is called and returns the highest value seen
+func peakHeap() (stop func() uint64) {
+	sample := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	var peak atomic.Uint64
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(time.Millisecond)
+		defer ticker.Stop()
+		for {
+			metrics.Read(sample)
+			if value := sample[0].Value.Uint64(); value > peak.Load() {
+				peak.Store(value)
+			}
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() uint64 {
+		close(done)
+		<-finished
+		return peak.Load()
+	}
+}
+
+// BenchmarkGetVideoTranscodes lists benchmarkJobCount jobs without pagination, streamed
+// by the handler and, for comparison, loaded into a slice and encoded at once as the
+// list endpoint used to. peak-heap-B is the largest live heap seen during a run.
+func BenchmarkGetVideoTranscodes(b *testing.B) {
+	b.Setenv("DB_SLOW_QUERY_THRESHOLD", "1h")
+	h := newTestHandler(b)
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() { log.SetOutput(os.Stderr) })
+	user := createUser(b, h, "alice@example.com", "correct horse battery", models.RoleUser)
+
+	jobs := make([]models.TranscodingJob, benchmarkJobCount)
+	for i := range jobs {
+		outputURL := "s3://videos/out/" + uuid.NewString() + ".mp4"
+		jobs[i] = models.TranscodingJob{
+			JobID:           uuid.NewString(),
+			SourcePath:      "uploads/2024/source-" + strconv.Itoa(i) + ".mov",
+			TargetCodec:     "h264",
+			TargetContainer: "mp4",
+			OutputURL:       &outputURL,
+			Status:          models.StatusCompleted,
+			CreatedBy:       &user.ID,
+		}
+	}
+	if err := h.DB.CreateInBatches(jobs, 500).Error; err != nil {
+		b.Fatalf("seed jobs: %v", err)
+	}
+	jobs = nil
+
+	token := tokenFor(b, h, user)
+	orderClause, _ := transcodeOrderClause("", "")
+	buffered := func(w http.ResponseWriter, r *http.Request) {
+		var jobs []models.TranscodingJob
+		if err := h.DB.Where("created_by = ?", user.ID).Order(orderClause).Find(&jobs).Error; err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error retrieving transcoding jobs")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(jobs)
+	}
+
+	for _, bench := range []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"streamed", middleware.AuthMiddleware(h.GetVideoTranscodes)},
+		{"buffered", middleware.AuthMiddleware(buffered)},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			b.ReportAllocs()
+			runtime.GC()
+			stop := peakHeap()
+			for i := 0; i < b.N; i++ {
+				req := httptest.NewRequest(http.MethodGet, "/auth/video/transcode", nil)
+				req.Header.Set("Authorization", "Bearer "+token)
+				w := &discardResponse{header: http.Header{}}
+				bench.handler(w, req)
+				if w.code != http.StatusOK {
+					b.Fatalf("got status %d", w.code)
+				}
+			}
+			b.ReportMetric(float64(stop()), "peak-heap-B")
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// fieldError describes one invalid field of a request body. Field is the dotted path
+// to it (e.g. "options.bitrate").
+type fieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// validationErrors collects every invalid field of a body so they can all be
+// reported at once
+type validationErrors []fieldError
+
+func (errs validationErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// bodyValidator checks fields of a decoded JSON object, addressed by dotted paths
+type bodyValidator struct {
+	body map[string]interface{}
+	errs validationErrors
+}
+
+func newBodyValidator(body map[string]interface{}) *bodyValidator {
+	return &bodyValidator{body: body}
+}
+
+// fail records an invalid field
+func (v *bodyValidator) fail(path, rule, format string, args ...interface{}) {
+	v.errs = append(v.errs, fieldError{Field: path, Rule: rule, Message: fmt.Sprintf(format, args...)})
+}
+
+// lookup resolves a dotted path through nested objects. present is false when any
+// part of the path is missing; a non-object along the way is reported as a type error.
+func (v *bodyValidator) lookup(path string) (value interface{}, present bool) {
+	current := interface{}(v.body)
+	parts := strings.Split(path, ".")
+	for i, part := range parts {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			parent := strings.Join(parts[:i], ".")
+			v.fail(parent, "type", "%s must be an object", parent)
+			return nil, false
+		}
+		if current, ok = object[part]; !ok || current == nil {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// requiredString checks that path holds a non-blank string and returns it
+func (v *bodyValidator) requiredString(path string) (string, bool) {
+	value, present := v.lookup(path)
+	if !present {
+		v.fail(path, "required", "%s is required", path)
+		return "", false
+	}
+	s, ok := value.(string)
+	if !ok {
+		v.fail(path, "type", "%s must be a string", path)
+		return "", false
+	}
+	if strings.TrimSpace(s) == "" {
+		v.fail(path, "required", "%s is required", path)
+		return "", false
+	}
+	return s, true
+}
+
+// optionalString checks that path, when present, holds a string, and returns it
+func (v *bodyValidator) optionalString(path string) (string, bool) {
+	value, present := v.lookup(path)
+	if !present {
+		return "", false
+	}
+	s, ok := value.(string)
+	if !ok {
+		v.fail(path, "type", "%s must be a string", path)
+	}
+	return s, ok
+}
+
+// nullableString checks that a top-level field, when present, holds a string or null.
+// set reports whether the field was given at all; value is nil when it was null.
+func (v *bodyValidator) nullableString(path string) (value *string, set bool) {
+	raw, set := v.body[path]
+	if !set || raw == nil {
+		return nil, set
+	}
+	s, ok := raw.(string)
+	if !ok {
+		v.fail(path, "type", "%s must be a string or null", path)
+		return nil, true
+	}
+	return &s, true
+}
+
+// maxLength checks that a (previously read) string value has at most max characters
+func (v *bodyValidator) maxLength(path, value string, max int) {
+	if utf8.RuneCountInString(value) > max {
+		v.fail(path, "max", "%s must be at most %d characters", path, max)
+	}
+}
+
+// optionalPositiveInt checks that path, when present, holds a whole number above 0
+func (v *bodyValidator) optionalPositiveInt(path string) {
+	value, present := v.lookup(path)
+	if !present {
+		return
+	}
+	number, ok := value.(float64)
+	if !ok || number != math.Trunc(number) {
+		v.fail(path, "type", "%s must be an integer", path)
+		return
+	}
+	if number <= 0 {
+		v.fail(path, "min", "%s must be greater than 0", path)
+	}
+}
+
+// oneOf checks that a (previously read) string value is in allowed, case-insensitively
+func (v *bodyValidator) oneOf(path, value string, allowed []string) {
+	if !slices.Contains(allowed, strings.ToLower(value)) {
+		v.fail(path, "oneof", "Unsupported %s: %s", path, value)
+	}
+}
+
+// err returns the collected errors, or nil when the body is valid
+func (v *bodyValidator) err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+// fieldErrors returns the per-field details of a validation error, if it has any
+func fieldErrors(err error) []fieldError {
+	var errs validationErrors
+	if errors.As(err, &errs) {
+		return errs
+	}
+	return nil
+}
+
+// writeValidationError answers an invalid body with 400 validation_failed. Errors
+// from a bodyValidator are listed per field under error.fields.
+func writeValidationError(w http.ResponseWriter, err error) {
+	writeJSONErrorBody(w, http.StatusBadRequest, errorDetail{
+		Code:    "validation_failed",
+		Message: err.Error(),
+		Fields:  fieldErrors(err),
+	})
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"auth-service/mail"
+	"auth-service/middleware"
+	"auth-service/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Resend limiters, created on first use from VERIFY_RESEND_* settings
+var (
+	resendLimitersOnce  sync.Once
+	resendEmailLimiter  *middleware.RateLimiter
+	resendClientLimiter *middleware.RateLimiter
+)
+
+func resendLimiters() (byEmail, byClient *middleware.RateLimiter) {
+	resendLimitersOnce.Do(func() {
+		window := getEnvDuration("VERIFY_RESEND_WINDOW", time.Hour)
+		resendEmailLimiter = middleware.NewRateLimiter(getEnvInt("VERIFY_RESEND_EMAIL_LIMIT", 3), window)
+		resendClientLimiter = middleware.NewRateLimiter(getEnvInt("VERIFY_RESEND_IP_LIMIT", 10), window)
+	})
+	return resendEmailLimiter, resendClientLimiter
+}
+
+// startEmailVerification issues a new verification token for the user and emails a
+// link to it. Issuing a token replaces the previous one, so older links stop working.
+func (h *Handler) startEmailVerification(ctx context.Context, user *models.User) error {
+	token, err := newSecureToken()
+	if err != nil {
+		return err
+	}
+
+	tokenHash := hashToken(token)
+	expiresAt := time.Now().Add(getEnvDuration("EMAIL_VERIFICATION_TOKEN_TTL", 24*time.Hour))
+
+	err = h.DB.Model(user).Updates(map[string]interface{}{
+		"verification_token_hash": tokenHash,
+		"verification_expires_at": expiresAt,
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/auth/verify?token=%s", getEnv("APP_BASE_URL", "http://localhost:8080"), url.QueryEscape(token))
+	return h.sendEmail(ctx, user.Email, mail.VerifyEmail{Link: link, ExpiresAt: expiresAt})
+}
+
+// VerifyEmail marks the account's email as verified once the emailed token is presented
+func (h *Handler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		writeJSONError(w, http.StatusBadRequest, "token_required", "Token is required")
+		return
+	}
+
+	var user models.User
+	result := h.DB.Where("verification_token_hash = ?", hashToken(token)).First(&user)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			writeJSONError(w, http.StatusBadRequest, "invalid_token", "Invalid or expired token")
+			return
+		}
+		log.Printf("Database error: %v", result.Error)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+
+	if user.VerificationExpiresAt == nil || time.Now().After(*user.VerificationExpiresAt) {
+		writeJSONError(w, http.StatusBadRequest, "invalid_token", "Invalid or expired token")
+		return
+	}
+
+	now := time.Now()
+	user.EmailVerifiedAt = &now
+	user.VerificationTokenHash = nil
+	user.VerificationExpiresAt = nil
+
+	if result := h.DB.Save(&user); result.Error != nil {
+		log.Printf("Failed to update user: %v", result.Error)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to update user")
+		return
+	}
+
+	log.Printf("Verified email for user %d", user.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// ResendVerification emails a fresh verification link to an unverified account. It
+// answers 200 whether or not such an account exists, so it cannot be used to probe
+// for registered addresses. Requests are rate-limited per email and per client IP.
+func (h *Handler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	var req models.ResendVerificationRequest
+
+	limitBody(w, r)
+	if err := decodeJSON(r, &req); err != nil {
+		writeBodyError(w, err, "Invalid JSON")
+		return
+	}
+
+	email := strings.TrimSpace(req.Email)
+	if !strings.Contains(email, "@") {
+		writeJSONError(w, http.StatusBadRequest, "invalid_email", "Invalid email format")
+		return
+	}
+
+	// Limits are applied before the lookup so they behave the same for unknown addresses
+	byEmail, byClient := resendLimiters()
+	if ok, retryAfter := byClient.Allow(middleware.ClientIP(r)); !ok {
+		writeRateLimited(w, retryAfter)
+		return
+	}
+	if ok, retryAfter := byEmail.Allow(strings.ToLower(email)); !ok {
+		writeRateLimited(w, retryAfter)
+		return
+	}
+
+	var user models.User
+	result := h.DB.Where("email = ?", email).First(&user)
+	switch {
+	case result.Error == nil:
+		if !user.IsEmailVerified() {
+			// A send failure is only logged: an error here would reveal that the account exists
+			if err := h.startEmailVerification(r.Context(), &user); err != nil {
+				log.Printf("Failed to resend verification email for user %d: %v", user.ID, err)
+			} else {
+				log.Printf("Resent verification email for user %d", user.ID)
+			}
+		}
+	case !errors.Is(result.Error, gorm.ErrRecordNotFound):
+		log.Printf("Database error: %v", result.Error)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "If an unverified account exists for this email, a verification link has been sent",
+	})
+}
+
+// writeRateLimited answers 429 with a Retry-After header in whole seconds
+func writeRateLimited(w http.ResponseWriter, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	writeJSONError(w, http.StatusTooManyRequests, "rate_limited", "Too many requests, try again later")
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"auth-service/mail"
+	"auth-service/models"
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// failingMailer refuses every message, like an unreachable SMTP server
+type failingMailer struct{}
+
+func (failingMailer) Send(context.Context, mail.Message) error {
+	return fmt.Errorf("dial smtp: %w", mail.ErrUnavailable)
+}
+
+// The answer must not depend on whether the address has an account, even when the
+// email to that account cannot be sent
+func TestResendVerificationSameAnswer(t *testing.T) {
+	h := newTestHandler(t)
+	createUser(t, h, "alice@example.com", "correct horse battery", models.RoleUser)
+	h.Mail.Mailer = failingMailer{}
+
+	unverified := serve(t, h.ResendVerification, http.MethodPost, "/auth/verify/resend", map[string]string{"email": "alice@example.com"}, "")
+	unknown := serve(t, h.ResendVerification, http.MethodPost, "/auth/verify/resend", map[string]string{"email": "nobody@example.com"}, "")
+
+	if unverified.Code != http.StatusOK || unknown.Code != http.StatusOK {
+		t.Fatalf("got %d for the unverified account and %d for an unknown address, want 200 for both", unverified.Code, unknown.Code)
+	}
+	if unverified.Body.String() != unknown.Body.String() {
+		t.Errorf("bodies differ:\n%s\n%s", unverified.Body.String(), unknown.Body.String())
+	}
+}
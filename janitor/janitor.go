@@ -0,0 +1,91 @@
+package janitor
+
+import (
+	"auth-service/leader"
+	"auth-service/models"
+	"context"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// task removes or clears one kind of expired data and reports how many rows it touched
+type task struct {
+	name string
+	run  func(tx *gorm.DB, now time.Time) (int64, error)
+}
+
+// tasks lists everything the janitor cleans up. Tables with expiring rows add a task here.
+var tasks = []task{
+	{"idempotency_keys", func(tx *gorm.DB, now time.Time) (int64, error) {
+		result := tx.Where("expires_at <= ?", now).Delete(&models.IdempotencyKey{})
+		return result.RowsAffected, result.Error
+	}},
+	// Used invites are kept as a record of who invited whom
+	{"invite_codes", func(tx *gorm.DB, now time.Time) (int64, error) {
+		result := tx.Where("used_at IS NULL AND expires_at <= ?", now).Delete(&models.InviteCode{})
+		return result.RowsAffected, result.Error
+	}},
+	// Accepted invites are deleted on acceptance, so only expired ones are left
+	{"org_invites", func(tx *gorm.DB, now time.Time) (int64, error) {
+		result := tx.Where("expires_at <= ?", now).Delete(&models.OrgInvite{})
+		return result.RowsAffected, result.Error
+	}},
+	// Revoked links are kept until they would have expired anyway
+	{"share_links", func(tx *gorm.DB, now time.Time) (int64, error) {
+		result := tx.Where("expires_at <= ?", now).Delete(&models.ShareLink{})
+		return result.RowsAffected, result.Error
+	}},
+	{"verification_tokens", func(tx *gorm.DB, now time.Time) (int64, error) {
+		result := tx.Model(&models.User{}).Unscoped().
+			Where("verification_expires_at <= ?", now).
+			UpdateColumns(map[string]interface{}{
+				"verification_token_hash": nil,
+				"verification_expires_at": nil,
+			})
+		return result.RowsAffected, result.Error
+	}},
+	{"email_change_tokens", func(tx *gorm.DB, now time.Time) (int64, error) {
+		result := tx.Model(&models.User{}).Unscoped().
+			Where("email_change_expires_at <= ?", now).
+			UpdateColumns(map[string]interface{}{
+				"pending_email":           nil,
+				"email_change_token_hash": nil,
+				"email_change_expires_at": nil,
+			})
+		return result.RowsAffected, result.Error
+	}},
+}
+
+// Start runs a cleanup pass every interval (with jitter) on the replica that holds the
+// janitor leader lock, until ctx is cancelled. It returns immediately; the returned
+// channel is closed once the janitor has stopped and released its lock.
+func Start(ctx context.Context, db *gorm.DB, interval time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		leader.Run(ctx, leader.New(db, "janitor"), interval, func(ctx context.Context) error {
+			return runOnce(ctx, db)
+		})
+	}()
+	log.Printf("Janitor started (every %s)", interval)
+	return done
+}
+
+// runOnce performs one cleanup pass in a single transaction
+func runOnce(ctx context.Context, db *gorm.DB) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		for _, t := range tasks {
+			count, err := t.run(tx, now)
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				log.Printf("Janitor removed %d expired %s", count, t.name)
+			}
+		}
+		return nil
+	})
+}
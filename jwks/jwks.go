@@ -0,0 +1,192 @@
+// Package jwks fetches and caches the signing keys an identity provider publishes as
+// a JSON Web Key Set (RFC 7517), so tokens it issues can be verified locally.
+package jwks
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrKeyNotFound is returned when the set has no usable key with the requested ID
+var ErrKeyNotFound = errors.New("signing key not found in JWKS")
+
+// minRefreshInterval limits refetches triggered by unknown key IDs, so tokens with
+// made-up kids cannot make the service hammer the provider
+const minRefreshInterval = 30 * time.Second
+
+// maxSetBytes bounds the size of a fetched key set
+const maxSetBytes = 1 << 20
+
+// Set is the key set published at one URL. Keys are fetched on first use and kept
+// for ttl; a key ID that is not in the cached set triggers an early refetch, which
+// picks up key rotations. When a refetch fails the cached keys stay in use.
+type Set struct {
+	url    string
+	ttl    time.Duration
+	client *http.Client
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey
+	fetchedAt   time.Time
+	lastAttempt time.Time
+}
+
+// New creates a Set for the JWKS document at url, cached for ttl
+func New(url string, ttl time.Duration, client *http.Client) *Set {
+	return &Set{url: url, ttl: ttl, client: client}
+}
+
+// Key returns the public key with ID kid. An empty kid matches the only key of a
+// set with a single key.
+func (s *Set) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	stale := s.keys == nil || now.Sub(s.fetchedAt) >= s.ttl
+	key, found := s.lookupLocked(kid)
+	if (stale || !found) && now.Sub(s.lastAttempt) >= minRefreshInterval {
+		s.lastAttempt = now
+		keys, err := s.fetch(ctx)
+		if err != nil {
+			if s.keys == nil {
+				return nil, err
+			}
+			log.Printf("Refreshing JWKS from %s failed, using cached keys: %v", s.url, err)
+		} else {
+			s.keys, s.fetchedAt = keys, now
+			key, found = s.lookupLocked(kid)
+		}
+	}
+	if !found {
+		return nil, ErrKeyNotFound
+	}
+	return key, nil
+}
+
+func (s *Set) lookupLocked(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+	key, ok := s.keys[kid]
+	return key, ok
+}
+
+// jsonWebKey holds the members of the RSA and EC keys this package understands
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// fetch downloads and parses the key set. Keys that are not signing keys or use an
+// unsupported type are skipped.
+func (s *Set) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching JWKS: %s answered %d", s.url, resp.StatusCode)
+	}
+
+	var document struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxSetBytes)).Decode(&document); err != nil {
+		return nil, fmt.Errorf("decoding JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(document.Keys))
+	for _, jwk := range document.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			log.Printf("Skipping JWKS key %q from %s: %v", jwk.Kid, s.url, err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil || !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		if n.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must be at least 2048 bits")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("EC point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(raw) == 0 {
+		return nil, errors.New("invalid base64url integer")
+	}
+	return new(big.Int).SetBytes(raw), nil
+}
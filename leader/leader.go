@@ -0,0 +1,140 @@
+package leader
+
+import (
+	"context"
+	"database/sql"
+	"hash/fnv"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"gorm.io/gorm"
+)
+
+var leaderGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "auth_service_leader",
+	Help: "1 when this instance holds the leader lock for a background task, else 0.",
+}, []string{"task"})
+
+// Lock elects a single replica to run a background task, using a session-level
+// Postgres advisory lock (pg_try_advisory_lock). The lock lives on a dedicated
+// connection taken from the pool for as long as it is held; if that connection
+// drops, Postgres releases the lock and another replica can take over. On other
+// databases (SQLite is single-instance) every caller is the leader.
+type Lock struct {
+	db   *gorm.DB
+	task string
+	key  int64
+
+	mu   sync.Mutex
+	conn *sql.Conn
+}
+
+// New returns the leader lock for task. The advisory lock key is derived from the
+// task name, so every replica agrees on it.
+func New(db *gorm.DB, task string) *Lock {
+	h := fnv.New64a()
+	h.Write([]byte("auth-service:" + task))
+	leaderGauge.WithLabelValues(task).Set(0)
+	return &Lock{db: db, task: task, key: int64(h.Sum64())}
+}
+
+// Acquire reports whether this instance is the task's leader, taking the lock when
+// it is free. A held lock is kept across calls; Acquire only checks that its
+// connection is still alive.
+func (l *Lock) Acquire(ctx context.Context) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.db.Dialector.Name() != "postgres" {
+		leaderGauge.WithLabelValues(l.task).Set(1)
+		return true, nil
+	}
+
+	if l.conn != nil {
+		if err := l.conn.PingContext(ctx); err == nil {
+			return true, nil
+		}
+		// The session is gone and the lock with it
+		log.Printf("Lost the %s leader lock: connection closed", l.task)
+		l.conn.Close()
+		l.conn = nil
+		leaderGauge.WithLabelValues(l.task).Set(0)
+	}
+
+	sqlDB, err := l.db.DB()
+	if err != nil {
+		return false, err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", l.key).Scan(&locked); err != nil {
+		conn.Close()
+		return false, err
+	}
+	if !locked {
+		conn.Close()
+		return false, nil
+	}
+
+	log.Printf("Acquired the %s leader lock", l.task)
+	l.conn = conn
+	leaderGauge.WithLabelValues(l.task).Set(1)
+	return true, nil
+}
+
+// Release gives up the lock, if held, so another replica can take over right away
+func (l *Lock) Release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	leaderGauge.WithLabelValues(l.task).Set(0)
+	if l.conn == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := l.conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", l.key); err != nil {
+		log.Printf("Failed to release the %s leader lock: %v", l.task, err)
+	}
+	l.conn.Close()
+	l.conn = nil
+	log.Printf("Released the %s leader lock", l.task)
+}
+
+// Run calls fn every interval, give or take up to 10% jitter so replicas started
+// together do not line up, on whichever replica holds the task's lock. It blocks
+// until ctx is cancelled and releases the lock before returning.
+func Run(ctx context.Context, lock *Lock, interval time.Duration, fn func(context.Context) error) {
+	defer lock.Release()
+
+	for {
+		jitter := time.Duration(rand.Int63n(int64(interval)/5+1)) - interval/10
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval + jitter):
+		}
+
+		leader, err := lock.Acquire(ctx)
+		if err != nil {
+			log.Printf("Failed to check the %s leader lock: %v", lock.task, err)
+			continue
+		}
+		if !leader {
+			continue
+		}
+
+		if err := fn(ctx); err != nil {
+			log.Printf("%s run failed: %v", lock.task, err)
+		}
+	}
+}
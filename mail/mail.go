@@ -0,0 +1,118 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Message is one outbound email. HTML is optional; Text is always sent.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer delivers messages. Implementations must be safe for concurrent use.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Log writes messages to the service log instead of delivering them. Bodies carry
+// one-time tokens, so they are only logged when LogBodies is set.
+type Log struct {
+	LogBodies bool
+}
+
+func (l Log) Send(ctx context.Context, msg Message) error {
+	log.Printf("Email to %s: %s", msg.To, msg.Subject)
+	if l.LogBodies {
+		log.Printf("[debug] Email body for %s:\n%s", msg.To, msg.Text)
+	}
+	return nil
+}
+
+// Nop discards every message
+type Nop struct{}
+
+func (Nop) Send(ctx context.Context, msg Message) error { return nil }
+
+// Capture keeps sent messages in memory so tests can inspect them
+type Capture struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (c *Capture) Send(ctx context.Context, msg Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages = append(c.messages, msg)
+	return nil
+}
+
+// Messages returns the messages sent so far, oldest first
+func (c *Capture) Messages() []Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Message(nil), c.messages...)
+}
+
+// Sender renders templated emails and hands them to a Mailer
+type Sender struct {
+	Mailer    Mailer
+	Templates *Templates
+}
+
+// Send renders the template data belongs to and delivers the result to to
+func (s *Sender) Send(ctx context.Context, to string, data Data) error {
+	msg, err := s.Templates.Render(to, data)
+	if err != nil {
+		return err
+	}
+	return s.Mailer.Send(ctx, msg)
+}
+
+// Close releases connections the Mailer keeps open, if it keeps any
+func (s *Sender) Close() error {
+	if closer, ok := s.Mailer.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Load builds the Sender described by the environment: MAIL_DRIVER selects the
+// Mailer (log, the default; smtp; or none) and MAIL_TEMPLATE_DIR optionally points
+// at templates overriding the embedded ones.
+func Load() (*Sender, error) {
+	templates, err := LoadTemplates(getEnv("MAIL_TEMPLATE_DIR", ""))
+	if err != nil {
+		return nil, err
+	}
+
+	var mailer Mailer
+	switch driver := strings.ToLower(getEnv("MAIL_DRIVER", "log")); driver {
+	case "log":
+		mailer = Log{LogBodies: strings.EqualFold(getEnv("LOG_LEVEL", "info"), "debug")}
+	case "none":
+		mailer = Nop{}
+	case "smtp":
+		if mailer, err = loadSMTP(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("MAIL_DRIVER must be log, smtp or none, got %q", driver)
+	}
+	return &Sender{Mailer: mailer, Templates: templates}, nil
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
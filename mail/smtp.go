@@ -0,0 +1,309 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TLS modes for SMTP_TLS
+const (
+	// TLSStartTLS connects in plain text and upgrades with STARTTLS before
+	// authenticating; a server without STARTTLS is an error
+	TLSStartTLS = "starttls"
+	// TLSImplicit speaks TLS from the first byte (SMTPS, usually port 465)
+	TLSImplicit = "tls"
+	// TLSNone sends in plain text; only meant for local relays
+	TLSNone = "none"
+)
+
+// ErrUnavailable wraps every failure to reach or log in to the SMTP server, as
+// opposed to the server rejecting a particular message
+var ErrUnavailable = errors.New("mail server unavailable")
+
+// ErrAuthFailed is returned (wrapped in ErrUnavailable) when the server rejects the
+// configured credentials
+var ErrAuthFailed = errors.New("smtp authentication failed")
+
+// SMTP delivers messages through an SMTP relay. One connection is kept open and
+// reused for later messages; it is replaced when it has been idle for IdleTimeout or
+// the server has dropped it. Sends are serialized over that connection.
+type SMTP struct {
+	Addr     string
+	Host     string
+	Username string
+	Password string
+	From     string
+	TLS      string
+	// Timeout bounds one send, including connecting and logging in
+	Timeout     time.Duration
+	IdleTimeout time.Duration
+
+	mu       sync.Mutex
+	conn     net.Conn
+	client   *smtp.Client
+	lastUsed time.Time
+}
+
+// loadSMTP reads SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD, SMTP_FROM,
+// SMTP_TLS, SMTP_TIMEOUT and SMTP_IDLE_TIMEOUT. The port defaults to 587 for
+// STARTTLS, 465 for implicit TLS and 25 without TLS.
+func loadSMTP() (*SMTP, error) {
+	host := getEnv("SMTP_HOST", "")
+	if host == "" {
+		return nil, fmt.Errorf("SMTP_HOST is required with MAIL_DRIVER=smtp")
+	}
+	from := getEnv("SMTP_FROM", "")
+	if _, err := netmail.ParseAddress(from); err != nil {
+		return nil, fmt.Errorf("SMTP_FROM must be an email address, got %q", from)
+	}
+
+	mode := strings.ToLower(getEnv("SMTP_TLS", TLSStartTLS))
+	defaultPort := map[string]string{TLSStartTLS: "587", TLSImplicit: "465", TLSNone: "25"}[mode]
+	if defaultPort == "" {
+		return nil, fmt.Errorf("SMTP_TLS must be starttls, tls or none, got %q", mode)
+	}
+	username := getEnv("SMTP_USERNAME", "")
+	if mode == TLSNone && username != "" && !isLocalhost(host) {
+		return nil, fmt.Errorf("SMTP_USERNAME requires SMTP_TLS=starttls or tls unless SMTP_HOST is localhost")
+	}
+
+	timeout, err := durationEnv("SMTP_TIMEOUT", 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	idleTimeout, err := durationEnv("SMTP_IDLE_TIMEOUT", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SMTP{
+		Addr:        net.JoinHostPort(host, getEnv("SMTP_PORT", defaultPort)),
+		Host:        host,
+		Username:    username,
+		Password:    getEnv("SMTP_PASSWORD", ""),
+		From:        from,
+		TLS:         mode,
+		Timeout:     timeout,
+		IdleTimeout: idleTimeout,
+	}, nil
+}
+
+// Send delivers msg within Timeout, or by ctx's deadline when that is sooner
+func (s *SMTP) Send(ctx context.Context, msg Message) error {
+	sender, err := netmail.ParseAddress(s.From)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deadline := time.Now().Add(s.Timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+
+	// RSET doubles as a check that the server has not dropped an idle connection
+	if s.client != nil {
+		if time.Since(s.lastUsed) > s.IdleTimeout || s.conn.SetDeadline(deadline) != nil || s.client.Reset() != nil {
+			s.closeLocked()
+		}
+	}
+	if s.client == nil {
+		if err := s.connectLocked(ctx, deadline); err != nil {
+			return err
+		}
+	}
+
+	// Cancelling ctx interrupts a send that is blocked on the server
+	conn := s.conn
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Unix(1, 0)) })
+	defer stop()
+
+	if err := s.deliverLocked(sender.Address, msg); err != nil {
+		s.closeLocked()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	s.lastUsed = time.Now()
+	return nil
+}
+
+// connectLocked dials the server, sets up TLS and logs in
+func (s *SMTP) connectLocked(ctx context.Context, deadline time.Time) error {
+	dialCtx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+	conn, err := (&net.Dialer{}).DialContext(dialCtx, "tcp", s.Addr)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+
+	tlsConfig := &tls.Config{ServerName: s.Host, MinVersion: tls.VersionTLS12}
+	if s.TLS == TLSImplicit {
+		conn = tls.Client(conn, tlsConfig)
+	}
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	if err := s.handshake(client, tlsConfig); err != nil {
+		client.Close()
+		return err
+	}
+
+	s.conn = conn
+	s.client = client
+	return nil
+}
+
+// handshake upgrades to TLS when configured and authenticates when credentials are set
+func (s *SMTP) handshake(client *smtp.Client, tlsConfig *tls.Config) error {
+	if err := client.Hello(helloName()); err != nil {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	if s.TLS == TLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("%w: %s does not support STARTTLS", ErrUnavailable, s.Addr)
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("%w: STARTTLS: %v", ErrUnavailable, err)
+		}
+	}
+	if s.Username != "" {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return fmt.Errorf("%w: %w: %s does not offer AUTH", ErrUnavailable, ErrAuthFailed, s.Addr)
+		}
+		if err := client.Auth(smtp.PlainAuth("", s.Username, s.Password, s.Host)); err != nil {
+			return fmt.Errorf("%w: %w: %v", ErrUnavailable, ErrAuthFailed, err)
+		}
+	}
+	return nil
+}
+
+// deliverLocked runs one mail transaction on the open connection
+func (s *SMTP) deliverLocked(from string, msg Message) error {
+	if err := s.client.Mail(from); err != nil {
+		return fmt.Errorf("MAIL FROM: %w", err)
+	}
+	if err := s.client.Rcpt(msg.To); err != nil {
+		return fmt.Errorf("RCPT TO: %w", err)
+	}
+	data, err := s.client.Data()
+	if err != nil {
+		return fmt.Errorf("DATA: %w", err)
+	}
+	if _, err := data.Write(compose(s.From, msg)); err != nil {
+		data.Close()
+		return fmt.Errorf("DATA: %w", err)
+	}
+	if err := data.Close(); err != nil {
+		return fmt.Errorf("DATA: %w", err)
+	}
+	return nil
+}
+
+// Close ends the open connection, if any, with QUIT
+func (s *SMTP) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client == nil {
+		return nil
+	}
+	s.conn.SetDeadline(time.Now().Add(s.Timeout))
+	err := s.client.Quit()
+	s.conn.Close()
+	s.client, s.conn = nil, nil
+	return err
+}
+
+func (s *SMTP) closeLocked() {
+	s.client.Close()
+	s.client, s.conn = nil, nil
+}
+
+// helloName is the name sent with EHLO: the machine's hostname, or localhost
+func helloName() string {
+	if name, err := os.Hostname(); err == nil && name != "" {
+		return name
+	}
+	return "localhost"
+}
+
+func isLocalhost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func durationEnv(key string, defaultValue time.Duration) (time.Duration, error) {
+	value := getEnv(key, "")
+	if value == "" {
+		return defaultValue, nil
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed <= 0 {
+		return 0, fmt.Errorf("%s must be a positive duration such as 10s, got %q", key, value)
+	}
+	return parsed, nil
+}
+
+// compose renders msg as a MIME message: text/plain, or multipart/alternative when
+// there is an HTML part
+func compose(from string, msg Message) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	if msg.HTML == "" {
+		writePart(&buf, "text/plain", msg.Text)
+		return buf.Bytes()
+	}
+
+	boundary := newBoundary()
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+	fmt.Fprintf(&buf, "--%s\r\n", boundary)
+	writePart(&buf, "text/plain", msg.Text)
+	fmt.Fprintf(&buf, "\r\n--%s\r\n", boundary)
+	writePart(&buf, "text/html", msg.HTML)
+	fmt.Fprintf(&buf, "\r\n--%s--\r\n", boundary)
+	return buf.Bytes()
+}
+
+// writePart writes the headers and quoted-printable body of one MIME part
+func writePart(buf *bytes.Buffer, contentType, body string) {
+	fmt.Fprintf(buf, "Content-Type: %s; charset=utf-8\r\n", contentType)
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	qp := quotedprintable.NewWriter(buf)
+	qp.Write([]byte(body))
+	qp.Close()
+}
+
+func newBoundary() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
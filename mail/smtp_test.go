@@ -0,0 +1,234 @@
+package mail
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockSMTP is a minimal SMTP server for tests. It accepts AUTH PLAIN with one set
+// of credentials, records delivered messages and can offer STARTTLS or stall.
+type mockSMTP struct {
+	listener net.Listener
+	username string
+	password string
+	// startTLS, when set, is offered as the STARTTLS extension
+	startTLS *tls.Config
+	// stall makes the server stop answering after the greeting
+	stall bool
+
+	mu       sync.Mutex
+	conns    int
+	messages []string
+}
+
+func newMockSMTP(t *testing.T, configure func(*mockSMTP)) *mockSMTP {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	server := &mockSMTP{listener: listener, username: "mailer", password: "hunter2"}
+	if configure != nil {
+		configure(server)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			server.mu.Lock()
+			server.conns++
+			server.mu.Unlock()
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+// client returns an SMTP mailer pointed at the server
+func (m *mockSMTP) client(mode string) *SMTP {
+	return &SMTP{
+		Addr:        m.listener.Addr().String(),
+		Host:        "127.0.0.1",
+		Username:    m.username,
+		Password:    m.password,
+		From:        "noreply@example.com",
+		TLS:         mode,
+		Timeout:     2 * time.Second,
+		IdleTimeout: time.Minute,
+	}
+}
+
+func (m *mockSMTP) stats() (conns int, messages []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.conns, append([]string(nil), m.messages...)
+}
+
+func (m *mockSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 mock ESMTP")
+	if m.stall {
+		bufio.NewReader(conn).ReadString(0)
+		return
+	}
+
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			text.PrintfLine("250-mock")
+			if m.startTLS != nil {
+				text.PrintfLine("250-STARTTLS")
+			}
+			text.PrintfLine("250 AUTH PLAIN")
+		case "STARTTLS":
+			text.PrintfLine("220 ready")
+			tlsConn := tls.Server(conn, m.startTLS)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, text = tlsConn, textproto.NewConn(tlsConn)
+		case "AUTH":
+			_, encoded, _ := strings.Cut(arg, " ")
+			decoded, _ := base64.StdEncoding.DecodeString(encoded)
+			if string(decoded) == "\x00"+m.username+"\x00"+m.password {
+				text.PrintfLine("235 authenticated")
+			} else {
+				text.PrintfLine("535 authentication failed")
+			}
+		case "MAIL", "RCPT", "RSET", "NOOP":
+			text.PrintfLine("250 ok")
+		case "DATA":
+			text.PrintfLine("354 go ahead")
+			body, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			m.mu.Lock()
+			m.messages = append(m.messages, string(body))
+			m.mu.Unlock()
+			text.PrintfLine("250 queued")
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("502 unknown command")
+		}
+	}
+}
+
+func TestSMTPSendReusesConnection(t *testing.T) {
+	server := newMockSMTP(t, nil)
+	mailer := server.client(TLSNone)
+	defer mailer.Close()
+
+	for _, subject := range []string{"First", "Second"} {
+		msg := Message{To: "alice@example.com", Subject: subject, Text: "Hello", HTML: "<p>Hello</p>"}
+		if err := mailer.Send(context.Background(), msg); err != nil {
+			t.Fatalf("send %s: %v", subject, err)
+		}
+	}
+
+	conns, messages := server.stats()
+	if conns != 1 {
+		t.Errorf("opened %d connections, want 1 reused for both messages", conns)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("server got %d messages, want 2", len(messages))
+	}
+	for _, header := range []string{"From: noreply@example.com", "To: alice@example.com", "Subject: First", "multipart/alternative"} {
+		if !strings.Contains(messages[0], header) {
+			t.Errorf("message does not contain %q:\n%s", header, messages[0])
+		}
+	}
+}
+
+func TestSMTPSendReconnectsAfterIdleTimeout(t *testing.T) {
+	server := newMockSMTP(t, nil)
+	mailer := server.client(TLSNone)
+	mailer.IdleTimeout = time.Nanosecond
+	defer mailer.Close()
+
+	for i := 0; i < 2; i++ {
+		if err := mailer.Send(context.Background(), Message{To: "alice@example.com", Subject: "Hi", Text: "Hello"}); err != nil {
+			t.Fatalf("send %d: %v", i, err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if conns, _ := server.stats(); conns != 2 {
+		t.Errorf("opened %d connections, want a new one after the idle timeout", conns)
+	}
+}
+
+func TestSMTPAuthFailure(t *testing.T) {
+	server := newMockSMTP(t, nil)
+	mailer := server.client(TLSNone)
+	mailer.Password = "wrong"
+
+	err := mailer.Send(context.Background(), Message{To: "alice@example.com", Subject: "Hi", Text: "Hello"})
+	if !errors.Is(err, ErrAuthFailed) || !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("send with bad credentials: got %v, want ErrAuthFailed wrapped in ErrUnavailable", err)
+	}
+	if _, messages := server.stats(); len(messages) != 0 {
+		t.Errorf("server got %d messages after failed auth", len(messages))
+	}
+}
+
+func TestSMTPStartTLSRequired(t *testing.T) {
+	server := newMockSMTP(t, nil)
+
+	err := server.client(TLSStartTLS).Send(context.Background(), Message{To: "alice@example.com", Subject: "Hi", Text: "Hello"})
+	if !errors.Is(err, ErrUnavailable) || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("send to a server without STARTTLS: got %v, want ErrUnavailable", err)
+	}
+}
+
+func TestSMTPStartTLSVerifiesCertificate(t *testing.T) {
+	// httptest's certificate is self-signed, so the client must refuse it
+	tlsServer := httptest.NewTLSServer(nil)
+	defer tlsServer.Close()
+	server := newMockSMTP(t, func(m *mockSMTP) { m.startTLS = tlsServer.TLS })
+
+	err := server.client(TLSStartTLS).Send(context.Background(), Message{To: "alice@example.com", Subject: "Hi", Text: "Hello"})
+	if !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("send over STARTTLS with an untrusted certificate: got %v, want ErrUnavailable", err)
+	}
+	if _, messages := server.stats(); len(messages) != 0 {
+		t.Errorf("server got %d messages over an unverified connection", len(messages))
+	}
+}
+
+func TestSMTPSendTimeout(t *testing.T) {
+	server := newMockSMTP(t, func(m *mockSMTP) { m.stall = true })
+	mailer := server.client(TLSNone)
+	mailer.Timeout = 200 * time.Millisecond
+
+	start := time.Now()
+	err := mailer.Send(context.Background(), Message{To: "alice@example.com", Subject: "Hi", Text: "Hello"})
+	if err == nil {
+		t.Fatal("send to a stalled server succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("send gave up after %s, want about the 200ms timeout", elapsed)
+	}
+}
@@ -0,0 +1,154 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+//go:embed templates/*.tmpl
+var embedded embed.FS
+
+// Data is the typed input of one email template. Each implementation names the
+// template it fills.
+type Data interface {
+	Template() string
+}
+
+// VerifyEmail confirms the address a user registered with
+type VerifyEmail struct {
+	Link      string
+	ExpiresAt time.Time
+}
+
+func (VerifyEmail) Template() string { return "verify_email" }
+
+// EmailChange confirms the new address of a pending email change
+type EmailChange struct {
+	Link      string
+	NewEmail  string
+	ExpiresAt time.Time
+}
+
+func (EmailChange) Template() string { return "email_change" }
+
+// OrgInvite tells the invitee who invited them to which organization
+type OrgInvite struct {
+	Link         string
+	Organization string
+	Role         string
+	InvitedBy    string
+	ExpiresAt    time.Time
+}
+
+func (OrgInvite) Template() string { return "org_invite" }
+
+// templateNames lists every template the service sends; each must have a text body
+var templateNames = []string{
+	VerifyEmail{}.Template(),
+	EmailChange{}.Template(),
+	OrgInvite{}.Template(),
+}
+
+// emailTemplate is one parsed template. The text template defines a "subject"
+// block next to its body; html is nil when the email is text only.
+type emailTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// Templates holds the parsed email templates
+type Templates struct {
+	byName map[string]emailTemplate
+}
+
+// LoadTemplates parses the embedded templates. Files in dir, when set, replace the
+// embedded file of the same name (<name>.txt.tmpl or <name>.html.tmpl).
+func LoadTemplates(dir string) (*Templates, error) {
+	t := &Templates{byName: make(map[string]emailTemplate, len(templateNames))}
+	for _, name := range templateNames {
+		textSource, err := readTemplate(dir, name+".txt.tmpl")
+		if err != nil {
+			return nil, err
+		}
+		if textSource == "" {
+			return nil, fmt.Errorf("email template %s.txt.tmpl is missing", name)
+		}
+		text, err := texttemplate.New(name).Option("missingkey=error").Parse(textSource)
+		if err != nil {
+			return nil, fmt.Errorf("parsing email template %s: %w", name, err)
+		}
+		if text.Lookup("subject") == nil {
+			return nil, fmt.Errorf("email template %s.txt.tmpl does not define a subject", name)
+		}
+
+		entry := emailTemplate{text: text}
+		htmlSource, err := readTemplate(dir, name+".html.tmpl")
+		if err != nil {
+			return nil, err
+		}
+		if htmlSource != "" {
+			if entry.html, err = htmltemplate.New(name).Option("missingkey=error").Parse(htmlSource); err != nil {
+				return nil, fmt.Errorf("parsing email template %s: %w", name, err)
+			}
+		}
+		t.byName[name] = entry
+	}
+	return t, nil
+}
+
+// readTemplate returns file from dir when it exists there, otherwise the embedded
+// copy, or "" when there is neither
+func readTemplate(dir, file string) (string, error) {
+	if dir != "" {
+		content, err := os.ReadFile(filepath.Join(dir, file))
+		if err == nil {
+			return string(content), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+	}
+	content, err := embedded.ReadFile("templates/" + file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	return string(content), err
+}
+
+// Render fills the template data names and returns the message for to
+func (t *Templates) Render(to string, data Data) (Message, error) {
+	entry, ok := t.byName[data.Template()]
+	if !ok {
+		return Message{}, fmt.Errorf("unknown email template %q", data.Template())
+	}
+
+	var subject, text bytes.Buffer
+	if err := entry.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, fmt.Errorf("rendering email template %s: %w", data.Template(), err)
+	}
+	if err := entry.text.Execute(&text, data); err != nil {
+		return Message{}, fmt.Errorf("rendering email template %s: %w", data.Template(), err)
+	}
+	msg := Message{
+		To:      to,
+		Subject: strings.Join(strings.Fields(subject.String()), " "),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+	}
+	if entry.html != nil {
+		var html bytes.Buffer
+		if err := entry.html.Execute(&html, data); err != nil {
+			return Message{}, fmt.Errorf("rendering email template %s: %w", data.Template(), err)
+		}
+		msg.HTML = html.String()
+	}
+	return msg, nil
+}
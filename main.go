@@ -1,21 +1,102 @@
 package main
 
 import (
+	"auth-service/audit"
+	"auth-service/config"
 	"auth-service/database"
 	"auth-service/handlers"
+	"auth-service/janitor"
+	"auth-service/mail"
 	"auth-service/middleware"
+	"auth-service/oauth"
+	"auth-service/tracing"
+	"context"
+	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"net/http/pprof"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
 )
 
+// Build information, injected at build time with
+// -ldflags "-X main.version=... -X main.commit=... -X main.buildTime=..."
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildTime = "unknown"
+)
+
+var buildInfo = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "auth_service_build_info",
+	Help: "Build information of the running auth-service; always 1.",
+}, []string{"version", "commit", "build_time"})
+
 func main() {
+	buildInfo.WithLabelValues(version, commit, buildTime).Set(1)
+	log.Printf("auth-service %s (commit %s, built %s)", version, commit, buildTime)
+
+	// Initialize tracing (no-op unless OTEL_EXPORTER_OTLP_ENDPOINT is set)
+	shutdownTracer, err := tracing.InitTracer(context.Background())
+	if err != nil {
+		log.Fatal("Failed to initialize tracing:", err)
+	}
+	defer shutdownTracer(context.Background())
+
+	// Load and validate downstream service URLs before accepting traffic
+	services, err := config.LoadServices()
+	if err != nil {
+		log.Fatal("Invalid downstream service configuration: ", err)
+	}
+
+	// Load the JWT secret once; weak or missing secrets are fatal in production
+	jwtConfig, err := config.LoadJWT()
+	if err != nil {
+		log.Fatal("Invalid JWT configuration: ", err)
+	}
+	middleware.SetJWTConfig(jwtConfig)
+
+	// OAuth providers are enabled by setting their client ID and secret
+	oauthProviders := oauth.LoadProviders()
+	if names := oauthProviders.Names(); len(names) > 0 {
+		log.Printf("OAuth providers enabled: %v", names)
+	}
+
+	// Notification emails go to the log unless MAIL_DRIVER selects a transport
+	mailSender, err := mail.Load()
+	if err != nil {
+		log.Fatal("Invalid mail configuration: ", err)
+	}
+
 	// Initialize database
 	database.InitDB()
 
+	// Wire the package-level handlers to their dependencies
+	handlers.SetDefault(handlers.New(database.DB, services, jwtConfig, oauthProviders, mailSender))
+
+	// Security events are written to the audit log in the background
+	auditWriter := audit.Start(database.DB)
+
+	// Background jobs stop, releasing their leader locks, on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Periodically delete expired idempotency keys, invites and email tokens
+	var janitorDone <-chan struct{}
+	if getEnv("JANITOR_ENABLED", "true") != "false" {
+		janitorDone = janitor.Start(ctx, database.DB, getEnvDuration("JANITOR_INTERVAL", time.Hour))
+	}
+
 	// Get underlying sql.DB to properly close connection
 	sqlDB, err := database.DB.DB()
 	if err != nil {
@@ -25,69 +106,335 @@ func main() {
 
 	// Setup routes
 	router := mux.NewRouter()
+
+	// Per-group request time limits: quick for auth/CRUD, longer for calls that wait
+	// on the downstream services, and generous for video downloads
+	authTimeout := middleware.Timeout(getEnvDuration("REQUEST_TIMEOUT_AUTH", 15*time.Second))
+	proxyTimeout := middleware.Timeout(getEnvDuration("REQUEST_TIMEOUT_PROXY", 60*time.Second))
+	downloadTimeout := middleware.Timeout(getEnvDuration("REQUEST_TIMEOUT_DOWNLOAD", 30*time.Minute))
 	
-	// Metrics endpoint
-	router.Handle("/metrics", promhttp.Handler()).Methods("GET")
+	// Probes and scrapes get their own router, served ahead of the API router so none
+	// of its middleware (maintenance, slow-request log, compression, CORS) applies
+	metricsAuth, err := middleware.MetricsAuth(getEnv("METRICS_AUTH", ""))
+	if err != nil {
+		log.Fatal("Invalid metrics configuration: ", err)
+	}
+	ops := opsRouter(metricsAuth)
 
-	// Health check
-	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(`{"status":"ok","service":"auth-service"}`))
-	}).Methods("GET")
+	// Dependency health for dashboards
+	router.HandleFunc("/status", authTimeout(handlers.Status)).Methods("GET")
 
 	// Public routes
-	router.HandleFunc("/auth/register", handlers.Register).Methods("POST")
-	router.HandleFunc("/auth/login", handlers.Login).Methods("POST")
+	router.HandleFunc("/auth/register", authTimeout(handlers.Register)).Methods("POST")
+	router.HandleFunc("/auth/login", authTimeout(handlers.Login)).Methods("POST")
+	router.HandleFunc("/auth/email/confirm", authTimeout(handlers.ConfirmEmailChange)).Methods("GET")
+	router.HandleFunc("/auth/verify", authTimeout(handlers.VerifyEmail)).Methods("GET")
+	router.HandleFunc("/auth/verify/resend", authTimeout(handlers.ResendVerification)).Methods("POST")
+	// Share links work without logging in; the signed token is the credential
+	router.HandleFunc("/auth/share/{token}", authTimeout(handlers.OpenShareLink)).Methods("GET")
+	router.HandleFunc("/auth/oauth/{provider}/login", authTimeout(handlers.OAuthLogin)).Methods("GET")
+	router.HandleFunc("/auth/oauth/{provider}/callback", authTimeout(handlers.OAuthCallback)).Methods("GET")
 
 	// Protected routes (require authentication)
+	router.HandleFunc("/auth/whoami",
+		authTimeout(middleware.AuthMiddleware(handlers.Whoami))).Methods("GET")
+	router.HandleFunc("/auth/password",
+		authTimeout(middleware.AuthMiddleware(handlers.ChangePassword))).Methods("POST")
 	router.HandleFunc("/auth/profile",
-		middleware.AuthMiddleware(handlers.GetProfile)).Methods("GET")
+		authTimeout(middleware.AuthMiddleware(handlers.GetProfile))).Methods("GET")
 	router.HandleFunc("/auth/profile",
-		middleware.AuthMiddleware(handlers.UpdateProfile)).Methods("PUT")
+		authTimeout(middleware.AuthMiddleware(handlers.UpdateProfile))).Methods("PUT")
+	router.HandleFunc("/auth/profile",
+		authTimeout(middleware.AuthMiddleware(handlers.PatchProfile))).Methods("PATCH")
+	router.HandleFunc("/auth/account/soft",
+		authTimeout(middleware.AuthMiddleware(handlers.DeleteAccount))).Methods("DELETE")
+	// Organization routes; member changes need the org admin role, except leaving
+	router.HandleFunc("/auth/org",
+		authTimeout(middleware.AuthMiddleware(handlers.GetOrganization))).Methods("GET")
+	router.HandleFunc("/auth/org",
+		authTimeout(middleware.AuthMiddleware(handlers.CreateOrganization))).Methods("POST")
+	router.HandleFunc("/auth/org/members",
+		authTimeout(middleware.AuthMiddleware(handlers.InviteOrgMember))).Methods("POST")
+	router.HandleFunc("/auth/org/invites",
+		authTimeout(middleware.AuthMiddleware(handlers.ListOrgInvites))).Methods("GET")
+	router.HandleFunc("/auth/org/invites/{id}/accept",
+		authTimeout(middleware.AuthMiddleware(handlers.AcceptOrgInvite))).Methods("POST")
+	router.HandleFunc("/auth/org/invites/{id}",
+		authTimeout(middleware.AuthMiddleware(handlers.DeclineOrgInvite))).Methods("DELETE")
+	router.HandleFunc("/auth/org/members/{id}",
+		authTimeout(middleware.AuthMiddleware(handlers.UpdateOrgMember))).Methods("PATCH")
+	router.HandleFunc("/auth/org/members/{id}",
+		authTimeout(middleware.AuthMiddleware(handlers.RemoveOrgMember))).Methods("DELETE")
+	// Admin routes (require the admin role)
+	router.HandleFunc("/auth/admin/users",
+		authTimeout(middleware.AuthMiddleware(middleware.RequireAdmin(handlers.ListUsers)))).Methods("GET")
+	router.HandleFunc("/auth/admin/users",
+		authTimeout(middleware.AuthMiddleware(middleware.RequireAdmin(handlers.CreateUser)))).Methods("POST")
+	router.HandleFunc("/auth/admin/users/import",
+		proxyTimeout(middleware.AuthMiddleware(middleware.RequireAdmin(handlers.ImportUsers)))).Methods("POST")
+	router.HandleFunc("/auth/admin/invites",
+		authTimeout(middleware.AuthMiddleware(middleware.RequireAdmin(handlers.CreateInvite)))).Methods("POST")
+	router.HandleFunc("/auth/admin/users/{id}",
+		authTimeout(middleware.AuthMiddleware(middleware.RequireAdmin(handlers.GetUser)))).Methods("GET")
+	router.HandleFunc("/auth/admin/users/{id}/restore",
+		authTimeout(middleware.AuthMiddleware(middleware.RequireAdmin(handlers.RestoreUser)))).Methods("POST")
+	router.HandleFunc("/auth/admin/users/{id}/suspend",
+		authTimeout(middleware.AuthMiddleware(middleware.RequireAdmin(handlers.SuspendUser)))).Methods("POST")
+	router.HandleFunc("/auth/admin/users/{id}/unsuspend",
+		authTimeout(middleware.AuthMiddleware(middleware.RequireAdmin(handlers.UnsuspendUser)))).Methods("POST")
+	router.HandleFunc("/auth/admin/users/{id}/require-password-change",
+		authTimeout(middleware.AuthMiddleware(middleware.RequireAdmin(handlers.RequirePasswordChange)))).Methods("POST")
+	router.HandleFunc("/auth/admin/maintenance",
+		authTimeout(middleware.AuthMiddleware(middleware.RequireAdmin(handlers.GetMaintenance)))).Methods("GET")
+	router.HandleFunc("/auth/admin/maintenance",
+		authTimeout(middleware.AuthMiddleware(middleware.RequireAdmin(handlers.SetMaintenance)))).Methods("PUT")
+	router.HandleFunc("/auth/admin/jobs",
+		authTimeout(middleware.AuthMiddleware(middleware.RequireAdmin(handlers.ListAdminJobs)))).Methods("GET")
+	router.HandleFunc("/auth/admin/gpu-stats",
+		authTimeout(middleware.AuthMiddleware(middleware.RequireAdmin(handlers.GetGPUStats)))).Methods("GET")
+	router.HandleFunc("/auth/admin/audit",
+		authTimeout(middleware.AuthMiddleware(middleware.RequireAdmin(handlers.ListAuditLogs)))).Methods("GET")
 	// Video analysis routes
 	router.HandleFunc("/auth/video/analyze",
-		middleware.AuthMiddleware(handlers.AnalyzeVideoProxy)).Methods("POST")
+		proxyTimeout(middleware.AuthMiddleware(handlers.AnalyzeVideoProxy))).Methods("POST")
 	router.HandleFunc("/auth/video/analyze",
-		middleware.AuthMiddleware(handlers.GetVideoAnalyses)).Methods("GET")
+		authTimeout(middleware.AuthMiddleware(handlers.GetVideoAnalyses))).Methods("GET")
+	router.HandleFunc("/auth/video/analyze/{id}",
+		authTimeout(middleware.AuthMiddleware(handlers.GetVideoAnalysesInfo))).Methods("GET")
 	router.HandleFunc("/auth/video/analyze/{id}",
-		middleware.AuthMiddleware(handlers.GetVideoAnalysesInfo)).Methods("GET")
+		authTimeout(middleware.AuthMiddleware(handlers.DeleteVideoAnalysis))).Methods("DELETE")
+	router.HandleFunc("/auth/video/analyze/{id}/rerun",
+		proxyTimeout(middleware.AuthMiddleware(handlers.RerunVideoAnalysis))).Methods("POST")
 	// Video transcoding routes
 	router.HandleFunc("/auth/video/transcode",
-		middleware.AuthMiddleware(handlers.TranscodeVideoProxy)).Methods("POST")
+		proxyTimeout(middleware.AuthMiddleware(handlers.TranscodeVideoProxy))).Methods("POST")
+	// Submit several transcoding jobs at once
+	router.HandleFunc("/auth/video/transcode/batch",
+		proxyTimeout(middleware.AuthMiddleware(handlers.TranscodeVideoBatchProxy))).Methods("POST")
 	// Get list of video transcodes
 	router.HandleFunc("/auth/video/transcode",
-		middleware.AuthMiddleware(handlers.GetVideoTranscodes)).Methods("GET")
+		authTimeout(middleware.AuthMiddleware(handlers.GetVideoTranscodes))).Methods("GET")
+	// Soft-delete many of the user's jobs by ID or status
+	router.HandleFunc("/auth/video/transcode",
+		authTimeout(middleware.AuthMiddleware(handlers.DeleteVideoTranscodes))).Methods("DELETE")
+	// Get the status of several video transcodes at once
+	router.HandleFunc("/auth/video/transcode/status",
+		authTimeout(middleware.AuthMiddleware(handlers.GetVideoTranscodeStatuses))).Methods("GET")
+	// Supported codecs, containers and quality presets
+	router.HandleFunc("/auth/video/transcode/options",
+		authTimeout(middleware.AuthMiddleware(handlers.GetTranscodeOptions))).Methods("GET")
 	// Get specific video transcode info
 	router.HandleFunc("/auth/video/transcode/{id}",
-		middleware.AuthMiddleware(handlers.GetVideoTranscodeInfo)).Methods("GET")
-	// Download video from S3
+		authTimeout(middleware.AuthMiddleware(handlers.GetVideoTranscodeInfo))).Methods("GET")
+	// Retry a failed or cancelled video transcode
+	router.HandleFunc("/auth/video/transcode/{id}/retry",
+		proxyTimeout(middleware.AuthMiddleware(handlers.RetryVideoTranscode))).Methods("POST")
+	// Download video from S3; these two routes also accept a ?download_token= minted below
 	router.HandleFunc("/auth/video/transcode/{id}/download",
-		middleware.AuthMiddleware(handlers.DownloadVideoFromS3)).Methods("GET")
-	// CORS middleware for development
-	router.Use(corsMiddleware)
+		downloadTimeout(middleware.DownloadAuth(handlers.DownloadVideoFromS3))).Methods("GET", "HEAD")
+	// Redirect to a short-lived presigned S3 URL (for browser playback)
+	router.HandleFunc("/auth/video/transcode/{id}/stream",
+		authTimeout(middleware.DownloadAuth(handlers.StreamVideoFromS3))).Methods("GET")
+	router.HandleFunc("/auth/video/transcode/{id}/download-token",
+		authTimeout(middleware.AuthMiddleware(handlers.CreateDownloadToken))).Methods("POST")
+	router.HandleFunc("/auth/video/transcode/{id}/share",
+		authTimeout(middleware.AuthMiddleware(handlers.CreateShareLink))).Methods("POST")
+	router.HandleFunc("/auth/video/transcode/{id}/share",
+		authTimeout(middleware.AuthMiddleware(handlers.ListShareLinks))).Methods("GET")
+	router.HandleFunc("/auth/video/transcode/{id}/share/{share_id}",
+		authTimeout(middleware.AuthMiddleware(handlers.RevokeShareLink))).Methods("DELETE")
+	// Live job status updates; no timeout since the socket outlives the request
+	router.HandleFunc("/auth/ws",
+		middleware.QueryToken(middleware.AuthMiddleware(handlers.JobUpdatesSocket))).Methods("GET")
+	// Internal routes (service-to-service only, require X-Service-Token)
+	router.HandleFunc("/internal/auth/introspect",
+		authTimeout(middleware.RequireServiceToken(handlers.IntrospectToken))).Methods("POST")
+	router.HandleFunc("/internal/video/transcode/{id}/status",
+		authTimeout(middleware.RequireServiceToken(handlers.UpdateTranscodeStatus))).Methods("PUT")
+	// Profiling endpoints, only when explicitly enabled and behind the service token
+	if getEnv("ENABLE_PPROF", "false") == "true" {
+		router.HandleFunc("/debug/pprof/cmdline", middleware.RequireServiceToken(pprof.Cmdline))
+		router.HandleFunc("/debug/pprof/profile", middleware.RequireServiceToken(pprof.Profile))
+		router.HandleFunc("/debug/pprof/symbol", middleware.RequireServiceToken(pprof.Symbol))
+		router.HandleFunc("/debug/pprof/trace", middleware.RequireServiceToken(pprof.Trace))
+		router.PathPrefix("/debug/pprof/").HandlerFunc(middleware.RequireServiceToken(pprof.Index))
+		log.Println("pprof endpoints enabled under /debug/pprof")
+	}
+	// JSON envelopes for unknown paths and wrong methods. mux does not run router
+	// middleware for these, so the request ID is added here.
+	router.NotFoundHandler = middleware.RequestID(http.HandlerFunc(handlers.NotFound))
+	router.MethodNotAllowedHandler = middleware.RequestID(handlers.MethodNotAllowed(router))
+
+	// Tag each request with an X-Request-ID (echoed in JSON error bodies)
+	router.Use(middleware.RequestID)
+	// Warn about requests slower than SLOW_REQUEST_THRESHOLD, with user and downstream timing
+	router.Use(middleware.SlowRequestLog)
+	// Reject writes with 503 while maintenance mode is on
+	router.Use(middleware.Maintenance)
+	// Reject request bodies that are not JSON with 415 (upload routes are exempt)
+	router.Use(middleware.RequireJSON)
+	// Server span per request, named after the route template
+	router.Use(otelmux.Middleware("auth-service"))
+	// Request counts, latency and body sizes per route template (sizes as sent on the wire)
+	router.Use(middleware.MetricsMiddleware)
+	// Gzip JSON responses for clients that accept it (video streams are left as-is)
+	router.Use(middleware.Compress)
 
 	// Get port from environment
 	port := getEnv("PORT", "8080")
 
 	log.Printf("Auth service starting on port %s", port)
-	log.Fatal(http.ListenAndServe("0.0.0.0:"+port, router))
+	// CORS wraps the router rather than using router.Use: mux answers OPTIONS on
+	// method-restricted routes with 405 before route middleware runs
+	cors := corsMiddleware()
+	server := &http.Server{Addr: "0.0.0.0:" + port, Handler: opsFirst(ops, cors(router))}
+
+	// On a shutdown signal stop accepting connections and let in-flight requests finish
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		shutdownServer(server)
+	}()
+
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	<-shutdownDone
+	// Requests have finished, so no more audit events are coming
+	auditWriter.Close()
+	mailSender.Close()
+	if janitorDone != nil {
+		<-janitorDone
+	}
 }
 
-// CORS middleware for development
-func corsMiddleware(next http.Handler) http.Handler {
+// opsRouter serves the metrics endpoint, optionally behind metricsAuth (basic auth or
+// the service token), and the liveness and readiness probes
+func opsRouter(metricsAuth func(http.Handler) http.Handler) *mux.Router {
+	ops := mux.NewRouter()
+	ops.Handle("/metrics", metricsAuth(promhttp.Handler())).Methods("GET")
+	ops.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{
+			"status":     "ok",
+			"service":    "auth-service",
+			"version":    version,
+			"commit":     commit,
+			"build_time": buildTime,
+		})
+	}).Methods("GET")
+	ops.HandleFunc("/ready", handlers.Ready).Methods("GET")
+	ops.MethodNotAllowedHandler = middleware.RequestID(handlers.MethodNotAllowed(ops))
+	ops.Use(middleware.RequestID)
+	ops.Use(middleware.MetricsMiddleware)
+	return ops
+}
+
+// opsFirst serves requests matching a route of ops (any method) with ops and
+// everything else with api
+func opsFirst(ops *mux.Router, api http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		var match mux.RouteMatch
+		if ops.Match(r, &match) || match.MatchErr == mux.ErrMethodMismatch {
+			ops.ServeHTTP(w, r)
+			return
+		}
+		api.ServeHTTP(w, r)
+	})
+}
+
+// shutdownServer stops accepting connections and waits for in-flight requests for
+// SHUTDOWN_TIMEOUT. New downloads are refused right away, but downloads already
+// streaming may run for up to SHUTDOWN_DOWNLOAD_DRAIN_TIMEOUT (from the signal) so a
+// deploy does not cut them off.
+func shutdownServer(server *http.Server) {
+	grace := getEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second)
+	drain := getEnvDuration("SHUTDOWN_DOWNLOAD_DRAIN_TIMEOUT", 10*time.Minute)
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), max(grace, drain))
+	defer cancelDrain()
 
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
+	active := handlers.StopDownloads()
+	log.Printf("Shutting down, %d downloads in progress", active)
+
+	// Past the grace period only downloads are waited for
+	shutdownCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-time.After(grace):
+		case <-shutdownCtx.Done():
 			return
 		}
+		if active := handlers.ActiveDownloads(); active > 0 {
+			log.Printf("Shutdown grace period over, waiting for %d downloads to finish", active)
+			if active := handlers.DrainDownloads(drainCtx); active > 0 {
+				log.Printf("Download drain window over, cutting off %d downloads", active)
+			}
+		}
+		cancel()
+	}()
 
-		next.ServeHTTP(w, r)
-	})
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Server shutdown: %v", err)
+	} else if active > 0 {
+		log.Printf("All downloads finished")
+	}
+}
+
+// corsMiddleware builds the CORS policy for each route group. The public API allows
+// CORS_ALLOWED_ORIGINS, admin routes CORS_ADMIN_ALLOWED_ORIGINS (the public list unless
+// set) and the service-to-service routes no browser origins at all. Preflight
+// responses may be cached for CORS_MAX_AGE, and the allowed headers list every request
+// header the API reads.
+func corsMiddleware() func(http.Handler) http.Handler {
+	public := middleware.CORSConfig{
+		AllowedOrigins: getEnvList("CORS_ALLOWED_ORIGINS", "*"),
+		AllowedMethods: []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders: []string{
+			"Content-Type",
+			"Authorization",
+			"Range",
+			"If-None-Match",
+			middleware.RequestIDHeader,
+			handlers.IdempotencyKeyHeader,
+		},
+		ExposedHeaders: []string{
+			"Content-Disposition", "Content-Length", "Content-Range", "Accept-Ranges", "ETag", "Retry-After", "Link",
+			"X-Total-Count", "X-Request-ID", "X-Video-Duration", "X-Video-Bitrate", "X-Video-Resolution", "X-Video-Codec",
+		},
+		AllowCredentials: getEnv("CORS_ALLOW_CREDENTIALS", "false") == "true",
+		MaxAge:           getEnvDuration("CORS_MAX_AGE", 10*time.Minute),
+	}
+
+	admin := public
+	admin.AllowedOrigins = getEnvList("CORS_ADMIN_ALLOWED_ORIGINS", strings.Join(public.AllowedOrigins, ","))
+
+	// Internal callers are services, not browsers
+	internal := middleware.CORSConfig{}
+
+	return middleware.CORSByPrefix(public,
+		middleware.CORSRoute{Prefix: "/auth/admin/", Config: admin},
+		middleware.CORSRoute{Prefix: "/internal/", Config: internal},
+		middleware.CORSRoute{Prefix: "/debug/", Config: internal},
+	)
+}
+
+// getEnvList splits a comma-separated variable, dropping empty entries. "none" gives
+// an empty list.
+func getEnvList(key, defaultValue string) []string {
+	value := getEnv(key, defaultValue)
+	if value == "none" {
+		return nil
+	}
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
 
 func getEnv(key, defaultValue string) string {
@@ -96,3 +443,13 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil && parsed > 0 {
+			return parsed
+		}
+		log.Printf("Invalid duration for %s: %q, using default %s", key, value, defaultValue)
+	}
+	return defaultValue
+}
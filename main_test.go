@@ -0,0 +1,59 @@
+package main
+
+import (
+	"auth-service/middleware"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// TestOpsBypassAPIMiddleware checks that probes and scrapes are answered without an
+// Authorization header even when every API request must authenticate
+func TestOpsBypassAPIMiddleware(t *testing.T) {
+	metricsAuth, err := middleware.MetricsAuth("")
+	if err != nil {
+		t.Fatalf("MetricsAuth: %v", err)
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/auth/whoami", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	api := middleware.AuthMiddleware(router.ServeHTTP)
+	handler := opsFirst(opsRouter(metricsAuth), api)
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+
+	rec := serve(http.MethodGet, "/health")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /health without Authorization: got %d %s, want 200", rec.Code, rec.Body.String())
+	}
+	var health map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &health); err != nil || health["status"] != "ok" {
+		t.Errorf("GET /health body = %s, want status ok", rec.Body.String())
+	}
+
+	if rec := serve(http.MethodGet, "/metrics"); rec.Code != http.StatusOK {
+		t.Errorf("GET /metrics without Authorization: got %d, want 200", rec.Code)
+	}
+
+	// A wrong method on a probe is still answered by the ops router, not the API's auth
+	if rec := serve(http.MethodPost, "/health"); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /health: got %d, want 405", rec.Code)
+	}
+
+	// Everything else still goes through the API middleware
+	if rec := serve(http.MethodGet, "/auth/whoami"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET /auth/whoami without Authorization: got %d, want 401", rec.Code)
+	}
+	if rec := serve(http.MethodGet, "/healthz"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET /healthz without Authorization: got %d, want 401 from the API", rec.Code)
+	}
+}
@@ -1,53 +1,239 @@
 package middleware
 
 import (
-    "context"
+    "auth-service/config"
+    "auth-service/database"
+    "auth-service/models"
+    "errors"
+    "log"
+    "math"
     "net/http"
     "os"
     "strings"
+    "time"
 
     "github.com/golang-jwt/jwt/v5"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/trace"
+    "gorm.io/gorm"
 )
 
-var jwtSecret = []byte(getEnv("JWT_SECRET", "your-secret-key"))
+// jwtConfig is injected once at startup, before the server accepts requests
+var jwtConfig *config.JWT
+
+// SetJWTConfig sets the JWT settings used to validate tokens
+func SetJWTConfig(c *config.JWT) {
+    jwtConfig = c
+}
+
+// passwordChangePaths stay usable while the account must change its password
+var passwordChangePaths = map[string]bool{
+    "/auth/password": true,
+    "/auth/whoami":   true,
+}
+
+// QueryToken accepts the access token as an access_token query parameter, for
+// clients such as browser WebSockets that cannot set the Authorization header.
+// A header, when present, wins.
+func QueryToken(next http.HandlerFunc) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        if token := r.URL.Query().Get("access_token"); token != "" && r.Header.Get("Authorization") == "" {
+            r.Header.Set("Authorization", "Bearer "+token)
+        }
+        next(w, r)
+    }
+}
 
 func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
         authHeader := r.Header.Get("Authorization")
         if authHeader == "" {
-            http.Error(w, "Authorization header required", http.StatusUnauthorized)
+            tokenValidationFailures.WithLabelValues("missing_header").Inc()
+            writeJSONError(w, http.StatusUnauthorized, "authorization_required", "Authorization header required")
             return
         }
         
         bearerToken := strings.Split(authHeader, " ")
         if len(bearerToken) != 2 || bearerToken[0] != "Bearer" {
-            http.Error(w, "Invalid authorization format", http.StatusUnauthorized)
+            tokenValidationFailures.WithLabelValues("malformed_header").Inc()
+            writeJSONError(w, http.StatusUnauthorized, "invalid_authorization", "Invalid authorization format")
             return
         }
         
-        token, err := jwt.Parse(bearerToken[1], func(token *jwt.Token) (interface{}, error) {
-            return jwtSecret, nil
-        })
+        // Tokens must expire, and must say when they were issued so revocation can apply
+        token, err := jwt.Parse(bearerToken[1], tokenKey(r), jwt.WithLeeway(jwtConfig.Leeway),
+            jwt.WithExpirationRequired(), jwt.WithIssuedAt())
         
         if err != nil || !token.Valid {
-            http.Error(w, "Invalid token", http.StatusUnauthorized)
+            reason := "invalid_token"
+            switch {
+            case errors.Is(err, jwt.ErrTokenExpired):
+                reason = "expired"
+            case errors.Is(err, jwt.ErrTokenRequiredClaimMissing):
+                reason = "missing_claim"
+            }
+            tokenValidationFailures.WithLabelValues(reason).Inc()
+            writeJSONError(w, http.StatusUnauthorized, "invalid_token", "Invalid token")
             return
         }
         
         claims, ok := token.Claims.(jwt.MapClaims)
         if !ok {
-            http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+            tokenValidationFailures.WithLabelValues("invalid_claims").Inc()
+            writeJSONError(w, http.StatusUnauthorized, "invalid_token", "Invalid token claims")
+            return
+        }
+        if _, ok := claims["iat"].(float64); !ok {
+            tokenValidationFailures.WithLabelValues("missing_claim").Inc()
+            writeJSONError(w, http.StatusUnauthorized, "invalid_token", "Invalid token claims")
+            return
+        }
+        
+        // Tokens from a trusted issuer map to a local account by email
+        issuer := trustedIssuer(claims)
+        var userID uint
+        if issuer != nil {
+            if userID, ok = federatedUserID(w, issuer, claims); !ok {
+                return
+            }
+        } else if userID, ok = userIDFromClaim(claims["user_id"]); !ok {
+            tokenValidationFailures.WithLabelValues("invalid_claims").Inc()
+            writeJSONError(w, http.StatusUnauthorized, "invalid_token", "Invalid token claims")
+            return
+        }
+
+        // Tag the request span and any slow-request log line with the authenticated user
+        trace.SpanFromContext(r.Context()).SetAttributes(attribute.Int64("enduser.id", int64(userID)))
+        recordUser(r.Context(), userID)
+
+        user, ok := activeAccount(w, r, userID, IssuedAt(claims))
+        if !ok {
             return
         }
         
         // Add user info to context
-        ctx := context.WithValue(r.Context(), "user_id", claims["user_id"])
-        ctx = context.WithValue(ctx, "email", claims["email"])
+        email, _ := claims["email"].(string)
+        role, _ := claims["role"].(string)
+        // A federated token's role claim means nothing here; the local account decides
+        if issuer != nil {
+            email, role = user.Email, user.Role
+        }
+        ctx := WithUserID(r.Context(), userID)
+        ctx = withIdentity(ctx, email, role)
+        ctx = withClaims(ctx, claims)
+        // Membership is read live so removals from an organization apply immediately
+        if user.OrgID != nil {
+            ctx = withOrg(ctx, *user.OrgID, user.OrgRole)
+        }
         
         next.ServeHTTP(w, r.WithContext(ctx))
     }
 }
 
+// IssuedAt returns a token's iat claim to the millisecond. jwt.NumericDate would
+// truncate it to whole seconds.
+func IssuedAt(claims jwt.MapClaims) time.Time {
+    iat, _ := claims["iat"].(float64)
+    return time.UnixMilli(int64(math.Round(iat * 1000)))
+}
+
+// accountRefusal is why a token's account may not use it: the failure metric reason
+// and the error response
+type accountRefusal struct {
+    reason  string
+    status  int
+    code    string
+    message string
+}
+
+func (a *accountRefusal) Error() string {
+    return a.message
+}
+
+// checkAccount loads the account a token was issued to and checks its state, so
+// deletions, suspensions, revocations and forced password changes apply to live
+// tokens. path is the request path, for the routes a forced password change still
+// allows. A refused token gets an *accountRefusal; any other error is a database one.
+func checkAccount(userID uint, issuedAt time.Time, path string) (*models.User, error) {
+    var user models.User
+    if err := database.DB.Unscoped().Select("id", "email", "role", "status", "tokens_revoked_at", "deleted_at", "must_change_password", "org_id", "org_role").First(&user, userID).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return nil, &accountRefusal{"unknown_user", http.StatusUnauthorized, "invalid_token", "Invalid token"}
+        }
+        return nil, err
+    }
+
+    switch {
+    case user.DeletedAt.Valid:
+        return nil, &accountRefusal{"deleted", http.StatusForbidden, "account_deleted", "Account has been deleted"}
+    case user.IsSuspended():
+        return nil, &accountRefusal{"suspended", http.StatusForbidden, "account_suspended", "Account has been suspended"}
+    case user.TokenRevoked(issuedAt):
+        return nil, &accountRefusal{"revoked", http.StatusUnauthorized, "token_revoked", "Token has been revoked"}
+    // Until a forced password change is done, only the routes needed for it work
+    case user.MustChangePassword && !passwordChangePaths[path]:
+        return nil, &accountRefusal{"password_change_required", http.StatusForbidden, "password_change_required", "Password must be changed before using this endpoint"}
+    }
+    return &user, nil
+}
+
+// activeAccount runs checkAccount for a request. Deleted accounts are loaded too, to
+// answer account_deleted rather than a generic invalid token. On failure it writes
+// the error response and returns ok=false.
+func activeAccount(w http.ResponseWriter, r *http.Request, userID uint, issuedAt time.Time) (*models.User, bool) {
+    user, err := checkAccount(userID, issuedAt, r.URL.Path)
+    var refusal *accountRefusal
+    switch {
+    case errors.As(err, &refusal):
+        tokenValidationFailures.WithLabelValues(refusal.reason).Inc()
+        writeJSONError(w, refusal.status, refusal.code, refusal.message)
+        return nil, false
+    case err != nil:
+        log.Printf("Failed to load user %d for token check: %v", userID, err)
+        writeJSONError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+        return nil, false
+    }
+    return user, true
+}
+
+// TokenAccountActive reports whether a local token's account may still use it, by
+// the checks AuthMiddleware applies to every request outside the password change
+// routes. claims must already be verified. err is set only when the account could
+// not be loaded.
+func TokenAccountActive(claims jwt.MapClaims) (bool, error) {
+    userID, ok := userIDFromClaim(claims["user_id"])
+    if !ok {
+        return false, nil
+    }
+    return AccountActive(userID, IssuedAt(claims))
+}
+
+// AccountActive reports whether something userID issued at issuedAt, such as a token
+// or a share link, may still be used on their behalf, by the same checks as
+// TokenAccountActive. err is set only when the account could not be loaded.
+func AccountActive(userID uint, issuedAt time.Time) (bool, error) {
+    _, err := checkAccount(userID, issuedAt, "")
+    var refusal *accountRefusal
+    if errors.As(err, &refusal) {
+        return false, nil
+    }
+    return err == nil, err
+}
+
+// RequireAdmin only lets through users whose token carries the admin role.
+// It must be wrapped by AuthMiddleware so the role is present in the context.
+func RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        role, _ := RoleFromContext(r.Context())
+        if role != "admin" {
+            writeJSONError(w, http.StatusForbidden, "admin_required", "Admin access required")
+            return
+        }
+        
+        next.ServeHTTP(w, r)
+    }
+}
+
 func getEnv(key, defaultValue string) string {
     if value := os.Getenv(key); value != "" {
         return value
@@ -0,0 +1,183 @@
+package middleware
+
+import (
+	"auth-service/config"
+	"auth-service/database"
+	"auth-service/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var testSecret = []byte("0123456789abcdef0123456789abcdef")
+
+// setupAuth points the middleware at a fresh in-memory SQLite database holding one
+// active user, with the given leeway, and returns that user
+func setupAuth(t *testing.T, leeway time.Duration) models.User {
+	t.Helper()
+
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_SQLITE_PATH", "file:"+name+"?mode=memory&cache=shared")
+	t.Setenv("ENV", "production")
+	database.InitDB()
+	db := database.DB
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	SetJWTConfig(&config.JWT{Secret: testSecret, Leeway: leeway})
+
+	user := models.User{Email: "alice@example.com", Password: "unused", Role: models.RoleUser, Status: models.UserStatusActive}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+// signHS256 signs claims with the test secret
+func signHS256(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(testSecret)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return token
+}
+
+// authStatus runs AuthMiddleware with token and returns the response status
+func authStatus(t *testing.T, token string) int {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/whoami", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})(rec, req)
+	return rec.Code
+}
+
+func TestAuthMiddlewareLeeway(t *testing.T) {
+	tests := []struct {
+		name    string
+		leeway  time.Duration
+		expired time.Duration
+		want    int
+	}{
+		{"expired within leeway", 30 * time.Second, 10 * time.Second, http.StatusOK},
+		{"expired beyond leeway", 30 * time.Second, time.Minute, http.StatusUnauthorized},
+		{"expired without leeway", 0, 10 * time.Second, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := setupAuth(t, tt.leeway)
+			now := time.Now()
+			token := signHS256(t, jwt.MapClaims{
+				"user_id": user.ID,
+				"email":   user.Email,
+				"role":    user.Role,
+				"iat":     now.Add(-time.Hour).Unix(),
+				"exp":     now.Add(-tt.expired).Unix(),
+			})
+			if got := authStatus(t, token); got != tt.want {
+				t.Errorf("token expired %s ago with leeway %s: got %d, want %d", tt.expired, tt.leeway, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewareRequiresExpAndIat(t *testing.T) {
+	const partner = "https://partner.example"
+	partnerSecret := []byte("partner-secret-partner-secret-00")
+
+	tests := []struct {
+		name   string
+		issuer string
+		drop   string
+		iat    time.Duration
+		want   int
+	}{
+		{"complete local token", "", "", -time.Minute, http.StatusOK},
+		{"local token without exp", "", "exp", -time.Minute, http.StatusUnauthorized},
+		{"local token without iat", "", "iat", 0, http.StatusUnauthorized},
+		{"local token issued in the future", "", "", time.Hour, http.StatusUnauthorized},
+		{"complete federated token", partner, "", -time.Minute, http.StatusOK},
+		{"federated token without exp", partner, "exp", -time.Minute, http.StatusUnauthorized},
+		{"federated token without iat", partner, "iat", 0, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := setupAuth(t, 0)
+			SetJWTConfig(&config.JWT{Secret: testSecret, TrustedIssuers: map[string]*config.TrustedIssuer{
+				partner: {Issuer: partner, EmailClaim: "email", Secret: partnerSecret},
+			}})
+
+			now := time.Now()
+			claims := jwt.MapClaims{
+				"user_id": user.ID,
+				"email":   user.Email,
+				"role":    user.Role,
+				"iat":     now.Add(tt.iat).Unix(),
+				"exp":     now.Add(time.Hour).Unix(),
+			}
+			secret := testSecret
+			if tt.issuer != "" {
+				delete(claims, "user_id")
+				claims["iss"] = tt.issuer
+				secret = partnerSecret
+			}
+			delete(claims, tt.drop)
+
+			token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+			if err != nil {
+				t.Fatalf("sign token: %v", err)
+			}
+			if got := authStatus(t, token); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// A revocation only covers tokens issued up to it, even within the same second
+func TestAuthMiddlewareRevocationBoundary(t *testing.T) {
+	user := setupAuth(t, 0)
+	revokedAt := time.Now().Add(-2 * time.Second).Truncate(time.Second).Add(500 * time.Millisecond)
+	if err := database.DB.Model(&user).Update("tokens_revoked_at", revokedAt).Error; err != nil {
+		t.Fatalf("revoke tokens: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		iat  float64
+		want int
+	}{
+		{"issued earlier in the second", float64(revokedAt.Add(-100*time.Millisecond).UnixMilli()) / 1000, http.StatusUnauthorized},
+		{"issued later in the second", float64(revokedAt.Add(100*time.Millisecond).UnixMilli()) / 1000, http.StatusOK},
+		{"whole-second iat of that second", float64(revokedAt.Unix()), http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := signHS256(t, jwt.MapClaims{
+				"user_id": user.ID,
+				"email":   user.Email,
+				"role":    user.Role,
+				"iat":     tt.iat,
+				"exp":     time.Now().Add(time.Hour).Unix(),
+			})
+			if got := authStatus(t, token); got != tt.want {
+				t.Errorf("iat %.3f with tokens revoked at %s: got %d, want %d", tt.iat, revokedAt.Format(time.StampMilli), got, tt.want)
+			}
+		})
+	}
+}
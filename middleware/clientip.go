@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// trustedProxies holds the networks allowed to set X-Forwarded-For / X-Real-IP,
+// parsed from the comma-separated TRUSTED_PROXIES list (CIDRs or single IPs)
+var trustedProxies = parseTrustedProxies(getEnv("TRUSTED_PROXIES", ""))
+
+func parseTrustedProxies(value string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil {
+				if ip.To4() != nil {
+					entry += "/32"
+				} else {
+					entry += "/128"
+				}
+			}
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			log.Printf("Ignoring invalid TRUSTED_PROXIES entry %q: %v", entry, err)
+			continue
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+func isTrustedProxy(ip net.IP) bool {
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address of the client that made the request. Forwarding
+// headers are only honoured when the immediate peer is a trusted proxy; otherwise
+// they could be forged, so the connection's RemoteAddr is used.
+func ClientIP(r *http.Request) string {
+	peer := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		peer = host
+	}
+
+	peerIP := net.ParseIP(peer)
+	if peerIP == nil || !isTrustedProxy(peerIP) {
+		return peer
+	}
+
+	// Walk X-Forwarded-For from the nearest hop back, skipping our own proxies
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := net.ParseIP(strings.TrimSpace(hops[i]))
+			if hop == nil {
+				break
+			}
+			if !isTrustedProxy(hop) || i == 0 {
+				return hop.String()
+			}
+		}
+	}
+
+	if realIP := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); realIP != nil {
+		return realIP.String()
+	}
+
+	return peer
+}
@@ -0,0 +1,197 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// defaultCompressionMinBytes is the response size below which compression is skipped
+const defaultCompressionMinBytes = 1024
+
+var gzipWriterPool = sync.Pool{
+	New: func() interface{} {
+		return gzip.NewWriter(io.Discard)
+	},
+}
+
+// Compress gzips responses for clients that send Accept-Encoding: gzip. Responses
+// smaller than COMPRESSION_MIN_BYTES, responses that already carry a
+// Content-Encoding and media that is already compressed (video, audio, images,
+// archives, octet-stream downloads) are passed through untouched.
+func Compress(next http.Handler) http.Handler {
+	minSize := defaultCompressionMinBytes
+	if value, err := strconv.Atoi(getEnv("COMPRESSION_MIN_BYTES", "")); err == nil && value >= 0 {
+		minSize = value
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		// Upgraded connections (WebSockets) take over the raw connection
+		if r.Method == http.MethodHead || r.Header.Get("Range") != "" || r.Header.Get("Upgrade") != "" || !acceptsGzip(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipResponseWriter{ResponseWriter: w, minSize: minSize, statusCode: http.StatusOK}
+		defer gw.finish()
+
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// gzipResponseWriter buffers the start of a response until it knows whether the
+// body is large enough and of a type worth compressing
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	minSize     int
+	statusCode  int
+	wroteHeader bool
+	decided     bool
+	buf         []byte
+	gz          *gzip.Writer
+}
+
+func (gw *gzipResponseWriter) WriteHeader(code int) {
+	if gw.wroteHeader {
+		return
+	}
+	gw.wroteHeader = true
+	gw.statusCode = code
+
+	// Bodiless or non-compressible responses are decided immediately
+	if !bodyAllowed(code) || !compressible(gw.Header()) {
+		gw.passThrough()
+	}
+}
+
+func (gw *gzipResponseWriter) Write(p []byte) (int, error) {
+	if !gw.wroteHeader {
+		if gw.Header().Get("Content-Type") == "" {
+			gw.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		gw.WriteHeader(http.StatusOK)
+	}
+
+	if gw.decided {
+		if gw.gz != nil {
+			return gw.gz.Write(p)
+		}
+		return gw.ResponseWriter.Write(p)
+	}
+
+	gw.buf = append(gw.buf, p...)
+	if len(gw.buf) >= gw.minSize {
+		if err := gw.startGzip(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush commits to compression (if still undecided) and flushes buffered data
+func (gw *gzipResponseWriter) Flush() {
+	if !gw.decided {
+		if gw.startGzip() != nil {
+			return
+		}
+	}
+	if gw.gz != nil {
+		gw.gz.Flush()
+	}
+	if flusher, ok := gw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// passThrough sends the response uncompressed from here on
+func (gw *gzipResponseWriter) passThrough() {
+	gw.decided = true
+	gw.wroteHeader = true
+	gw.ResponseWriter.WriteHeader(gw.statusCode)
+}
+
+func (gw *gzipResponseWriter) startGzip() error {
+	gw.decided = true
+	gw.wroteHeader = true
+
+	header := gw.Header()
+	header.Set("Content-Encoding", "gzip")
+	header.Del("Content-Length")
+	gw.ResponseWriter.WriteHeader(gw.statusCode)
+
+	gz := gzipWriterPool.Get().(*gzip.Writer)
+	gz.Reset(gw.ResponseWriter)
+	gw.gz = gz
+
+	_, err := gz.Write(gw.buf)
+	gw.buf = nil
+	return err
+}
+
+// finish writes whatever is still buffered and releases the gzip writer
+func (gw *gzipResponseWriter) finish() {
+	if !gw.decided {
+		// Handler never wrote a body large enough to compress
+		gw.passThrough()
+		if len(gw.buf) > 0 {
+			gw.ResponseWriter.Write(gw.buf)
+		}
+		return
+	}
+
+	if gw.gz != nil {
+		gw.gz.Close()
+		gzipWriterPool.Put(gw.gz)
+		gw.gz = nil
+	}
+}
+
+// acceptsGzip reports whether the client accepts a gzip-encoded response
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		params := strings.Split(part, ";")
+		encoding := strings.TrimSpace(params[0])
+		if encoding != "gzip" && encoding != "*" {
+			continue
+		}
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil && q == 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func bodyAllowed(status int) bool {
+	return status != http.StatusNoContent && status != http.StatusNotModified && status >= 200
+}
+
+// compressible reports whether a response with these headers should be gzipped
+func compressible(header http.Header) bool {
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+
+	contentType := strings.ToLower(header.Get("Content-Type"))
+	switch {
+	case strings.HasPrefix(contentType, "video/"),
+		strings.HasPrefix(contentType, "audio/"),
+		strings.HasPrefix(contentType, "image/") && !strings.HasPrefix(contentType, "image/svg"),
+		strings.HasPrefix(contentType, "application/octet-stream"),
+		strings.HasPrefix(contentType, "application/zip"),
+		strings.HasPrefix(contentType, "application/gzip"),
+		strings.HasPrefix(contentType, "application/x-gzip"):
+		return false
+	}
+	return true
+}
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"context"
+	"math"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// contextKey is unexported so no other package can collide with (or forge) these keys
+type contextKey int
+
+const (
+	userIDKey contextKey = iota
+	emailKey
+	roleKey
+	requestIDKey
+	claimsKey
+	orgKey
+)
+
+// WithUserID returns a copy of ctx carrying the authenticated user's ID
+func WithUserID(ctx context.Context, userID uint) context.Context {
+	return context.WithValue(ctx, userIDKey, userID)
+}
+
+// UserIDFromContext returns the user ID set by AuthMiddleware. ok is false on routes
+// that are not behind AuthMiddleware.
+func UserIDFromContext(ctx context.Context) (uint, bool) {
+	userID, ok := ctx.Value(userIDKey).(uint)
+	return userID, ok
+}
+
+// withIdentity stores the authenticated user's email and role
+func withIdentity(ctx context.Context, email, role string) context.Context {
+	ctx = context.WithValue(ctx, emailKey, email)
+	return context.WithValue(ctx, roleKey, role)
+}
+
+// EmailFromContext returns the email claim of the authenticated user
+func EmailFromContext(ctx context.Context) (string, bool) {
+	email, ok := ctx.Value(emailKey).(string)
+	return email, ok
+}
+
+// RoleFromContext returns the role claim of the authenticated user
+func RoleFromContext(ctx context.Context) (string, bool) {
+	role, ok := ctx.Value(roleKey).(string)
+	return role, ok
+}
+
+// RequestIDFromContext returns the ID assigned by the RequestID middleware
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	requestID, ok := ctx.Value(requestIDKey).(string)
+	return requestID, ok
+}
+
+// withClaims stores the validated token claims
+func withClaims(ctx context.Context, claims jwt.MapClaims) context.Context {
+	return context.WithValue(ctx, claimsKey, claims)
+}
+
+// ClaimsFromContext returns the claims of the token validated by AuthMiddleware
+func ClaimsFromContext(ctx context.Context) (jwt.MapClaims, bool) {
+	claims, ok := ctx.Value(claimsKey).(jwt.MapClaims)
+	return claims, ok
+}
+
+// orgMembership is the authenticated user's organization and role in it
+type orgMembership struct {
+	orgID uint
+	role  string
+}
+
+// withOrg stores the authenticated user's organization membership
+func withOrg(ctx context.Context, orgID uint, role string) context.Context {
+	return context.WithValue(ctx, orgKey, orgMembership{orgID: orgID, role: role})
+}
+
+// OrgFromContext returns the organization of the authenticated user and their role in
+// it, as loaded by AuthMiddleware. ok is false when the user is not in an organization.
+func OrgFromContext(ctx context.Context) (orgID uint, role string, ok bool) {
+	membership, ok := ctx.Value(orgKey).(orgMembership)
+	return membership.orgID, membership.role, ok
+}
+
+// maxClaimUserID is the largest integer a JSON number (float64) holds exactly
+const maxClaimUserID = 1 << 53
+
+// userIDFromClaim converts a decoded JSON number user_id claim into an ID, rejecting
+// values that are not positive whole numbers or are too large to be exact
+func userIDFromClaim(value interface{}) (uint, bool) {
+	number, ok := value.(float64)
+	if !ok || number < 1 || number > maxClaimUserID || number != math.Trunc(number) {
+		return 0, false
+	}
+	return uint(number), true
+}
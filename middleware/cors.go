@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig is one cross-origin policy. AllowedOrigins lists exact origins
+// ("https://app.example.com") or "*" for any; with none, browsers on other origins
+// get no access. A "*" policy answers with a literal "*" unless AllowCredentials is
+// set, in which case the caller's origin is echoed back.
+type CORSConfig struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight response
+	MaxAge time.Duration
+}
+
+// CORSRoute applies Config to every path under Prefix
+type CORSRoute struct {
+	Prefix string
+	Config CORSConfig
+}
+
+// corsPolicy is a CORSConfig with its header values prepared once
+type corsPolicy struct {
+	anyOrigin   bool
+	origins     map[string]bool
+	credentials bool
+	methods     string
+	headers     string
+	exposed     string
+	maxAge      string
+}
+
+func newCORSPolicy(cfg CORSConfig) *corsPolicy {
+	policy := &corsPolicy{
+		origins:     make(map[string]bool),
+		credentials: cfg.AllowCredentials,
+		methods:     strings.Join(cfg.AllowedMethods, ", "),
+		headers:     strings.Join(cfg.AllowedHeaders, ", "),
+		exposed:     strings.Join(cfg.ExposedHeaders, ", "),
+		maxAge:      strconv.Itoa(int(cfg.MaxAge.Seconds())),
+	}
+	for _, origin := range cfg.AllowedOrigins {
+		if origin == "*" {
+			policy.anyOrigin = true
+		} else {
+			policy.origins[strings.TrimSuffix(origin, "/")] = true
+		}
+	}
+	return policy
+}
+
+// allowOrigin returns the Access-Control-Allow-Origin value for origin, or "" when
+// the origin is not allowed
+func (p *corsPolicy) allowOrigin(origin string) string {
+	if p.anyOrigin && !p.credentials {
+		return "*"
+	}
+	if origin != "" && (p.anyOrigin || p.origins[origin]) {
+		return origin
+	}
+	return ""
+}
+
+func (p *corsPolicy) serve(next http.Handler, w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	allowed := p.allowOrigin(origin)
+	if allowed != "" {
+		if allowed != "*" {
+			w.Header().Add("Vary", "Origin")
+		}
+		w.Header().Set("Access-Control-Allow-Origin", allowed)
+		w.Header().Set("Access-Control-Allow-Methods", p.methods)
+		w.Header().Set("Access-Control-Allow-Headers", p.headers)
+		if p.exposed != "" {
+			w.Header().Set("Access-Control-Expose-Headers", p.exposed)
+		}
+		if p.credentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+	}
+
+	if r.Method == http.MethodOptions {
+		if origin != "" && allowed == "" {
+			writeJSONError(w, http.StatusForbidden, "cors_origin_not_allowed", "Origin is not allowed to call this endpoint")
+			return
+		}
+		w.Header().Set("Access-Control-Max-Age", p.maxAge)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	next.ServeHTTP(w, r)
+}
+
+// CORS applies cfg to every request and answers preflight (OPTIONS) requests itself.
+// Wrap the router with it rather than using router.Use: mux answers OPTIONS on
+// method-restricted routes with 405 before route middleware runs.
+func CORS(cfg CORSConfig) func(http.Handler) http.Handler {
+	return CORSByPrefix(cfg)
+}
+
+// CORSByPrefix applies the policy of the longest matching route prefix, or def when
+// none matches, so route groups such as /auth/admin/ can have their own policy
+func CORSByPrefix(def CORSConfig, routes ...CORSRoute) func(http.Handler) http.Handler {
+	defaultPolicy := newCORSPolicy(def)
+	type prefixPolicy struct {
+		prefix string
+		policy *corsPolicy
+	}
+	prefixed := make([]prefixPolicy, len(routes))
+	for i, route := range routes {
+		prefixed[i] = prefixPolicy{route.Prefix, newCORSPolicy(route.Config)}
+	}
+	sort.SliceStable(prefixed, func(i, j int) bool {
+		return len(prefixed[i].prefix) > len(prefixed[j].prefix)
+	})
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			policy := defaultPolicy
+			for _, candidate := range prefixed {
+				if strings.HasPrefix(r.URL.Path, candidate.prefix) {
+					policy = candidate.policy
+					break
+				}
+			}
+			policy.serve(next, w, r)
+		})
+	}
+}
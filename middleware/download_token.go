@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"auth-service/signing"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DownloadTokenParam is the query parameter carrying a download token
+const DownloadTokenParam = "download_token"
+
+// downloadSigner signs download tokens with a key of their own, so they are never
+// mistaken for share links or OAuth state
+func downloadSigner(secret []byte) *signing.Signer {
+	return signing.New(secret, "download-token")
+}
+
+// NewDownloadToken mints a token that lets userID fetch job jobID through the
+// download routes until expiresAt. issuedAt is checked against the account's token
+// revocations like a JWT's iat.
+func NewDownloadToken(secret []byte, jobID uuid.UUID, userID uint, issuedAt, expiresAt time.Time) string {
+	payload := make([]byte, 32)
+	copy(payload, jobID[:])
+	binary.BigEndian.PutUint64(payload[16:], uint64(userID))
+	binary.BigEndian.PutUint64(payload[24:], uint64(issuedAt.UnixMilli()))
+	return downloadSigner(secret).Sign(payload, expiresAt)
+}
+
+// DownloadAuth authenticates the download routes. A request with an Authorization
+// header goes through AuthMiddleware; one without it may instead carry a download
+// token in ?download_token=, for clients such as the browser <video> element that
+// cannot set headers. The token only works for the job in the route's {id}.
+func DownloadAuth(next http.HandlerFunc) http.HandlerFunc {
+	bearer := AuthMiddleware(next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get(DownloadTokenParam)
+		if token == "" || r.Header.Get("Authorization") != "" {
+			bearer(w, r)
+			return
+		}
+
+		payload, err := downloadSigner(jwtConfig.Secret).Verify(token)
+		if err != nil || len(payload) != 32 {
+			reason := "invalid_download_token"
+			if errors.Is(err, signing.ErrExpired) {
+				reason = "expired_download_token"
+			}
+			tokenValidationFailures.WithLabelValues(reason).Inc()
+			writeJSONError(w, http.StatusUnauthorized, "invalid_download_token", "Invalid or expired download token")
+			return
+		}
+
+		var jobID uuid.UUID
+		copy(jobID[:], payload[:16])
+		if routeID, err := uuid.Parse(mux.Vars(r)["id"]); err != nil || routeID != jobID {
+			tokenValidationFailures.WithLabelValues("download_token_mismatch").Inc()
+			writeJSONError(w, http.StatusForbidden, "download_token_mismatch", "Download token is for a different video")
+			return
+		}
+
+		userID := uint(binary.BigEndian.Uint64(payload[16:24]))
+		issuedAt := time.UnixMilli(int64(binary.BigEndian.Uint64(payload[24:])))
+		user, ok := activeAccount(w, r, userID, issuedAt)
+		if !ok {
+			return
+		}
+
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.Int64("enduser.id", int64(userID)))
+		ctx := WithUserID(r.Context(), userID)
+		if user.OrgID != nil {
+			ctx = withOrg(ctx, *user.OrgID, user.OrgRole)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+}
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// writeJSONError mirrors the handlers package error envelope so middleware
+// rejections have the same shape as handler errors
+func writeJSONError(w http.ResponseWriter, status int, code, message string) {
+	body := map[string]interface{}{
+		"error": map[string]string{
+			"code":    code,
+			"message": message,
+		},
+	}
+	if requestID := w.Header().Get(RequestIDHeader); requestID != "" {
+		body["error"].(map[string]string)["request_id"] = requestID
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"auth-service/config"
+	"auth-service/database"
+	"auth-service/models"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// trustedIssuer returns the configured external issuer named by the token's iss
+// claim, or nil for tokens issued by this service
+func trustedIssuer(claims jwt.MapClaims) *config.TrustedIssuer {
+	iss, _ := claims["iss"].(string)
+	if iss == "" {
+		return nil
+	}
+	return jwtConfig.TrustedIssuers[iss]
+}
+
+// tokenKey picks the verification key by the token's iss claim: a trusted issuer's
+// secret or JWKS key, and the local secret otherwise. The signing algorithm must
+// match the kind of key, so an RSA public key can never be used as an HMAC secret.
+func tokenKey(r *http.Request) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		claims, _ := token.Claims.(jwt.MapClaims)
+		issuer := trustedIssuer(claims)
+		if issuer == nil || issuer.Secret != nil {
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+			}
+			if issuer == nil {
+				return jwtConfig.Secret, nil
+			}
+			return issuer.Secret, nil
+		}
+
+		kid, _ := token.Header["kid"].(string)
+		key, err := issuer.JWKS.Key(r.Context(), kid)
+		if err != nil {
+			return nil, err
+		}
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+			if _, ok := key.(*rsa.PublicKey); ok {
+				return key, nil
+			}
+		case *jwt.SigningMethodECDSA:
+			if _, ok := key.(*ecdsa.PublicKey); ok {
+				return key, nil
+			}
+		}
+		return nil, fmt.Errorf("signing method %s does not match key %q", token.Method.Alg(), kid)
+	}
+}
+
+// federatedUserID maps a trusted issuer's token to the local account with the same
+// email. Accounts are never created from federated tokens, and tokens whose
+// email_verified claim is false are refused. On failure it writes the error response
+// and returns ok=false.
+func federatedUserID(w http.ResponseWriter, issuer *config.TrustedIssuer, claims jwt.MapClaims) (uint, bool) {
+	if issuer.Audience != "" {
+		audience, err := claims.GetAudience()
+		if err != nil || !slices.Contains(audience, issuer.Audience) {
+			tokenValidationFailures.WithLabelValues("invalid_audience").Inc()
+			writeJSONError(w, http.StatusUnauthorized, "invalid_token", "Invalid token")
+			return 0, false
+		}
+	}
+
+	email, _ := claims[issuer.EmailClaim].(string)
+	if verified, present := claims["email_verified"].(bool); email == "" || (present && !verified) {
+		tokenValidationFailures.WithLabelValues("invalid_claims").Inc()
+		writeJSONError(w, http.StatusUnauthorized, "invalid_token", "Invalid token claims")
+		return 0, false
+	}
+
+	var user models.User
+	if err := database.DB.Select("id").Where("email = ?", email).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			tokenValidationFailures.WithLabelValues("unknown_user").Inc()
+			writeJSONError(w, http.StatusUnauthorized, "invalid_token", "Invalid token")
+			return 0, false
+		}
+		log.Printf("Failed to look up federated user from %s: %v", issuer.Issuer, err)
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return 0, false
+	}
+	return user.ID, true
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// maintenanceEnabled starts from MAINTENANCE_MODE and can be flipped at runtime with
+// SetMaintenance. It is per instance.
+var maintenanceEnabled atomic.Bool
+
+func init() {
+	maintenanceEnabled.Store(getEnv("MAINTENANCE_MODE", "false") == "true")
+}
+
+// defaultMaintenanceAllowPaths stay writable in maintenance mode. The admin toggle has
+// to be reachable, otherwise maintenance could not be switched off.
+const defaultMaintenanceAllowPaths = "/health,/ready,/metrics,/auth/admin/maintenance"
+
+// SetMaintenance turns maintenance mode on or off
+func SetMaintenance(enabled bool) {
+	maintenanceEnabled.Store(enabled)
+}
+
+// MaintenanceEnabled reports whether maintenance mode is on
+func MaintenanceEnabled() bool {
+	return maintenanceEnabled.Load()
+}
+
+// Maintenance rejects mutating requests (anything but GET, HEAD and OPTIONS) with a
+// 503 and Retry-After while maintenance mode is on, so reads keep working during a
+// migration. Paths in MAINTENANCE_ALLOW_PATHS (comma-separated, exact match) are exempt.
+func Maintenance(next http.Handler) http.Handler {
+	allowed := make(map[string]bool)
+	for _, path := range strings.Split(getEnv("MAINTENANCE_ALLOW_PATHS", defaultMaintenanceAllowPaths), ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			allowed[path] = true
+		}
+	}
+
+	retryAfter := 120 * time.Second
+	if value, err := time.ParseDuration(getEnv("MAINTENANCE_RETRY_AFTER", "")); err == nil && value > 0 {
+		retryAfter = value
+	}
+	retryAfterSeconds := strconv.Itoa(int(retryAfter.Seconds()))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if maintenanceEnabled.Load() && !allowed[r.URL.Path] {
+			w.Header().Set("Retry-After", retryAfterSeconds)
+			writeJSONError(w, http.StatusServiceUnavailable, "maintenance", "The service is in maintenance mode; only reads are accepted")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
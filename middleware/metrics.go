@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"io"
 	"net/http"
 	"strconv"
 	"time"
@@ -20,28 +21,103 @@ var (
 		Name: "auth_service_http_requests_total",
 		Help: "Total number of HTTP requests.",
 	}, []string{"path", "method", "status_code"})
+
+	// Sizes range from tiny JSON errors to multi-gigabyte video downloads
+	httpRequestSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "auth_service_http_request_size_bytes",
+		Help:    "Size of HTTP request bodies.",
+		Buckets: prometheus.ExponentialBuckets(100, 10, 8),
+	}, []string{"path", "method"})
+
+	httpResponseSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "auth_service_http_response_size_bytes",
+		Help:    "Size of HTTP response bodies.",
+		Buckets: prometheus.ExponentialBuckets(100, 10, 8),
+	}, []string{"path", "method"})
+
+	tokenValidationFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_token_validation_failures_total",
+		Help: "Requests rejected by AuthMiddleware, by reason.",
+	}, []string{"reason"})
 )
 
-// responseWriter is a wrapper for http.ResponseWriter to capture the status code
+// responseWriter is a wrapper for http.ResponseWriter to capture the status code and
+// the number of body bytes written. A handler that writes without calling WriteHeader
+// gets the implicit 200, and only the first WriteHeader call counts, matching net/http.
 type responseWriter struct {
 	http.ResponseWriter
-	statusCode int
+	statusCode   int
+	bytesWritten int64
+	wroteHeader  bool
 }
 
 func newResponseWriter(w http.ResponseWriter) *responseWriter {
-	return &responseWriter{w, http.StatusOK}
+	return &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+}
+
+// StatusCode returns the status sent to the client (200 if nothing was written yet)
+func (rw *responseWriter) StatusCode() int {
+	return rw.statusCode
+}
+
+// BytesWritten returns the number of body bytes written so far
+func (rw *responseWriter) BytesWritten() int64 {
+	return rw.bytesWritten
 }
 
 func (rw *responseWriter) WriteHeader(code int) {
-	rw.statusCode = code
+	if !rw.wroteHeader {
+		rw.statusCode = code
+		rw.wroteHeader = true
+	}
 	rw.ResponseWriter.WriteHeader(code)
 }
 
-// MetricsMiddleware measures the duration and counts the total number of HTTP requests.
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytesWritten += int64(n)
+	return n, err
+}
+
+// Flush passes through to the underlying writer so streamed responses are not buffered
+func (rw *responseWriter) Flush() {
+	rw.wroteHeader = true
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// countingReader counts the bytes read from a request body
+type countingReader struct {
+	io.ReadCloser
+	bytesRead int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.ReadCloser.Read(p)
+	cr.bytesRead += int64(n)
+	return n, err
+}
+
+// MetricsMiddleware measures the duration and counts the total number of HTTP requests,
+// and records request and response body sizes. The request size is Content-Length when
+// the client sent one, otherwise the bytes the handler read.
 func MetricsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		rw := newResponseWriter(w)
+
+		var body *countingReader
+		if r.Body != nil && r.Body != http.NoBody {
+			body = &countingReader{ReadCloser: r.Body}
+			r.Body = body
+		}
 		
 		// Serve the request
 		next.ServeHTTP(rw, r)
@@ -53,11 +129,21 @@ func MetricsMiddleware(next http.Handler) http.Handler {
 			path, _ = route.GetPathTemplate()
 		}
 
-		statusCode := strconv.Itoa(rw.statusCode)
+		statusCode := strconv.Itoa(rw.StatusCode())
 		duration := time.Since(start).Seconds()
 
 		// Record metrics
 		httpDuration.WithLabelValues(path, r.Method, statusCode).Observe(duration)
 		httpRequestsTotal.WithLabelValues(path, r.Method, statusCode).Inc()
+
+		requestSize := r.ContentLength
+		if requestSize < 0 {
+			requestSize = 0
+			if body != nil {
+				requestSize = body.bytesRead
+			}
+		}
+		httpRequestSize.WithLabelValues(path, r.Method).Observe(float64(requestSize))
+		httpResponseSize.WithLabelValues(path, r.Method).Observe(float64(rw.BytesWritten()))
 	})
 }
\ No newline at end of file
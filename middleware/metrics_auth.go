@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// MetricsAuth returns the guard for the /metrics endpoint selected by mode
+// (METRICS_AUTH):
+//
+//   - "" or "none": open, the default
+//   - "basic": HTTP basic auth against METRICS_USERNAME and METRICS_PASSWORD
+//   - "service_token": the SERVICE_TOKEN secret, sent either in X-Service-Token or as
+//     "Authorization: Bearer <token>" (which Prometheus scrape configs support natively)
+//
+// A mode without the credentials it needs is a configuration error.
+func MetricsAuth(mode string) (func(http.Handler) http.Handler, error) {
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case "", "none":
+		return func(next http.Handler) http.Handler { return next }, nil
+
+	case "basic":
+		username, password := getEnv("METRICS_USERNAME", ""), getEnv("METRICS_PASSWORD", "")
+		if username == "" || password == "" {
+			return nil, fmt.Errorf("METRICS_AUTH=basic requires METRICS_USERNAME and METRICS_PASSWORD")
+		}
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				user, pass, ok := r.BasicAuth()
+				if !ok || !secretsEqual(user, username) || !secretsEqual(pass, password) {
+					w.Header().Set("WWW-Authenticate", `Basic realm="metrics"`)
+					writeJSONError(w, http.StatusUnauthorized, "authorization_required", "Metrics require authentication")
+					return
+				}
+				next.ServeHTTP(w, r)
+			})
+		}, nil
+
+	case "service_token":
+		secret := getEnv("SERVICE_TOKEN", "")
+		if secret == "" {
+			return nil, fmt.Errorf("METRICS_AUTH=service_token requires SERVICE_TOKEN")
+		}
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				token := r.Header.Get(ServiceTokenHeader)
+				if token == "" {
+					token = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+				}
+				if token == "" || !secretsEqual(token, secret) {
+					writeJSONError(w, http.StatusUnauthorized, "service_token_required", "Metrics require the service token")
+					return
+				}
+				next.ServeHTTP(w, r)
+			})
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown METRICS_AUTH mode %q (want none, basic or service_token)", mode)
+}
+
+// secretsEqual compares a presented credential with the expected one in constant time
+func secretsEqual(presented, expected string) bool {
+	return subtle.ConstantTimeCompare([]byte(presented), []byte(expected)) == 1
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter allows up to limit events per key in a fixed time window. It keeps its
+// counters in memory, so limits apply per instance.
+type RateLimiter struct {
+	limit  int
+	window time.Duration
+
+	mu        sync.Mutex
+	windows   map[string]*rateWindow
+	lastSweep time.Time
+}
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// NewRateLimiter creates a RateLimiter allowing limit events per key every window.
+// A limit below one disables limiting.
+func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+	return &RateLimiter{
+		limit:     limit,
+		window:    window,
+		windows:   make(map[string]*rateWindow),
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow records an event for key. When the key is over its limit it returns false and
+// how long until the current window ends.
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	if l.limit < 1 {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweepLocked(now)
+
+	current, ok := l.windows[key]
+	if !ok || now.Sub(current.start) >= l.window {
+		current = &rateWindow{start: now}
+		l.windows[key] = current
+	}
+
+	if current.count >= l.limit {
+		return false, current.start.Add(l.window).Sub(now)
+	}
+	current.count++
+	return true, 0
+}
+
+// sweepLocked drops expired windows at most once per window so the map stays bounded
+// by the keys seen recently
+func (l *RateLimiter) sweepLocked(now time.Time) {
+	if now.Sub(l.lastSweep) < l.window {
+		return
+	}
+	for key, current := range l.windows {
+		if now.Sub(current.start) >= l.window {
+			delete(l.windows, key)
+		}
+	}
+	l.lastSweep = now
+}
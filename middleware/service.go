@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+)
+
+// ServiceTokenHeader is the header internal callers use to present the shared secret
+const ServiceTokenHeader = "X-Service-Token"
+
+// RequireServiceToken guards internal endpoints that must only be called by other
+// services in the cluster. It compares the X-Service-Token header against the
+// SERVICE_TOKEN secret in constant time. When no secret is configured every request
+// is rejected so internal routes are never accidentally left open.
+func RequireServiceToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		secret := getEnv("SERVICE_TOKEN", "")
+		if secret == "" {
+			log.Printf("Rejected internal request to %s: SERVICE_TOKEN is not configured", r.URL.Path)
+			writeJSONError(w, http.StatusServiceUnavailable, "service_unavailable", "Internal endpoints are not configured")
+			return
+		}
+
+		token := r.Header.Get(ServiceTokenHeader)
+		if token == "" {
+			log.Printf("Rejected internal request to %s from %s: missing service token", r.URL.Path, ClientIP(r))
+			writeJSONError(w, http.StatusUnauthorized, "service_token_required", "Service token required")
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+			log.Printf("Rejected internal request to %s from %s: invalid service token", r.URL.Path, ClientIP(r))
+			writeJSONError(w, http.StatusUnauthorized, "invalid_service_token", "Invalid service token")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
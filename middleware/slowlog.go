@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// defaultSlowRequestExemptRoutes are expected to outlive any threshold: the job
+// updates socket and video downloads
+const defaultSlowRequestExemptRoutes = "/auth/ws,/auth/video/transcode/{id}/download"
+
+// requestTiming collects what a slow-request log line reports about a request beyond
+// its duration. AuthMiddleware and the proxy handlers fill it in from inner contexts,
+// so it is shared by pointer.
+type requestTiming struct {
+	mu         sync.Mutex
+	userID     uint
+	downstream []downstreamCall
+}
+
+type downstreamCall struct {
+	service  string
+	duration time.Duration
+}
+
+type requestTimingKey struct{}
+
+func timingFromContext(ctx context.Context) *requestTiming {
+	timing, _ := ctx.Value(requestTimingKey{}).(*requestTiming)
+	return timing
+}
+
+// recordUser notes the authenticated user for the slow-request log
+func recordUser(ctx context.Context, userID uint) {
+	if timing := timingFromContext(ctx); timing != nil {
+		timing.mu.Lock()
+		timing.userID = userID
+		timing.mu.Unlock()
+	}
+}
+
+// RecordDownstream notes how long a call to a downstream service took, so a slow
+// request's log line shows where the time went. It does nothing outside SlowRequestLog.
+func RecordDownstream(ctx context.Context, service string, duration time.Duration) {
+	if timing := timingFromContext(ctx); timing != nil {
+		timing.mu.Lock()
+		timing.downstream = append(timing.downstream, downstreamCall{service, duration})
+		timing.mu.Unlock()
+	}
+}
+
+// SlowRequestLog logs a warning for every request that takes longer than
+// SLOW_REQUEST_THRESHOLD (2s; 0 turns the log off), with its route template, status,
+// request ID, user and the time spent in downstream services. Routes in
+// SLOW_REQUEST_EXEMPT_ROUTES (comma-separated route templates) are never logged.
+func SlowRequestLog(next http.Handler) http.Handler {
+	threshold := 2 * time.Second
+	if value, err := time.ParseDuration(getEnv("SLOW_REQUEST_THRESHOLD", "")); err == nil && value >= 0 {
+		threshold = value
+	}
+	if threshold == 0 {
+		return next
+	}
+
+	exempt := make(map[string]bool)
+	for _, route := range strings.Split(getEnv("SLOW_REQUEST_EXEMPT_ROUTES", defaultSlowRequestExemptRoutes), ",") {
+		if route = strings.TrimSpace(route); route != "" {
+			exempt[route] = true
+		}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := "unknown"
+		if route := mux.CurrentRoute(r); route != nil {
+			path, _ = route.GetPathTemplate()
+		}
+		if exempt[path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		timing := &requestTiming{}
+		rw := newResponseWriter(w)
+		next.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), requestTimingKey{}, timing)))
+
+		elapsed := time.Since(start)
+		if elapsed < threshold {
+			return
+		}
+
+		timing.mu.Lock()
+		defer timing.mu.Unlock()
+		user := "-"
+		if timing.userID != 0 {
+			user = fmt.Sprint(timing.userID)
+		}
+		downstream := "-"
+		if len(timing.downstream) > 0 {
+			calls := make([]string, len(timing.downstream))
+			for i, call := range timing.downstream {
+				calls[i] = fmt.Sprintf("%s:%s", call.service, call.duration.Round(time.Millisecond))
+			}
+			downstream = strings.Join(calls, ",")
+		}
+		requestID, _ := RequestIDFromContext(r.Context())
+		log.Printf("WARN slow request: %s %s status=%d duration=%s request_id=%s user=%s downstream=%s",
+			r.Method, path, rw.StatusCode(), elapsed.Round(time.Millisecond), requestID, user, downstream)
+	})
+}
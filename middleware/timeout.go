@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Timeout bounds how long a handler may run. The request context is cancelled after d
+// so database and downstream calls stop early. If the handler has not started its
+// response by then the client gets a 503 JSON error; if it is already streaming (e.g. a
+// download) the response is cut off. Unlike http.TimeoutHandler the response is not
+// buffered, so it is safe for large bodies.
+func Timeout(d time.Duration) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+
+			tw := &timeoutWriter{ResponseWriter: w, header: w.Header().Clone()}
+			done := make(chan struct{})
+			panicked := make(chan interface{}, 1)
+
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						panicked <- p
+					}
+				}()
+				next.ServeHTTP(tw, r.WithContext(ctx))
+				close(done)
+			}()
+
+			select {
+			case <-done:
+			case p := <-panicked:
+				panic(p)
+			case <-ctx.Done():
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				tw.timedOut = true
+				if !tw.wroteHeader {
+					writeJSONError(w, http.StatusServiceUnavailable, "request_timeout", "Request timed out")
+				}
+			}
+		}
+	}
+}
+
+// timeoutWriter stops passing writes through once the request has timed out, so the
+// handler goroutine never touches the ResponseWriter after ServeHTTP has returned.
+// The handler gets its own header map, copied to the real one when the response starts,
+// so a timeout response can be written without racing the handler.
+type timeoutWriter struct {
+	http.ResponseWriter
+	header      http.Header
+	mu          sync.Mutex
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	tw.writeHeaderLocked(code)
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !tw.wroteHeader {
+		tw.writeHeaderLocked(http.StatusOK)
+	}
+	return tw.ResponseWriter.Write(b)
+}
+
+func (tw *timeoutWriter) writeHeaderLocked(code int) {
+	dst := tw.ResponseWriter.Header()
+	for key := range dst {
+		if _, ok := tw.header[key]; !ok {
+			delete(dst, key)
+		}
+	}
+	for key, values := range tw.header {
+		dst[key] = values
+	}
+	tw.wroteHeader = true
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return
+	}
+	if !tw.wroteHeader {
+		tw.writeHeaderLocked(http.StatusOK)
+	}
+	if f, ok := tw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
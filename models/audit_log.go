@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// AuditLog records one security-relevant event: who (ActorID, nil when nobody was
+// signed in) did what (Action) to what (TargetType and TargetID), from where and when.
+// Details holds event-specific fields such as the roles before and after a change.
+type AuditLog struct {
+	ID         uint                   `gorm:"primaryKey" json:"id"`
+	ActorID    *uint                  `gorm:"index" json:"actor_id"`
+	Action     string                 `gorm:"type:varchar(64);not null;index" json:"action"`
+	TargetType string                 `gorm:"type:varchar(32);index:idx_audit_logs_target" json:"target_type,omitempty"`
+	TargetID   string                 `gorm:"type:varchar(255);index:idx_audit_logs_target" json:"target_id,omitempty"`
+	IP         string                 `gorm:"type:varchar(64)" json:"ip"`
+	RequestID  string                 `gorm:"type:varchar(64)" json:"request_id,omitempty"`
+	Details    map[string]interface{} `gorm:"type:text;serializer:json" json:"details,omitempty"`
+	CreatedAt  time.Time              `gorm:"not null;index" json:"created_at"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// IdempotencyKey remembers the response to a job submission made with an
+// Idempotency-Key header so a retried request can be answered without creating
+// a second job. A row with a zero StatusCode is a request still in flight.
+type IdempotencyKey struct {
+	Key          string    `gorm:"type:varchar(255);primaryKey" json:"key"`
+	UserID       uint      `gorm:"primaryKey" json:"user_id"`
+	RequestHash  string    `gorm:"type:varchar(64);not null" json:"-"`
+	StatusCode   int       `gorm:"not null;default:0" json:"status_code"`
+	ContentType  string    `gorm:"type:varchar(255)" json:"content_type"`
+	ResponseBody string    `gorm:"type:text" json:"-"`
+	JobID        *string   `gorm:"type:varchar(255)" json:"job_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	ExpiresAt    time.Time `gorm:"not null;index" json:"expires_at"`
+}
+
+// TableName returns the table name for the IdempotencyKey model
+func (IdempotencyKey) TableName() string {
+	return "idempotency_keys"
+}
+
+// Completed reports whether the original request has finished and its response was stored
+func (k *IdempotencyKey) Completed() bool {
+	return k.StatusCode != 0
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// InviteCode is a single-use code that allows one registration while invites are
+// required. Only the SHA-256 of the code is stored.
+type InviteCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	CodeHash  string     `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"`
+	CreatedBy uint       `gorm:"not null" json:"created_by"`
+	UsedBy    *uint      `json:"used_by"`
+	UsedAt    *time.Time `json:"used_at"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// TableName returns the table name for the InviteCode model
+func (InviteCode) TableName() string {
+	return "invite_codes"
+}
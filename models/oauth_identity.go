@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// OAuthIdentity links a user account to an account at an external OAuth provider.
+// A user may have one identity per provider.
+type OAuthIdentity struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	UserID         uint      `gorm:"not null;index" json:"user_id"`
+	Provider       string    `gorm:"type:varchar(50);not null;uniqueIndex:oauth_identities_provider_subject_index" json:"provider"`
+	ProviderUserID string    `gorm:"type:varchar(255);not null;uniqueIndex:oauth_identities_provider_subject_index" json:"provider_user_id"`
+	Email          string    `gorm:"type:varchar(255)" json:"email"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// TableName returns the table name for the OAuthIdentity model
+func (OAuthIdentity) TableName() string {
+	return "oauth_identities"
+}
@@ -0,0 +1,75 @@
+package models
+
+import "time"
+
+// Organization roles. Members see only their own jobs; managers and admins see every
+// job in the organization, and admins also manage its membership.
+const (
+	OrgRoleMember  = "member"
+	OrgRoleManager = "manager"
+	OrgRoleAdmin   = "admin"
+)
+
+// IsValidOrgRole reports whether role is one of the organization roles
+func IsValidOrgRole(role string) bool {
+	switch role {
+	case OrgRoleMember, OrgRoleManager, OrgRoleAdmin:
+		return true
+	}
+	return false
+}
+
+// OrgRoleSeesAllJobs reports whether an organization role grants read access to jobs
+// created by other members
+func OrgRoleSeesAllJobs(role string) bool {
+	return role == OrgRoleManager || role == OrgRoleAdmin
+}
+
+// Organization groups users into a team with shared access to its jobs
+type Organization struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"type:varchar(255);not null" json:"name"`
+	CreatedBy uint      `gorm:"not null" json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName returns the table name for the Organization model
+func (Organization) TableName() string {
+	return "organizations"
+}
+
+// OrgInvite invites an email address to join an organization. It takes effect only
+// when the owner of a verified account with that address accepts it; an accepted
+// invite is deleted.
+type OrgInvite struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	OrgID     uint      `gorm:"not null;uniqueIndex:idx_org_invites_org_email" json:"org_id"`
+	Email     string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_org_invites_org_email;index" json:"email"`
+	Role      string    `gorm:"type:varchar(20);not null" json:"role"`
+	InvitedBy uint      `gorm:"not null" json:"invited_by"`
+	ExpiresAt time.Time `gorm:"not null" json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName returns the table name for the OrgInvite model
+func (OrgInvite) TableName() string {
+	return "org_invites"
+}
+
+// CreateOrganizationRequest creates an organization with the caller as its admin
+type CreateOrganizationRequest struct {
+	Name string `json:"name" validate:"required"`
+}
+
+// InviteOrgMemberRequest invites an email address to the caller's organization
+type InviteOrgMemberRequest struct {
+	Email string `json:"email" validate:"required,email"`
+	// Role defaults to member
+	Role string `json:"role,omitempty"`
+}
+
+// UpdateOrgMemberRequest changes a member's organization role
+type UpdateOrgMemberRequest struct {
+	Role string `json:"role" validate:"required"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ShareLink records a signed link that gives anyone holding it access to one
+// transcoded video until it expires or is revoked. The token itself is not stored;
+// it carries the link and job IDs and is verified by its signature.
+type ShareLink struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	JobID     uuid.UUID  `gorm:"type:uuid;not null;index" json:"job_id"`
+	CreatedBy uint       `gorm:"not null;index" json:"created_by"`
+	ExpiresAt time.Time  `gorm:"not null;index" json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// TableName returns the table name for the ShareLink model
+func (ShareLink) TableName() string {
+	return "share_links"
+}
+
+// IsActive reports whether the link can still be used at now
+func (l *ShareLink) IsActive(now time.Time) bool {
+	return l.RevokedAt == nil && now.Before(l.ExpiresAt)
+}
+
+// CreateShareLinkRequest optionally sets how long a share link is valid
+type CreateShareLinkRequest struct {
+	// ExpiresIn is the lifetime in seconds; SHARE_LINK_TTL is used when it is 0
+	ExpiresIn int `json:"expires_in,omitempty"`
+}
@@ -42,6 +42,11 @@ type TranscodingJob struct {
 	InsertedAt      time.Time            `gorm:"type:timestamp(0);not null;index:transcoding_jobs_inserted_at_index,transcoding_jobs_status_inserted_at_index" json:"inserted_at"`
 	UpdatedAt       time.Time            `gorm:"type:timestamp(0);not null" json:"updated_at"`
 	CreatedBy      *uint               `gorm:"type:integer;index" json:"created_by,omitempty"`
+	// OrgID is the creator's organization at the time the job was submitted
+	OrgID      *uint               `gorm:"type:integer;index" json:"org_id,omitempty"`
+	DeletedAt       gorm.DeletedAt       `gorm:"index" json:"deleted_at"`
+	// RetryOf links a job resubmitted via the retry endpoint to the job it retries
+	RetryOf         *uuid.UUID           `gorm:"type:uuid;index" json:"retry_of,omitempty"`
 }
 
 // TableName returns the table name for the TranscodingJob model
@@ -69,6 +74,11 @@ func (tj *TranscodingJob) BeforeUpdate(tx *gorm.DB) error {
 	return nil
 }
 
+// IsRetryable reports whether a job in this status may be resubmitted
+func (s TranscodingJobStatus) IsRetryable() bool {
+	return s == StatusFailed || s == StatusCancelled
+}
+
 // IsValidStatus checks if the provided status is valid
 func (s TranscodingJobStatus) IsValid() bool {
 	switch s {
@@ -5,12 +5,45 @@ import (
     "gorm.io/gorm"
 )
 
+// User roles
+const (
+    RoleUser  = "user"
+    RoleAdmin = "admin"
+)
+
+// User account statuses
+const (
+    UserStatusActive    = "active"
+    UserStatusSuspended = "suspended"
+)
+
 type User struct {
     ID        uint      `json:"id" gorm:"primaryKey"`
     Email     string    `json:"email" gorm:"uniqueIndex;not null"`
     Password  string    `json:"-" gorm:"column:password_hash;not null"`
-    CreatedAt time.Time `json:"created_at"`
-    UpdatedAt time.Time `json:"updated_at"`
+    Role      string    `json:"role" gorm:"type:varchar(20);not null;default:'user'"`
+    Status    string    `json:"status" gorm:"type:varchar(20);not null;default:'active'"`
+    SuspendedReason *string `json:"suspended_reason,omitempty" gorm:"type:text"`
+    // Tokens issued at or before this time are rejected
+    TokensRevokedAt *time.Time `json:"-"`
+    // While set, tokens only work for changing the password (see POST /auth/password)
+    MustChangePassword bool `json:"must_change_password" gorm:"not null;default:false"`
+    // Organization the user belongs to, if any, and their role in it (see OrgRole*)
+    OrgID   *uint  `json:"org_id,omitempty" gorm:"index"`
+    OrgRole string `json:"org_role,omitempty" gorm:"type:varchar(20);not null;default:''"`
+    // Set once the owner proves control of Email; only the SHA-256 of the emailed token is stored
+    EmailVerifiedAt       *time.Time `json:"email_verified_at"`
+    VerificationTokenHash *string    `json:"-" gorm:"type:varchar(64);index"`
+    VerificationExpiresAt *time.Time `json:"-"`
+    // Email change awaiting confirmation; only the SHA-256 of the emailed token is stored
+    PendingEmail         *string    `json:"pending_email,omitempty" gorm:"type:varchar(255)"`
+    EmailChangeTokenHash *string    `json:"-" gorm:"type:varchar(64);index"`
+    EmailChangeExpiresAt *time.Time `json:"-"`
+    // Optional profile details, editable with PATCH /auth/profile
+    DisplayName *string `json:"display_name,omitempty" gorm:"type:varchar(100)"`
+    AvatarURL   *string `json:"avatar_url,omitempty" gorm:"type:text"`
+    CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+    UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime"`
     DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
@@ -19,9 +52,64 @@ func (User) TableName() string {
     return "users"
 }
 
+// BeforeCreate makes sure both timestamps are populated on insert
+func (u *User) BeforeCreate(tx *gorm.DB) error {
+    now := time.Now()
+    if u.CreatedAt.IsZero() {
+        u.CreatedAt = now
+    }
+    u.UpdatedAt = now
+    return nil
+}
+
+// BeforeUpdate bumps UpdatedAt on every save/update
+func (u *User) BeforeUpdate(tx *gorm.DB) error {
+    u.UpdatedAt = time.Now()
+    return nil
+}
+
+// IsSuspended reports whether an admin has suspended the account
+func (u *User) IsSuspended() bool {
+    return u.Status == UserStatusSuspended
+}
+
+// IsEmailVerified reports whether the account's email address has been confirmed
+func (u *User) IsEmailVerified() bool {
+    return u.EmailVerifiedAt != nil
+}
+
+// TokenRevoked reports whether a token issued at issuedAt has been revoked. Local
+// tokens carry iat in milliseconds, so one minted right after a revocation, in the
+// same second, stays valid.
+func (u *User) TokenRevoked(issuedAt time.Time) bool {
+    return u.TokensRevokedAt != nil && !issuedAt.After(*u.TokensRevokedAt)
+}
+
 type RegisterRequest struct {
     Email    string `json:"email" validate:"required,email"`
     Password string `json:"password" validate:"required,min=6"`
+    // InviteCode is required when REGISTRATION_INVITE_REQUIRED is set
+    InviteCode string `json:"invite_code,omitempty"`
+}
+
+// CreateUserRequest is an admin request to create an account directly
+type CreateUserRequest struct {
+    Email    string `json:"email" validate:"required,email"`
+    Password string `json:"password" validate:"required,min=6"`
+    Role     string `json:"role,omitempty"`
+    // MustChangePassword makes the user replace the password on first login
+    MustChangePassword bool `json:"must_change_password,omitempty"`
+}
+
+// ChangePasswordRequest replaces the caller's password
+type ChangePasswordRequest struct {
+    CurrentPassword string `json:"current_password" validate:"required"`
+    NewPassword     string `json:"new_password" validate:"required,min=6"`
+}
+
+// ResendVerificationRequest asks for a fresh verification email
+type ResendVerificationRequest struct {
+    Email string `json:"email" validate:"required,email"`
 }
 
 type LoginRequest struct {
@@ -32,4 +120,20 @@ type LoginRequest struct {
 type AuthResponse struct {
     Token string `json:"token"`
     User  User   `json:"user"`
+    // PasswordChangeRequired means the token only works for POST /auth/password until
+    // the password is changed
+    PasswordChangeRequired bool `json:"password_change_required,omitempty"`
+}
+
+// ProfileStats holds summary counts about a user's video jobs
+type ProfileStats struct {
+    TotalTranscodes int64 `json:"total_transcodes"`
+    TotalAnalyses   int64 `json:"total_analyses"`
+    ActiveJobs      int64 `json:"active_jobs"`
+}
+
+// ProfileResponse is the profile payload with optional embedded stats
+type ProfileResponse struct {
+    User
+    Stats *ProfileStats `json:"stats,omitempty"`
 }
\ No newline at end of file
@@ -17,6 +17,11 @@ const (
 	AnalysisStatusFailed     VideoAnalysisStatus = "failed"
 )
 
+// IsTerminal reports whether an analysis in this status has finished, successfully or not
+func (s VideoAnalysisStatus) IsTerminal() bool {
+	return s == AnalysisStatusCompleted || s == AnalysisStatusFailed
+}
+
 // VideoAnalysis represents a video analysis job
 type VideoAnalysis struct {
 	JobID        string              `gorm:"type:varchar(255);primaryKey;default:uuid_generate_v4()" json:"job_id"`
@@ -29,6 +34,9 @@ type VideoAnalysis struct {
 	ErrorMessage *string             `gorm:"type:text" json:"error_message"`
 	// Foreign key to link to the user who created the analysis can be null if not applicable
 	CreatedBy    *uint               `gorm:"type:integer;index" json:"created_by,omitempty"`
+	// OrgID is the creator's organization at the time the job was submitted
+	OrgID        *uint               `gorm:"type:integer;index" json:"org_id,omitempty"`
+	DeletedAt    gorm.DeletedAt      `gorm:"index" json:"deleted_at"`
 }
 
 // BeforeCreate hook to generate UUID for job_id if not provided
@@ -0,0 +1,80 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/endpoints"
+)
+
+const (
+	githubUserURL   = "https://api.github.com/user"
+	githubEmailsURL = "https://api.github.com/user/emails"
+)
+
+// GitHub signs users in with their GitHub account
+type GitHub struct {
+	config *oauth2.Config
+}
+
+// NewGitHub creates the GitHub provider
+func NewGitHub(clientID, clientSecret, redirectURL string) *GitHub {
+	return &GitHub{config: &oauth2.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		Endpoint:     endpoints.GitHub,
+		Scopes:       []string{"read:user", "user:email"},
+	}}
+}
+
+func (g *GitHub) Name() string { return "github" }
+
+// AuthURL ignores nonce: GitHub is plain OAuth 2.0 and issues no ID token
+func (g *GitHub) AuthURL(state, nonce string) string {
+	return g.config.AuthCodeURL(state)
+}
+
+func (g *GitHub) Exchange(ctx context.Context, code string) (*oauth2.Token, error) {
+	return g.config.Exchange(ctx, code)
+}
+
+// FetchUser reads the profile and the primary email. The public profile email may be
+// empty or unverified, so the verified primary address from /user/emails is used.
+func (g *GitHub) FetchUser(ctx context.Context, token *oauth2.Token) (*User, error) {
+	var profile struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+		Name  string `json:"name"`
+	}
+	if err := getJSON(ctx, g.config, token, githubUserURL, &profile); err != nil {
+		return nil, err
+	}
+	if profile.ID == 0 {
+		return nil, fmt.Errorf("github user response has no id")
+	}
+
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := getJSON(ctx, g.config, token, githubEmailsURL, &emails); err != nil {
+		return nil, err
+	}
+
+	user := &User{ProviderUserID: strconv.FormatInt(profile.ID, 10), Name: profile.Name}
+	if user.Name == "" {
+		user.Name = profile.Login
+	}
+	for _, e := range emails {
+		if e.Primary {
+			user.Email = e.Email
+			user.EmailVerified = e.Verified
+			break
+		}
+	}
+	return user, nil
+}
@@ -0,0 +1,123 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// User is the identity returned by a provider after a successful login
+type User struct {
+	ProviderUserID string
+	Email          string
+	EmailVerified  bool
+	Name           string
+}
+
+// Provider is implemented by each supported OAuth identity provider
+type Provider interface {
+	// Name is the provider key used in URLs, e.g. "google"
+	Name() string
+	// AuthURL returns the provider's consent page URL for the given state. Providers
+	// that support OpenID Connect also send nonce so it comes back in the ID token.
+	AuthURL(state, nonce string) string
+	// Exchange trades an authorization code for an access token
+	Exchange(ctx context.Context, code string) (*oauth2.Token, error)
+	// FetchUser loads the authenticated user's profile with the token
+	FetchUser(ctx context.Context, token *oauth2.Token) (*User, error)
+}
+
+// NonceVerifier is implemented by providers that return an ID token, to check that the
+// token was issued for the nonce of this login flow
+type NonceVerifier interface {
+	VerifyNonce(token *oauth2.Token, nonce string) error
+}
+
+// Registry looks up providers by name
+type Registry struct {
+	providers map[string]Provider
+}
+
+// NewRegistry creates a registry containing the given providers
+func NewRegistry(providers ...Provider) *Registry {
+	r := &Registry{providers: make(map[string]Provider)}
+	for _, p := range providers {
+		r.providers[p.Name()] = p
+	}
+	return r
+}
+
+// Get returns the provider registered under name
+func (r *Registry) Get(name string) (Provider, bool) {
+	if r == nil {
+		return nil, false
+	}
+	p, ok := r.providers[name]
+	return p, ok
+}
+
+// Names returns the registered provider names in sorted order
+func (r *Registry) Names() []string {
+	if r == nil {
+		return nil
+	}
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadProviders registers every provider whose client ID and secret are configured.
+// Callback URLs are derived from APP_BASE_URL: {APP_BASE_URL}/auth/oauth/{provider}/callback.
+func LoadProviders() *Registry {
+	baseURL := strings.TrimRight(getEnv("APP_BASE_URL", "http://localhost:8080"), "/")
+	redirectURL := func(name string) string {
+		return fmt.Sprintf("%s/auth/oauth/%s/callback", baseURL, name)
+	}
+
+	var providers []Provider
+	if id, secret := getEnv("GOOGLE_CLIENT_ID", ""), getEnv("GOOGLE_CLIENT_SECRET", ""); id != "" && secret != "" {
+		providers = append(providers, NewGoogle(id, secret, redirectURL("google")))
+	}
+	if id, secret := getEnv("GITHUB_CLIENT_ID", ""), getEnv("GITHUB_CLIENT_SECRET", ""); id != "" && secret != "" {
+		providers = append(providers, NewGitHub(id, secret, redirectURL("github")))
+	}
+	return NewRegistry(providers...)
+}
+
+// getJSON performs an authenticated GET and decodes the JSON response into dest
+func getJSON(ctx context.Context, cfg *oauth2.Config, token *oauth2.Token, url string, dest interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := cfg.Client(ctx, token).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("GET %s returned %d: %s", url, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return json.NewDecoder(resp.Body).Decode(dest)
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}